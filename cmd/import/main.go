@@ -0,0 +1,101 @@
+// import bulk load lessons or lesson progress from a CSV or JSON file
+//
+// it shares configuration flags and environment variables with the server, eg.
+//
+//	import --kind progress --file progress.csv --dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pot-code/go-boilerplate/internal/importer"
+	infra "github.com/pot-code/go-boilerplate/internal/infrastructure"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime)
+	kind := pflag.String("kind", "", "what to import, can be 'lessons' or 'progress' (required)")
+	file := pflag.String("file", "", "input file, the format is inferred from the extension unless --format is set (required)")
+	format := pflag.String("format", "", "input format, can be 'csv' or 'json'")
+	dryRun := pflag.Bool("dry-run", false, "validate only, nothing is written")
+	batchSize := pflag.Int("batch-size", importer.DefaultBatchSize, "rows written in one transaction")
+
+	option, err := infra.InitConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *file == "" {
+		log.Fatal("--file is required")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	logger, err := logging.NewLogger(&logging.Config{
+		FilePath: option.Logging.FilePath,
+		Level:    option.Logging.Level,
+		AppID:    option.AppID,
+		Env:      option.Env,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create logger: %s\n", err)
+	}
+	defer logger.Sync()
+
+	dbConn, err := driver.GetDBConnection(&driver.DBConfig{
+		User:               option.Database.User,
+		Password:           option.Database.Password,
+		MaxConn:            option.Database.MaxConn,
+		Protocol:           option.Database.Protocol,
+		Driver:             option.Database.Driver,
+		Host:               option.Database.Host,
+		Port:               option.Database.Port,
+		Query:              option.Database.Query,
+		Schema:             option.Database.Schema,
+		SlowQueryThreshold: option.Database.SlowQueryThreshold,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create DB connection: %s\n", err)
+	}
+	ctx := logging.SetLoggerInContext(context.Background(), logger)
+	defer dbConn.Close(ctx)
+
+	ImporterRepo := importer.NewImporterRepository(dbConn)
+	ImporterUseCase := importer.NewImporterUseCase(ImporterRepo, validate.NewValidator())
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open input: %s\n", err)
+	}
+	defer input.Close()
+
+	options := &importer.OptionsModel{Format: *format, DryRun: *dryRun, BatchSize: *batchSize}
+	var result *importer.ResultModel
+	switch *kind {
+	case "lessons":
+		result, err = ImporterUseCase.ImportLessons(ctx, input, options)
+	case "progress":
+		result, err = ImporterUseCase.ImportProgress(ctx, input, options)
+	default:
+		log.Fatalf("Unknown kind: %s\n", *kind)
+	}
+	if err != nil {
+		log.Fatalf("Failed to import: %s\n", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
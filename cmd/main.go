@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"strconv"
+	"time"
 
+	"github.com/pot-code/go-boilerplate/internal/importer"
 	infra "github.com/pot-code/go-boilerplate/internal/infrastructure"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/cache"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/uuid"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
 	"github.com/pot-code/go-boilerplate/internal/interfaces/rest"
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
 	"github.com/pot-code/go-boilerplate/internal/lesson"
 	timespent "github.com/pot-code/go-boilerplate/internal/time_spent"
 	"github.com/pot-code/go-boilerplate/internal/user"
@@ -36,15 +44,19 @@ func main() {
 	defer logger.Sync()
 
 	dbConn, err := driver.GetDBConnection(&driver.DBConfig{
-		User:     option.Database.User,
-		Password: option.Database.Password,
-		MaxConn:  option.Database.MaxConn,
-		Protocol: option.Database.Protocol,
-		Driver:   option.Database.Driver,
-		Host:     option.Database.Host,
-		Port:     option.Database.Port,
-		Query:    option.Database.Query,
-		Schema:   option.Database.Schema,
+		User:                 option.Database.User,
+		Password:             option.Database.Password,
+		MaxConn:              option.Database.MaxConn,
+		Protocol:             option.Database.Protocol,
+		Driver:               option.Database.Driver,
+		Host:                 option.Database.Host,
+		Port:                 option.Database.Port,
+		Query:                option.Database.Query,
+		Schema:               option.Database.Schema,
+		SlowQueryThreshold:   option.Database.SlowQueryThreshold,
+		Replicas:             option.Database.Replicas,
+		ReplicaCheckInterval: option.Database.ReplicaCheckInterval,
+		Logger:               logger,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create DB connection: %s\n", err)
@@ -52,23 +64,88 @@ func main() {
 	logger.Debug("Create database instance", zap.String("db.driver", option.Database.Driver),
 		zap.String("db.schema", option.Database.Schema),
 		zap.String("db.host", option.Database.Host),
+		zap.Strings("db.replicas", option.Database.Replicas),
 	)
 
-	rdb := driver.NewRedisClient(option.KVStore.Host, option.KVStore.Port, option.KVStore.Password)
+	kvAddrs := option.KVStore.Addrs
+	if len(kvAddrs) == 0 {
+		kvAddrs = []string{net.JoinHostPort(option.KVStore.Host, strconv.Itoa(option.KVStore.Port))}
+	}
+	rdb, err := driver.NewRedisClient(&driver.RedisConfig{
+		Mode:             option.KVStore.Mode,
+		Addrs:            kvAddrs,
+		MasterName:       option.KVStore.MasterName,
+		Password:         option.KVStore.Password,
+		SentinelPassword: option.KVStore.SentinelPassword,
+		DB:               option.KVStore.DB,
+		PoolSize:         option.KVStore.PoolSize,
+		MinIdleConns:     option.KVStore.MinIdleConns,
+		TLS:              option.KVStore.TLS.Enabled,
+		TLSSkipVerify:    option.KVStore.TLS.SkipVerify,
+		TLSCAFile:        option.KVStore.TLS.CAFile,
+		TLSServerName:    option.KVStore.TLS.ServerName,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create KV connection: %s\n", err)
+	}
+	defer rdb.Close()
 	logger.Debug("Create KV database instance", zap.String("db.driver", "redis"),
-		zap.String("db.host", option.KVStore.Host),
-		zap.Int("db.port", option.KVStore.Port),
+		zap.String("db.mode", option.KVStore.Mode),
+		zap.Strings("db.addrs", kvAddrs),
 	)
 
 	UUIDGenerator := uuid.NewNanoIDGenerator(option.Security.IDLength)
 	UserRepo := user.NewUserRepository(dbConn, UUIDGenerator)
 	UserUserCase := user.NewUserUseCase(UserRepo)
 
-	LessonRepo := lesson.NewLessonRepository(dbConn)
-	LessonUseCase := lesson.NewLessonUseCase(LessonRepo)
+	LeaderboardRepo := leaderboard.NewLeaderboardRepository(dbConn)
+	LeaderboardUseCase := leaderboard.NewLeaderboardUseCase(LeaderboardRepo, rdb, driver.NewLocker(rdb))
+	if option.Leaderboard.RebuildInterval > 0 {
+		go rebuildLeaderboards(LeaderboardUseCase, rdb, option.Leaderboard.RebuildInterval, logger)
+	}
+
+	cacheStore := cache.NewCache(rdb, option.Cache.LocalSize)
+
+	LessonRepo := lesson.NewCachedLessonRepository(lesson.NewLessonRepository(dbConn), cacheStore, cache.Policy{
+		TTL:      option.Cache.LessonProgress.TTL,
+		LocalTTL: option.Cache.LessonProgress.LocalTTL,
+	})
+	LessonUseCase := lesson.NewLessonUseCase(LessonRepo, LeaderboardUseCase)
+
+	TimeSpentRepo := timespent.NewCachedTimeSpentRepository(timespent.NewTimeSpentRepository(dbConn), cacheStore, cache.Policy{
+		TTL:      option.Cache.TimeSpent.TTL,
+		LocalTTL: option.Cache.TimeSpent.LocalTTL,
+	})
+	TimeSpentUseCase := timespent.NewTimeSpentUseCase(TimeSpentRepo, UserUserCase, LeaderboardUseCase)
 
-	TimeSpentRepo := timespent.NewTimeSpentRepository(dbConn)
-	TimeSpentUseCase := timespent.NewTimeSpentUseCase(TimeSpentRepo)
+	ImporterRepo := importer.NewCachedImporterRepository(importer.NewImporterRepository(dbConn), LessonRepo.Progress)
+	ImporterUseCase := importer.NewImporterUseCase(ImporterRepo, validate.NewValidator())
 
-	rest.Serve(dbConn, rdb, option, UserUserCase, UserRepo, LessonUseCase, TimeSpentUseCase, logger)
+	rest.Serve(dbConn, rdb, option, UserUserCase, UserRepo, LessonUseCase, TimeSpentUseCase, LeaderboardUseCase, ImporterUseCase, logger)
+}
+
+// rebuildLeaderboardsMarkKey prefix of the marks of rebuild intervals
+const rebuildLeaderboardsMarkKey = "leaderboard:rebuild_interval:"
+
+// rebuildLeaderboards recompute leaderboards on start and then every interval, by one replica per interval. Intervals
+// are aligned to the clock, the first replica marking one rebuilds and the mark lasts as long as the interval
+func rebuildLeaderboards(LeaderboardUseCase leaderboard.LeaderboardUseCase, kv driver.KeyValueDB, interval time.Duration, logger *zap.Logger) {
+	for {
+		start := time.Now().Truncate(interval)
+		ctx, cancel := context.WithTimeout(logging.SetLoggerInContext(context.Background(), logger), interval)
+		mark := rebuildLeaderboardsMarkKey + strconv.FormatInt(start.Unix(), 10)
+		marked, err := kv.SetNX(ctx, mark, "1", interval)
+		if err == nil && marked {
+			err = LeaderboardUseCase.Rebuild(ctx)
+		}
+		if err == driver.ErrLockNotAcquired || (err == nil && !marked) {
+			logger.Debug("Leaderboards are rebuilt by another replica")
+		} else if err != nil {
+			logger.Error("Failed to rebuild leaderboards", zap.Error(err))
+		} else {
+			logger.Debug("Rebuild leaderboards")
+		}
+		cancel()
+		time.Sleep(time.Until(start.Add(interval)))
+	}
 }
@@ -7,15 +7,30 @@ CREATE TABLE user
     username    VARCHAR(32)                         NULL,
     email       VARCHAR(255)                        NULL,
     password    VARCHAR(64)                         NULL,
-    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
     updated_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL ON UPDATE CURRENT_TIMESTAMP,
     login_retry INT                                 NOT NULL DEFAULT 0,
     last_login  BIGINT                              NOT NULL,
+    locked         BOOLEAN                          NOT NULL DEFAULT FALSE,
+    verified       BOOLEAN                          NOT NULL DEFAULT FALSE,
+    password_reset BOOLEAN                          NOT NULL DEFAULT FALSE,
+    timezone       VARCHAR(64)                      NOT NULL DEFAULT 'UTC',
+    week_start     VARCHAR(8)                       NOT NULL DEFAULT 'monday',
+    leaderboard_opt_out BOOLEAN                     NOT NULL DEFAULT FALSE,
     CONSTRAINT uc_email
         UNIQUE (email),
     CONSTRAINT uc_name
         UNIQUE (username)
 );
+CREATE INDEX idx_user_created_at ON user (created_at, id);
+
+CREATE TABLE user_role
+(
+    user_id VARCHAR(32) NOT NULL,
+    role    VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, role),
+    CONSTRAINT fk_user_role_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
 
 CREATE TABLE lesson_time_spent
 (
@@ -26,24 +41,96 @@ CREATE TABLE lesson_time_spent
     listening  SMALLINT,
     writing    SMALLINT,
     ts         DATE,
+    CONSTRAINT uc_lesson_time_spent UNIQUE (user_id, ts),
     CONSTRAINT fk_lesson_time_spent FOREIGN KEY (user_id) REFERENCES user (id)
 );
+CREATE TABLE time_spent_streak
+(
+    user_id        VARCHAR(32) NOT NULL PRIMARY KEY,
+    current_streak INT         NOT NULL DEFAULT 0,
+    longest_streak INT         NOT NULL DEFAULT 0,
+    last_active    DATE        NULL,
+    CONSTRAINT fk_time_spent_streak_user FOREIGN KEY (user_id) REFERENCES user (id)
+);
+CREATE TABLE time_spent_goal
+(
+    user_id    VARCHAR(32) NOT NULL PRIMARY KEY,
+    vocabulary SMALLINT    NOT NULL DEFAULT 0,
+    grammar    SMALLINT    NOT NULL DEFAULT 0,
+    listening  SMALLINT    NOT NULL DEFAULT 0,
+    writing    SMALLINT    NOT NULL DEFAULT 0,
+    CONSTRAINT fk_time_spent_goal_user FOREIGN KEY (user_id) REFERENCES user (id)
+);
+CREATE TABLE time_spent_session
+(
+    session_id VARCHAR(64) NOT NULL PRIMARY KEY,
+    user_id    VARCHAR(32) NOT NULL,
+    ts         DATE        NOT NULL,
+    created_at DATETIME    NOT NULL,
+    CONSTRAINT fk_time_spent_session_user FOREIGN KEY (user_id) REFERENCES user (id)
+);
+CREATE TABLE course
+(
+    id          BIGINT PRIMARY KEY AUTO_INCREMENT,
+    `index`     SMALLINT      NOT NULL DEFAULT 0,
+    title       VARCHAR(128)  NOT NULL,
+    description VARCHAR(1024) NOT NULL DEFAULT '',
+    status      VARCHAR(16)   NOT NULL DEFAULT 'draft',
+    created_at  DATETIME,
+    updated_at  DATETIME
+);
+CREATE TABLE unit
+(
+    id         BIGINT PRIMARY KEY AUTO_INCREMENT,
+    course_id  BIGINT       NOT NULL,
+    `index`    SMALLINT     NOT NULL DEFAULT 0,
+    title      VARCHAR(128) NOT NULL,
+    status     VARCHAR(16)  NOT NULL DEFAULT 'draft',
+    created_at DATETIME,
+    updated_at DATETIME,
+    CONSTRAINT fk_unit_course FOREIGN KEY (course_id) REFERENCES course (id)
+);
 CREATE TABLE lesson
 (
     id         BIGINT PRIMARY KEY AUTO_INCREMENT,
+    unit_id    BIGINT,
     `index`    SMALLINT,
     `name`     VARCHAR(128),
+    status     VARCHAR(16) NOT NULL DEFAULT 'draft',
     created_at DATETIME,
-    updated_at DATETIME
+    updated_at DATETIME,
+    CONSTRAINT fk_lesson_unit FOREIGN KEY (unit_id) REFERENCES unit (id)
+);
+CREATE TABLE lesson_prerequisite
+(
+    lesson_id       BIGINT NOT NULL,
+    prerequisite_id BIGINT NOT NULL,
+    PRIMARY KEY (lesson_id, prerequisite_id),
+    CONSTRAINT fk_lesson_prerequisite_lesson FOREIGN KEY (lesson_id) REFERENCES lesson (id),
+    CONSTRAINT fk_lesson_prerequisite_prerequisite FOREIGN KEY (prerequisite_id) REFERENCES lesson (id)
 );
 CREATE TABLE lesson_progress
 (
     id         BIGINT PRIMARY KEY AUTO_INCREMENT,
     user_id    VARCHAR(32),
     lesson_id  BIGINT,
-    progress   DECIMAL(5, 4),
-    created_at DATETIME,
-    updated_at DATETIME,
+    progress     DECIMAL(5, 4),
+    completed_at DATETIME NULL,
+    created_at   DATETIME,
+    updated_at   DATETIME,
+    CONSTRAINT uc_lesson_progress UNIQUE (user_id, lesson_id),
     CONSTRAINT fk_lesson_progress_user FOREIGN KEY (user_id) REFERENCES `user` (id),
     CONSTRAINT fk_lesson_progress_lesson FOREIGN KEY (lesson_id) REFERENCES lesson (id)
 );
+CREATE TABLE lesson_progress_history
+(
+    id         BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id    VARCHAR(32)   NOT NULL,
+    lesson_id  BIGINT        NOT NULL,
+    progress   DECIMAL(5, 4) NOT NULL,
+    reset      BOOLEAN       NOT NULL DEFAULT FALSE,
+    created_at DATETIME      NOT NULL,
+    INDEX idx_lesson_progress_history (user_id, lesson_id, created_at),
+    CONSTRAINT fk_lesson_progress_history_user FOREIGN KEY (user_id) REFERENCES `user` (id),
+    CONSTRAINT fk_lesson_progress_history_lesson FOREIGN KEY (lesson_id) REFERENCES lesson (id)
+);
@@ -18,6 +18,7 @@ require (
 	github.com/magiconair/properties v1.8.4 // indirect
 	github.com/matoous/go-nanoid v1.5.0
 	github.com/mattn/go-colorable v0.1.8 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mitchellh/mapstructure v1.4.1 // indirect
 	github.com/pelletier/go-toml v1.8.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
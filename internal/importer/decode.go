@@ -0,0 +1,169 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+)
+
+// rowDecoder read input rows one at a time, io.EOF is returned after the last row
+//
+// errs are problems of the current row only, err aborts the import
+type rowDecoder interface {
+	Next() (row interface{}, errs []*validate.FieldError, err error)
+}
+
+// recordParser build a row from a CSV record, get returns the trimmed value of a column
+type recordParser func(get func(column string) string) (interface{}, []*validate.FieldError)
+
+func newRowDecoder(r io.Reader, format string, newRow func() interface{}, parse recordParser) (rowDecoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvDecoder{r: csv.NewReader(r), parse: parse}, nil
+	case FormatJSON:
+		return &jsonDecoder{d: json.NewDecoder(r), newRow: newRow}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvDecoder struct {
+	r      *csv.Reader
+	parse  recordParser
+	header map[string]int
+}
+
+func (cd *csvDecoder) Next() (interface{}, []*validate.FieldError, error) {
+	if cd.header == nil {
+		header, err := cd.r.Read()
+		if err == io.EOF {
+			return nil, nil, err
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrMalformedInput, err.Error())
+		}
+		cd.header = make(map[string]int, len(header))
+		for i, name := range header {
+			cd.header[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+	}
+
+	record, err := cd.r.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) && errors.Is(perr.Err, csv.ErrFieldCount) {
+			return nil, []*validate.FieldError{validate.NewFieldError("row",
+				fmt.Sprintf("row has %d fields, expected %d", len(record), len(cd.header)))}, nil
+		}
+		if err == io.EOF {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%w: %s", ErrMalformedInput, err.Error())
+	}
+	row, errs := cd.parse(func(column string) string {
+		if i, ok := cd.header[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	})
+	return row, errs, nil
+}
+
+type jsonDecoder struct {
+	d       *json.Decoder
+	newRow  func() interface{}
+	started bool
+}
+
+func (jd *jsonDecoder) Next() (interface{}, []*validate.FieldError, error) {
+	if !jd.started {
+		jd.started = true
+		if t, err := jd.d.Token(); err == io.EOF {
+			return nil, nil, err
+		} else if err != nil || t != json.Delim('[') {
+			return nil, nil, fmt.Errorf("%w: input must be an array of rows", ErrMalformedInput)
+		}
+	}
+	if !jd.d.More() {
+		if _, err := jd.d.Token(); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrMalformedInput, err.Error())
+		}
+		return nil, nil, io.EOF
+	}
+
+	row := jd.newRow()
+	if err := jd.d.Decode(row); err != nil {
+		var terr *json.UnmarshalTypeError
+		if errors.As(err, &terr) {
+			return nil, []*validate.FieldError{validate.NewFieldError(terr.Field,
+				fmt.Sprintf("%s can not be a %s", terr.Field, terr.Value))}, nil
+		}
+		var perr *time.ParseError
+		if errors.As(err, &perr) {
+			return nil, []*validate.FieldError{validate.NewFieldError("row", "times must be in RFC3339 layout")}, nil
+		}
+		return nil, nil, fmt.Errorf("%w: %s", ErrMalformedInput, err.Error())
+	}
+	return row, nil, nil
+}
+
+func parseLessonRecord(get func(string) string) (interface{}, []*validate.FieldError) {
+	var errs []*validate.FieldError
+	row := &LessonRowModel{
+		Title:  get("title"),
+		Status: get("status"),
+	}
+	row.UnitID, errs = parseIntColumn(get, "unit_id", errs)
+	index, errs := parseIntColumn(get, "index", errs)
+	row.Index = int(index)
+	return row, errs
+}
+
+func parseProgressRecord(get func(string) string) (interface{}, []*validate.FieldError) {
+	var errs []*validate.FieldError
+	row := &ProgressRowModel{Email: get("email")}
+	row.LessonID, errs = parseIntColumn(get, "lesson_id", errs)
+	if v := get("progress"); v != "" {
+		if p, err := strconv.ParseFloat(v, 32); err != nil {
+			errs = append(errs, validate.NewFieldError("progress", "progress must be a number"))
+		} else {
+			progress := float32(p)
+			row.Progress = &progress
+		}
+	}
+	row.CompletedAt, errs = parseTimeColumn(get, "completed_at", errs)
+	row.UpdatedAt, errs = parseTimeColumn(get, "updated_at", errs)
+	return row, errs
+}
+
+// parseIntColumn empty value is parsed as 0
+func parseIntColumn(get func(string) string, column string, errs []*validate.FieldError) (int64, []*validate.FieldError) {
+	v := get(column)
+	if v == "" {
+		return 0, errs
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, append(errs, validate.NewFieldError(column, fmt.Sprintf("%s must be an integer", column)))
+	}
+	return n, errs
+}
+
+// parseTimeColumn empty value is parsed as nil
+func parseTimeColumn(get func(string) string, column string, errs []*validate.FieldError) (*time.Time, []*validate.FieldError) {
+	v := get(column)
+	if v == "" {
+		return nil, errs
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, append(errs, validate.NewFieldError(column, fmt.Sprintf("%s must be in RFC3339 layout", column)))
+	}
+	return &t, errs
+}
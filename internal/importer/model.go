@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+)
+
+// input formats
+const (
+	FormatCSV  = "csv"  // first record is the header, columns are matched by the json names of row fields
+	FormatJSON = "json" // array of row objects
+)
+
+// DefaultBatchSize rows written in one transaction
+const DefaultBatchSize = 500
+
+// MaxReportedErrors failed rows beyond are counted but not reported
+const MaxReportedErrors = 1000
+
+// LessonRowModel lesson to be created
+type LessonRowModel struct {
+	UnitID int64  `json:"unit_id" validate:"required,min=1"`
+	Index  int    `json:"index" validate:"min=0,max=32767"`
+	Title  string `json:"title" validate:"required,max=128"`
+	Status string `json:"status" validate:"required,oneof=draft published"`
+}
+
+// ProgressRowModel lesson progress of a user identified by email, the user must not have progress of the lesson yet
+type ProgressRowModel struct {
+	Email       string     `json:"email" validate:"required,email"`
+	LessonID    int64      `json:"lesson_id" validate:"required,min=1"`
+	Progress    *float32   `json:"progress" validate:"required,min=0,max=1"`
+	CompletedAt *time.Time `json:"completed_at"` // set to updated_at if progress is 1 and it's absent
+	UpdatedAt   *time.Time `json:"updated_at"`   // import time is used if it's absent
+	UserID      string     `json:"-"`
+}
+
+// RowErrorModel errors of an input row
+type RowErrorModel struct {
+	Row    int                    `json:"row"` // one-based, the CSV header is not counted
+	Errors []*validate.FieldError `json:"errors"`
+}
+
+// ResultModel summary of an import
+type ResultModel struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"` // rows written, or would be written in a dry run
+	Failed   int              `json:"failed"`
+	Errors   []*RowErrorModel `json:"errors"` // at most MaxReportedErrors
+}
+
+// OptionsModel import options
+type OptionsModel struct {
+	Format    string
+	DryRun    bool // validate only, nothing is written
+	BatchSize int  // DefaultBatchSize is used if it's not positive
+}
+
+var (
+	// ErrUnknownFormat format is not one of the supported formats
+	ErrUnknownFormat = errors.New("Unknown import format")
+	// ErrMalformedInput input can't be parsed at all, the import is aborted
+	ErrMalformedInput = errors.New("Malformed import input")
+	// ErrProgressExists progress of a user and lesson is inserted concurrently since it was checked
+	ErrProgressExists = errors.New("User already has progress of the lesson")
+)
+
+type ImporterRepository interface {
+	ExistingUnits(ctx context.Context, ids []int64) (map[int64]bool, error)
+	ExistingLessons(ctx context.Context, ids []int64) (map[int64]bool, error)
+	// FindUserIDsByEmail map lower cased emails to user IDs
+	FindUserIDsByEmail(ctx context.Context, emails []string) (map[string]string, error)
+	// ExistingProgress keys are built by progressKey
+	ExistingProgress(ctx context.Context, userIDs []string, lessonIDs []int64) (map[string]bool, error)
+	// InsertLessons insert lessons in one transaction
+	InsertLessons(ctx context.Context, rows []*LessonRowModel) error
+	// InsertProgress insert progress along with history entries in one transaction, ErrProgressExists is returned
+	// if any of the rows already exists
+	InsertProgress(ctx context.Context, rows []*ProgressRowModel) error
+}
+
+// ImporterUseCase rows are validated and written in batches, invalid rows are reported and skipped.
+// Batches written before an error stay committed
+type ImporterUseCase interface {
+	ImportLessons(ctx context.Context, r io.Reader, options *OptionsModel) (*ResultModel, error)
+	ImportProgress(ctx context.Context, r io.Reader, options *OptionsModel) (*ResultModel, error)
+}
@@ -0,0 +1,40 @@
+package importer
+
+import (
+	"context"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/cache"
+	"go.elastic.co/apm"
+)
+
+// ImporterCached invalidate cached progress of users in front of an ImporterRepository
+type ImporterCached struct {
+	ImporterRepository
+	Progress *cache.Method
+}
+
+var _ ImporterRepository = &ImporterCached{}
+
+// NewCachedImporterRepository progress is the cached method reading progress of users, keyed by user id
+func NewCachedImporterRepository(repo ImporterRepository, progress *cache.Method) *ImporterCached {
+	return &ImporterCached{repo, progress}
+}
+
+func (repo *ImporterCached) InsertProgress(ctx context.Context, progress []*ProgressRowModel) error {
+	if err := repo.ImporterRepository.InsertProgress(ctx, progress); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0, len(progress))
+	for _, p := range progress {
+		if !seen[p.UserID] {
+			seen[p.UserID] = true
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	// the progress is already saved, stale values expire with the policy
+	if err := repo.Progress.Invalidate(ctx, userIDs...); err != nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	return nil
+}
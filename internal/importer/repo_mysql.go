@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+type ImporterMySQL struct {
+	Conn driver.ITransactionalDB `dep:""`
+}
+
+var _ ImporterRepository = &ImporterMySQL{}
+
+func NewImporterRepository(Conn driver.ITransactionalDB) *ImporterMySQL {
+	return &ImporterMySQL{
+		Conn: Conn,
+	}
+}
+
+func (repo *ImporterMySQL) ExistingUnits(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return repo.existingIDs(ctx, "unit", ids)
+}
+
+func (repo *ImporterMySQL) ExistingLessons(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return repo.existingIDs(ctx, "lesson", ids)
+}
+
+func (repo *ImporterMySQL) FindUserIDsByEmail(ctx context.Context, emails []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(emails) == 0 {
+		return result, nil
+	}
+	args := make([]interface{}, len(emails))
+	for i, e := range emails {
+		args[i] = strings.ToLower(e)
+	}
+	// compared lower cased on both sides, PostgreSQL compares text case sensitively
+	rows, err := repo.Conn.QueryContext(ctx, `SELECT id, email FROM "user" WHERE LOWER(email) IN (`+placeholders(1, len(args))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, err
+		}
+		result[strings.ToLower(email)] = id
+	}
+	return result, rows.Err()
+}
+
+func (repo *ImporterMySQL) ExistingProgress(ctx context.Context, userIDs []string, lessonIDs []int64) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(userIDs) == 0 || len(lessonIDs) == 0 {
+		return result, nil
+	}
+	args := make([]interface{}, 0, len(userIDs)+len(lessonIDs))
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	for _, id := range lessonIDs {
+		args = append(args, id)
+	}
+	rows, err := repo.Conn.QueryContext(ctx, `SELECT user_id, lesson_id FROM lesson_progress
+	WHERE user_id IN (`+placeholders(1, len(userIDs))+`) AND lesson_id IN (`+placeholders(len(userIDs)+1, len(lessonIDs))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userID   string
+			lessonID int64
+		)
+		if err := rows.Scan(&userID, &lessonID); err != nil {
+			return nil, err
+		}
+		result[progressKey(userID, lessonID)] = true
+	}
+	return result, rows.Err()
+}
+
+func (repo *ImporterMySQL) InsertLessons(ctx context.Context, lessons []*LessonRowModel) error {
+	now := time.Now()
+	rows := make([][]interface{}, len(lessons))
+	for i, l := range lessons {
+		rows[i] = []interface{}{l.UnitID, l.Index, l.Title, l.Status, now, now}
+	}
+	return repo.withTx(ctx, func(tx driver.ITransactionalDB) error {
+		_, err := tx.BulkInsert(ctx, "lesson", []string{"unit_id", "index", "name", "status", "created_at", "updated_at"},
+			driver.CopyFromRows(rows))
+		return err
+	})
+}
+
+func (repo *ImporterMySQL) InsertProgress(ctx context.Context, progress []*ProgressRowModel) error {
+	now := time.Now()
+	rows := make([][]interface{}, len(progress))
+	history := make([][]interface{}, len(progress))
+	for i, p := range progress {
+		rows[i] = []interface{}{p.UserID, p.LessonID, *p.Progress, p.CompletedAt, now, *p.UpdatedAt}
+		history[i] = []interface{}{p.UserID, p.LessonID, *p.Progress, false, *p.UpdatedAt}
+	}
+	err := repo.withTx(ctx, func(tx driver.ITransactionalDB) error {
+		if _, err := tx.BulkInsert(ctx, "lesson_progress",
+			[]string{"user_id", "lesson_id", "progress", "completed_at", "created_at", "updated_at"}, driver.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		_, err := tx.BulkInsert(ctx, "lesson_progress_history",
+			[]string{"user_id", "lesson_id", "progress", "reset", "created_at"}, driver.CopyFromRows(history))
+		return err
+	})
+	if errors.Is(err, driver.ErrUniqueViolation) {
+		return ErrProgressExists
+	}
+	return err
+}
+
+func (repo *ImporterMySQL) existingIDs(ctx context.Context, table string, ids []int64) (map[int64]bool, error) {
+	result := make(map[int64]bool)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := repo.Conn.QueryContext(ctx, `SELECT id FROM "`+table+`" WHERE id IN (`+placeholders(1, len(args))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		result[id] = true
+	}
+	return result, rows.Err()
+}
+
+func (repo *ImporterMySQL) withTx(ctx context.Context, fn func(tx driver.ITransactionalDB) error) (err error) {
+	tx, err := repo.Conn.BeginTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelReadCommitted,
+		AccessMode: driver.AccessReadWrite,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	err = fn(tx)
+	return
+}
+
+// placeholders $start, $start+1, ... for n values
+func placeholders(start, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = fmt.Sprintf("$%d", start+i)
+	}
+	return strings.Join(ps, ", ")
+}
@@ -0,0 +1,260 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"go.elastic.co/apm"
+)
+
+// ImporterUseCaseImpl ...
+type ImporterUseCaseImpl struct {
+	ImporterRepository ImporterRepository
+	Validator          validate.Validator
+}
+
+var _ ImporterUseCase = &ImporterUseCaseImpl{}
+
+// NewImporterUseCase ...
+func NewImporterUseCase(
+	ImporterRepository ImporterRepository,
+	Validator validate.Validator,
+) *ImporterUseCaseImpl {
+	return &ImporterUseCaseImpl{ImporterRepository, Validator}
+}
+
+// pendingRow decoded row waiting to be written
+type pendingRow struct {
+	line int
+	row  interface{}
+	errs []*validate.FieldError
+}
+
+// batchWriter check references of a batch, appending errors to failed rows, and write the valid ones
+type batchWriter func(ctx context.Context, batch []*pendingRow, dryRun bool) error
+
+// ImportLessons the referenced units must exist
+func (iu *ImporterUseCaseImpl) ImportLessons(ctx context.Context, r io.Reader, options *OptionsModel) (*ResultModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "ImporterUseCaseImpl.ImportLessons", "service")
+	defer apmSpan.End()
+
+	dec, err := newRowDecoder(r, options.Format, func() interface{} { return new(LessonRowModel) }, parseLessonRecord)
+	if err != nil {
+		return nil, err
+	}
+	ir := iu.ImporterRepository
+	return iu.run(ctx, dec, options, func(ctx context.Context, batch []*pendingRow, dryRun bool) error {
+		var ids []int64
+		for _, p := range valid(batch) {
+			ids = append(ids, p.row.(*LessonRowModel).UnitID)
+		}
+		units, err := ir.ExistingUnits(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		var rows []*LessonRowModel
+		for _, p := range valid(batch) {
+			row := p.row.(*LessonRowModel)
+			if !units[row.UnitID] {
+				p.errs = append(p.errs, validate.NewFieldError("unit_id", "unit does not exist"))
+				continue
+			}
+			rows = append(rows, row)
+		}
+		if dryRun || len(rows) == 0 {
+			return nil
+		}
+		return ir.InsertLessons(ctx, rows)
+	})
+}
+
+// ImportProgress users are matched by email and the referenced lessons must exist. A user can only
+// have one progress of a lesson, so rows of existing progress and repeated rows in the input are rejected
+//
+// leaderboards pick up imported completions on the next rebuild
+func (iu *ImporterUseCaseImpl) ImportProgress(ctx context.Context, r io.Reader, options *OptionsModel) (*ResultModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "ImporterUseCaseImpl.ImportProgress", "service")
+	defer apmSpan.End()
+
+	dec, err := newRowDecoder(r, options.Format, func() interface{} { return new(ProgressRowModel) }, parseProgressRecord)
+	if err != nil {
+		return nil, err
+	}
+	ir := iu.ImporterRepository
+	seen := make(map[string]bool)
+	now := time.Now()
+	return iu.run(ctx, dec, options, func(ctx context.Context, batch []*pendingRow, dryRun bool) error {
+		var (
+			emails    []string
+			lessonIDs []int64
+		)
+		for _, p := range valid(batch) {
+			row := p.row.(*ProgressRowModel)
+			emails = append(emails, strings.ToLower(row.Email))
+			lessonIDs = append(lessonIDs, row.LessonID)
+		}
+		users, err := ir.FindUserIDsByEmail(ctx, emails)
+		if err != nil {
+			return err
+		}
+		lessons, err := ir.ExistingLessons(ctx, lessonIDs)
+		if err != nil {
+			return err
+		}
+		var userIDs []string
+		for _, id := range users {
+			userIDs = append(userIDs, id)
+		}
+		existing, err := ir.ExistingProgress(ctx, userIDs, lessonIDs)
+		if err != nil {
+			return err
+		}
+
+		var (
+			rows    []*ProgressRowModel
+			pending []*pendingRow
+		)
+		for _, p := range valid(batch) {
+			row := p.row.(*ProgressRowModel)
+			row.UserID = users[strings.ToLower(row.Email)]
+			if row.UserID == "" {
+				p.errs = append(p.errs, validate.NewFieldError("email", "user does not exist"))
+			}
+			if !lessons[row.LessonID] {
+				p.errs = append(p.errs, validate.NewFieldError("lesson_id", "lesson does not exist"))
+			}
+			if len(p.errs) > 0 {
+				continue
+			}
+			key := progressKey(row.UserID, row.LessonID)
+			if existing[key] {
+				p.errs = append(p.errs, validate.NewFieldError("lesson_id", "user already has progress of the lesson"))
+				continue
+			}
+			if seen[key] {
+				p.errs = append(p.errs, validate.NewFieldError("lesson_id", "progress of the lesson is repeated in the input"))
+				continue
+			}
+			seen[key] = true
+
+			if row.UpdatedAt == nil {
+				row.UpdatedAt = &now
+			}
+			if *row.Progress >= 1 {
+				if row.CompletedAt == nil {
+					row.CompletedAt = row.UpdatedAt
+				}
+			} else {
+				row.CompletedAt = nil
+			}
+			rows = append(rows, row)
+			pending = append(pending, p)
+		}
+		if dryRun || len(rows) == 0 {
+			return nil
+		}
+		err = ir.InsertProgress(ctx, rows)
+		if err != ErrProgressExists {
+			return err
+		}
+		// progress is inserted concurrently since the check, find the conflicting rows one by one
+		for i := range rows {
+			err := ir.InsertProgress(ctx, rows[i:i+1])
+			if err == ErrProgressExists {
+				pending[i].errs = append(pending[i].errs, validate.NewFieldError("lesson_id", "user already has progress of the lesson"))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (iu *ImporterUseCaseImpl) run(ctx context.Context, dec rowDecoder, options *OptionsModel, write batchWriter) (*ResultModel, error) {
+	size := options.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	result := &ResultModel{DryRun: options.DryRun, Errors: []*RowErrorModel{}}
+	batch := make([]*pendingRow, 0, size)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := write(ctx, batch, options.DryRun); err != nil {
+			return fmt.Errorf("failed to import rows %d-%d: %w", batch[0].line, batch[len(batch)-1].line, err)
+		}
+		for _, p := range batch {
+			result.Total++
+			if len(p.errs) == 0 {
+				result.Imported++
+				continue
+			}
+			result.Failed++
+			if len(result.Errors) < MaxReportedErrors {
+				result.Errors = append(result.Errors, &RowErrorModel{p.line, p.errs})
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for line := 1; ; line++ {
+		row, errs, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			errs = mergeErrors(errs, iu.Validator.Struct(row))
+		}
+		batch = append(batch, &pendingRow{line, row, errs})
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// valid rows without errors so far
+func valid(batch []*pendingRow) []*pendingRow {
+	var result []*pendingRow
+	for _, p := range batch {
+		if len(p.errs) == 0 {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// mergeErrors append validation errors of fields that don't have a parse error
+func mergeErrors(parsed, validated []*validate.FieldError) []*validate.FieldError {
+	for _, v := range validated {
+		reported := false
+		for _, p := range parsed {
+			reported = reported || p.Domain == v.Domain
+		}
+		if !reported {
+			parsed = append(parsed, v)
+		}
+	}
+	return parsed
+}
+
+func progressKey(userID string, lessonID int64) string {
+	return fmt.Sprintf("%s:%d", userID, lessonID)
+}
@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestImportProgressConcurrentInsert(t *testing.T) {
+	ctx := logging.SetLoggerInContext(context.Background(), zaptest.NewLogger(t))
+	input := `[
+		{"email": "a@example.com", "lesson_id": 1, "progress": 0.5},
+		{"email": "b@example.com", "lesson_id": 1, "progress": 1}
+	]`
+	uniqueViolation := &driver.Error{Kind: driver.ErrUniqueViolation, Err: driver.ErrUniqueViolation}
+
+	db := drivertest.NewFakeDB()
+	db.ExpectQuery(`FROM "user" WHERE LOWER\(email\) IN`).
+		WillReturnRows(drivertest.NewRows("id", "email").AddRow("a", "a@example.com").AddRow("b", "b@example.com"))
+	db.ExpectQuery(`FROM "lesson" WHERE id IN`).WillReturnRows(drivertest.NewRows("id").AddRow(1))
+	db.ExpectQuery(`FROM lesson_progress`)
+	// progress of b is inserted after the check
+	db.ExpectBegin()
+	db.ExpectBulkInsert("lesson_progress").WillReturnError(uniqueViolation)
+	db.ExpectRollback()
+	db.ExpectBegin()
+	db.ExpectBulkInsert("lesson_progress")
+	db.ExpectBulkInsert("lesson_progress_history")
+	db.ExpectCommit()
+	db.ExpectBegin()
+	db.ExpectBulkInsert("lesson_progress").WillReturnError(uniqueViolation)
+	db.ExpectRollback()
+
+	uc := NewImporterUseCase(NewImporterRepository(db), validate.NewValidator())
+	result, err := uc.ImportProgress(ctx, strings.NewReader(input), &OptionsModel{Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("ImportProgress() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Failed != 1 || len(result.Errors) != 1 || result.Errors[0].Row != 2 {
+		t.Fatalf("Expected row 2 to be rejected, got %+v", result)
+	}
+}
@@ -10,9 +10,10 @@ import (
 
 // AppTokenClaims .
 type AppTokenClaims struct {
-	UID   string `json:"uid"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	UID   string   `json:"uid"`
+	Email string   `json:"email"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles,omitempty"`
 
 	jwt.StandardClaims
 }
@@ -28,6 +29,16 @@ func (tk *AppTokenClaims) TimeRemaining() time.Duration {
 	return exp.Sub(now)
 }
 
+// HasRole check if role is granted to the token owner
+func (tk *AppTokenClaims) HasRole(role string) bool {
+	for _, r := range tk.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // JWTUtil .
 type JWTUtil struct {
 	secret    []byte
@@ -76,12 +87,13 @@ func (ju *JWTUtil) Validate(tokenStr string) (*AppTokenClaims, error) {
 }
 
 // GenerateTokenStr generate user token from user model
-func (ju *JWTUtil) GenerateTokenStr(id, email, username string) (string, error) {
+func (ju *JWTUtil) GenerateTokenStr(id, email, username string, roles []string) (string, error) {
 	expires := time.Now().Add(ju.timeout).Unix()
 	return ju.Sign(&AppTokenClaims{
 		UID:   id,
 		Email: email,
 		Name:  username,
+		Roles: roles,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expires,
 		},
@@ -0,0 +1,298 @@
+// Package cache cache-aside reads of repositories and use cases, backed by KeyValueDB with an optional in-process LRU tier
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"expvar"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+// stats hit/miss counters of each method, named <method>.<counter>
+var stats = expvar.NewMap("cache")
+
+// Codec serialization of cached values
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// GobCodec encode values with encoding/gob, unlike JSON it keeps fields hidden from API responses
+type GobCodec struct{}
+
+// Marshal implement Codec
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implement Codec
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Cache storage shared by cached methods
+type Cache struct {
+	KV    driver.KeyValueDB
+	Codec Codec
+	local *lru // nil if the in-process tier is disabled
+	calls group
+}
+
+// NewCache create a Cache on kv, localSize is the number of keys kept in process, 0 to disable the in-process tier
+func NewCache(kv driver.KeyValueDB, localSize int) *Cache {
+	c := &Cache{KV: kv, Codec: GobCodec{}}
+	if localSize > 0 {
+		c.local = newLRU(localSize)
+	}
+	return c
+}
+
+// Policy caching policy of a method
+type Policy struct {
+	// TTL lifetime of values in KeyValueDB, 0 to disable caching
+	TTL time.Duration
+	// LocalTTL lifetime of values in process, 0 to skip the in-process tier. Invalidations of this tier
+	// don't reach other processes, so it should be short
+	LocalTTL time.Duration
+}
+
+// Method cached reads of a method. Values are stored by key and field, all fields of a key are invalidated
+// together, e.g. key is a user and field is the arguments of a read
+type Method struct {
+	cache  *Cache
+	name   string
+	policy Policy
+
+	mu          sync.Mutex
+	invalidated uint64 // invalidations made by this process, values loaded before one aren't kept in process
+}
+
+// Method create a Method, name is the namespace of its keys and the prefix of its metrics
+func (c *Cache) Method(name string, policy Policy) *Method {
+	return &Method{cache: c, name: name, policy: policy}
+}
+
+// assign store v in dst like decoding its encoded form would, without the round trip
+func assign(dst, v interface{}) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("Cache destination must be a non-nil pointer, got %T", dst)
+	}
+	value := reflect.ValueOf(v)
+	if !value.IsValid() {
+		return fmt.Errorf("Cache load returned nil for %s", target.Elem().Type())
+	}
+	if !value.Type().AssignableTo(target.Elem().Type()) {
+		return fmt.Errorf("Cache load returned %s, not assignable to %s", value.Type(), target.Elem().Type())
+	}
+	target.Elem().Set(value)
+	return nil
+}
+
+// result outcome of a lookup shared by concurrent callers
+type result struct {
+	data []byte
+	hit  bool
+}
+
+// Get decode the value of field of key into dst(a pointer to the type returned by load), load is called
+// on a miss and its result is cached. Concurrent misses of the same field share one load, which keeps running
+// while any of them waits for it. Failures of KeyValueDB are counted as errors and served from load
+func (m *Method) Get(ctx context.Context, key, field string, dst interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	if m.policy.TTL <= 0 {
+		v, err := load(ctx)
+		if err != nil {
+			return err
+		}
+		return assign(dst, v)
+	}
+
+	c := m.cache
+	useLocal := c.local != nil && m.policy.LocalTTL > 0
+	if useLocal {
+		if data, ok := c.local.get(m.kvKey(key), field); ok {
+			stats.Add(m.name+".local_hits", 1)
+			return c.Codec.Unmarshal(data, dst)
+		}
+	}
+
+	// read before the generations, invalidations change it after them, so values loaded under a previous
+	// generation aren't kept in process
+	m.mu.Lock()
+	invalidated := m.invalidated
+	m.mu.Unlock()
+	version, err := m.version(ctx, key)
+	if err != nil {
+		stats.Add(m.name+".errors", 1)
+	}
+
+	call := m.kvKey(key) + "\x00" + version + "\x00" + strconv.FormatUint(invalidated, 10) + "\x00" + field
+	v, err := c.calls.do(ctx, call, func(ctx context.Context) (interface{}, error) {
+		return m.lookup(ctx, key, version, field, load)
+	})
+	if err != nil {
+		return err
+	}
+	r := v.(*result)
+	if r.hit {
+		stats.Add(m.name+".hits", 1)
+	} else {
+		stats.Add(m.name+".misses", 1)
+	}
+	if useLocal {
+		m.mu.Lock()
+		if m.invalidated == invalidated {
+			c.local.set(m.kvKey(key), field, r.data, time.Now().Add(m.policy.LocalTTL))
+		}
+		m.mu.Unlock()
+	}
+	return c.Codec.Unmarshal(r.data, dst)
+}
+
+// lookup read field of version from KeyValueDB, or load and store it. Without version, load is only called
+func (m *Method) lookup(ctx context.Context, key, version, field string, load func(ctx context.Context) (interface{}, error)) (*result, error) {
+	c := m.cache
+	if version != "" {
+		s, err := c.KV.HGet(ctx, m.dataKey(key, version), field)
+		if err == nil {
+			if data, ok := decodeEntry(s); ok {
+				return &result{data: data, hit: true}, nil
+			}
+		} else if err != driver.ErrNotFound {
+			stats.Add(m.name+".errors", 1)
+		}
+	}
+
+	v, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return &result{data: data}, nil
+	}
+	// the hash lives as long as its latest field, expiration of each field is checked on read. If key is
+	// invalidated meanwhile, the value is stored under a previous version nobody reads anymore
+	dataKey := m.dataKey(key, version)
+	if err := c.KV.HSet(ctx, dataKey, map[string]string{field: encodeEntry(data, m.policy.TTL)}); err != nil {
+		stats.Add(m.name+".errors", 1)
+	} else if err := c.KV.Expire(ctx, dataKey, m.policy.TTL); err != nil {
+		stats.Add(m.name+".errors", 1)
+	}
+	return &result{data: data}, nil
+}
+
+// Invalidate drop all fields of keys, call it after writes affecting them are committed
+func (m *Method) Invalidate(ctx context.Context, keys ...string) error {
+	if m.policy.TTL <= 0 || len(keys) == 0 {
+		return nil
+	}
+	var err error
+	for _, key := range keys {
+		if err = m.bump(ctx, m.genKey(key)); err != nil {
+			break
+		}
+	}
+	m.mu.Lock()
+	m.invalidated++
+	if m.cache.local != nil {
+		for _, key := range keys {
+			m.cache.local.remove(m.kvKey(key))
+		}
+	}
+	m.mu.Unlock()
+	return err
+}
+
+// InvalidateAll drop all keys, call it after writes affecting every key are committed
+func (m *Method) InvalidateAll(ctx context.Context) error {
+	if m.policy.TTL <= 0 {
+		return nil
+	}
+	err := m.bump(ctx, m.methodGenKey())
+	m.mu.Lock()
+	m.invalidated++
+	if m.cache.local != nil {
+		m.cache.local.removePrefix(m.kvKey(""))
+	}
+	m.mu.Unlock()
+	return err
+}
+
+// version generations of all keys and of key, values are stored under it and are left behind by invalidations
+func (m *Method) version(ctx context.Context, key string) (string, error) {
+	all, one := m.methodGenKey(), m.genKey(key)
+	gens, err := m.cache.KV.MGet(ctx, all, one)
+	if err != nil {
+		return "", err
+	}
+	return generation(gens[all]) + "." + generation(gens[one]), nil
+}
+
+// bump increment a generation. It lives twice as long as values, so it outlives those stored under previous
+// generations by loads in flight, the generation starts over once they're gone
+func (m *Method) bump(ctx context.Context, genKey string) error {
+	ttl := 2 * m.policy.TTL
+	if _, err := m.cache.KV.IncrBy(ctx, genKey, 1, ttl); err != nil {
+		return err
+	}
+	return m.cache.KV.Expire(ctx, genKey, ttl)
+}
+
+// generation missing ones are 0
+func generation(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+func (m *Method) kvKey(key string) string {
+	return "cache:" + m.name + ":" + key
+}
+
+func (m *Method) dataKey(key, version string) string {
+	return m.kvKey(key) + "@" + version
+}
+
+func (m *Method) genKey(key string) string {
+	return m.methodGenKey() + ":" + key
+}
+
+func (m *Method) methodGenKey() string {
+	return "cache_gen:" + m.name
+}
+
+// encodeEntry prefix data with its expiration time in unix milliseconds
+func encodeEntry(data []byte, ttl time.Duration) string {
+	exp := time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	return strconv.FormatInt(exp, 10) + ":" + string(data)
+}
+
+// decodeEntry data of an entry, false if it's expired or malformed
+func decodeEntry(s string) ([]byte, bool) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, false
+	}
+	exp, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || time.Now().UnixNano()/int64(time.Millisecond) >= exp {
+		return nil, false
+	}
+	return []byte(s[i+1:]), true
+}
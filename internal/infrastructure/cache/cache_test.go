@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+)
+
+var testPolicy = Policy{TTL: time.Minute, LocalTTL: time.Minute}
+
+func newTestMethod(localSize int) *Method {
+	return NewCache(drivertest.NewMemoryKV(nil), localSize).Method("test", testPolicy)
+}
+
+// counter load returning the number of calls
+func counter() func(ctx context.Context) (interface{}, error) {
+	n := 0
+	return func(ctx context.Context) (interface{}, error) {
+		n++
+		return n, nil
+	}
+}
+
+func get(t *testing.T, m *Method, key string, load func(ctx context.Context) (interface{}, error)) int {
+	t.Helper()
+	var v int
+	if err := m.Get(context.Background(), key, "", &v, load); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return v
+}
+
+func TestMethodInvalidate(t *testing.T) {
+	ctx := context.Background()
+	for _, localSize := range []int{0, 10} {
+		m := newTestMethod(localSize)
+		alice, bob := counter(), counter()
+
+		get(t, m, "alice", alice)
+		get(t, m, "bob", bob)
+		if v := get(t, m, "alice", alice); v != 1 {
+			t.Fatalf("Get() = %d, want the cached 1", v)
+		}
+		if err := m.Invalidate(ctx, "alice"); err != nil {
+			t.Fatalf("Invalidate() error = %v", err)
+		}
+		if v := get(t, m, "alice", alice); v != 2 {
+			t.Fatalf("Get() = %d after Invalidate, want 2", v)
+		}
+		if v := get(t, m, "bob", bob); v != 1 {
+			t.Fatalf("Get() = %d of another key, want the cached 1", v)
+		}
+
+		if err := m.InvalidateAll(ctx); err != nil {
+			t.Fatalf("InvalidateAll() error = %v", err)
+		}
+		if v := get(t, m, "alice", alice); v != 3 {
+			t.Fatalf("Get() = %d after InvalidateAll, want 3", v)
+		}
+		if v := get(t, m, "bob", bob); v != 2 {
+			t.Fatalf("Get() = %d after InvalidateAll, want 2", v)
+		}
+	}
+}
+
+func TestMethodInvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	for _, localSize := range []int{0, 10} {
+		m := newTestMethod(localSize)
+		loading, release := make(chan struct{}), make(chan struct{})
+		stale := func(ctx context.Context) (interface{}, error) {
+			close(loading)
+			<-release
+			return 1, nil
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var v int
+			m.Get(ctx, "alice", "", &v, stale)
+		}()
+		<-loading
+		// written while the first load read the previous value
+		if err := m.Invalidate(ctx, "alice"); err != nil {
+			t.Fatalf("Invalidate() error = %v", err)
+		}
+		// later callers don't share the load in flight
+		if v := get(t, m, "alice", func(ctx context.Context) (interface{}, error) { return 2, nil }); v != 2 {
+			t.Fatalf("Get() = %d during the stale load, want 2", v)
+		}
+		close(release)
+		<-done
+
+		if v := get(t, m, "alice", counter()); v != 2 {
+			t.Fatalf("Get() = %d, the stale load replaced the fresh value", v)
+		}
+	}
+}
+
+func TestMethodSharedLoad(t *testing.T) {
+	m := newTestMethod(0)
+	loading, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		close(loading)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		var v int
+		firstErr <- m.Get(first, "alice", "", &v, load)
+	}()
+	<-loading
+
+	second := make(chan int)
+	go func() {
+		var v int
+		if err := m.Get(context.Background(), "alice", "", &v, load); err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+		second <- v
+	}()
+	// wait until the second caller joins the load
+	for {
+		m.cache.calls.mu.Lock()
+		waiters := 0
+		for _, c := range m.cache.calls.calls {
+			waiters = c.waiters
+		}
+		m.cache.calls.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the caller starting the load leaves without failing the other one
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Fatalf("Get() error = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if v := <-second; v != 1 {
+		t.Fatalf("Get() = %d, want 1", v)
+	}
+}
+
+func TestMethodAbandonedLoad(t *testing.T) {
+	m := newTestMethod(0)
+	canceled := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var v int
+	if err := m.Get(ctx, "alice", "", &v, load); err != context.DeadlineExceeded {
+		t.Fatalf("Get() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Load wasn't canceled once no caller was left")
+	}
+}
+
+func TestMethodGetUncached(t *testing.T) {
+	ctx := context.Background()
+	m := NewCache(drivertest.NewMemoryKV(nil), 0).Method("test", Policy{})
+
+	if v := get(t, m, "alice", counter()); v != 1 {
+		t.Fatalf("Get() = %d, want 1", v)
+	}
+	loads := []func(ctx context.Context) (interface{}, error){
+		func(ctx context.Context) (interface{}, error) { return nil, nil },
+		func(ctx context.Context) (interface{}, error) { return "one", nil },
+	}
+	for _, load := range loads {
+		var v int
+		if err := m.Get(ctx, "alice", "", &v, load); err == nil {
+			t.Fatal("Get() error = nil for a value of another type")
+		}
+	}
+	var v int
+	if err := m.Get(ctx, "alice", "", v, counter()); err == nil {
+		t.Fatal("Get() error = nil for a destination that isn't a pointer")
+	}
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lru in-process tier, keys are evicted as a whole when there are more than size keys
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	fields map[string]*lruValue
+}
+
+type lruValue struct {
+	data     []byte
+	expireAt time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(key, field string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	v, ok := e.fields[field]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(v.expireAt) {
+		delete(e.fields, field)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return v.data, true
+}
+
+func (l *lru) set(key, field string, data []byte, expireAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if ok {
+		l.order.MoveToFront(el)
+	} else {
+		el = l.order.PushFront(&lruEntry{key: key, fields: make(map[string]*lruValue)})
+		l.entries[key] = el
+		if l.order.Len() > l.size {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.entries, oldest.Value.(*lruEntry).key)
+		}
+	}
+	el.Value.(*lruEntry).fields[field] = &lruValue{data: data, expireAt: expireAt}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		l.order.Remove(el)
+		delete(l.entries, key)
+	}
+}
+
+func (l *lru) removePrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, el := range l.entries {
+		if strings.HasPrefix(key, prefix) {
+			l.order.Remove(el)
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// group collapse concurrent calls of the same key into one, so a miss of a popular key loads it once
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	val     interface{}
+	err     error
+	panic   interface{}
+}
+
+// do run fn unless a call of key is in flight, in which case its result is returned. fn runs on a context
+// with the values of ctx but not its cancellation, so the caller starting it can't fail the others by leaving.
+// Each caller returns once its own ctx is done, fn is canceled when no caller is left waiting for it
+func (g *group) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		fnCtx, cancel := context.WithCancel(detach(ctx))
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(fnCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.panic != nil {
+			panic(c.panic)
+		}
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		// raised in the callers, where it's recovered like any panic of a request
+		c.panic = recover()
+		g.mu.Lock()
+		g.forget(key, c)
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.val, c.err = fn(ctx)
+}
+
+// forget remove c unless it's already replaced by a later call, g.mu must be held
+func (g *group) forget(key string, c *call) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// detachedContext values of a context without its deadline and cancellation, like the logger and the APM transaction
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -39,6 +39,15 @@ type AppConfig struct {
 		Query    string `mapstructure:"query" json:"query" yaml:"query"`                                             // DSN query parameter
 		Schema   string `mapstructure:"schema" json:"schema" yaml:"schema" validate:"required"`                      // use schema
 		User     string `mapstructure:"username" json:"username" yaml:"username" validate:"required"`                // db username
+		// transactions failed with deadlocks or serialization failures are retried
+		TxMaxAttempts   int           `mapstructure:"tx_max_attempts" json:"tx_max_attempts" yaml:"tx_max_attempts" validate:"min=1"` // attempts including the first one
+		TxRetryDelay    time.Duration `mapstructure:"tx_retry_delay" json:"tx_retry_delay" yaml:"tx_retry_delay"`                     // backoff before the first retry
+		TxMaxRetryDelay time.Duration `mapstructure:"tx_max_retry_delay" json:"tx_max_retry_delay" yaml:"tx_max_retry_delay"`         // upper bound of backoff
+		// reads outside of transactions are sent to healthy replicas
+		Replicas             []string      `mapstructure:"replicas" json:"replicas" yaml:"replicas"`                                           // replica addresses(host:port)
+		ReplicaCheckInterval time.Duration `mapstructure:"replica_check_interval" json:"replica_check_interval" yaml:"replica_check_interval"` // interval of replica health checks
+		ReplicaStickyWindow  time.Duration `mapstructure:"replica_sticky_window" json:"replica_sticky_window" yaml:"replica_sticky_window"`    // reads of a client are sent to the primary for this long after its writes
+		SlowQueryThreshold   time.Duration `mapstructure:"slow_query_threshold" json:"slow_query_threshold" yaml:"slow_query_threshold"`       // log statements taking longer at warn level, 0 to disable
 	} `mapstructure:"database" json:"database" yaml:"database"`
 	Logging struct {
 		FilePath string `mapstructure:"file_path" json:"file_path" yaml:"file_path"`                            // log file path
@@ -53,15 +62,42 @@ type AppConfig struct {
 		RetryTimeout     time.Duration `mapstructure:"retry_timeout" json:"retry_timeout" yaml:"retry_timeout"`                // retry wait
 	} `mapstructure:"security" json:"security" yaml:"security"`
 	KVStore struct {
-		Host     string `mapstructure:"host" json:"host" yaml:"host"`                                 // bind host address
-		Port     int    `mapstructure:"port" json:"port" yaml:"port"`                                 // bind listen port
-		Password string `mapstructure:"password" json:"password" yaml:"password" validate:"required"` // password for security reasons
+		Mode             string   `mapstructure:"mode" json:"mode" yaml:"mode" validate:"oneof=standalone sentinel cluster"`   // deployment mode of the server
+		Host             string   `mapstructure:"host" json:"host" yaml:"host"`                                                // bind host address, used if addrs is empty
+		Port             int      `mapstructure:"port" json:"port" yaml:"port"`                                                // bind listen port, used if addrs is empty
+		Addrs            []string `mapstructure:"addrs" json:"addrs" yaml:"addrs"`                                             // server, sentinel or cluster seed addresses(host:port)
+		MasterName       string   `mapstructure:"master_name" json:"master_name" yaml:"master_name"`                           // master name monitored by sentinels
+		Password         string   `mapstructure:"password" json:"password" yaml:"password" validate:"required"`                // password for security reasons
+		SentinelPassword string   `mapstructure:"sentinel_password" json:"sentinel_password" yaml:"sentinel_password"`         // password of sentinels
+		DB               int      `mapstructure:"db" json:"db" yaml:"db" validate:"min=0"`                                     // database index, must be 0 in cluster mode
+		PoolSize         int      `mapstructure:"pool_size" json:"pool_size" yaml:"pool_size" validate:"min=0"`                // maximum connections per node, 0 for the default
+		MinIdleConns     int      `mapstructure:"min_idle_conns" json:"min_idle_conns" yaml:"min_idle_conns" validate:"min=0"` // idle connections kept per node
+		TLS              struct {
+			Enabled    bool   `mapstructure:"enabled" json:"enabled" yaml:"enabled"`             // connect with TLS
+			SkipVerify bool   `mapstructure:"skip_verify" json:"skip_verify" yaml:"skip_verify"` // don't verify server certificates
+			CAFile     string `mapstructure:"ca_file" json:"ca_file" yaml:"ca_file"`             // PEM encoded CA certificates, system roots are used if empty
+			ServerName string `mapstructure:"server_name" json:"server_name" yaml:"server_name"` // server name to verify
+		} `mapstructure:"tls" json:"tls" yaml:"tls"`
 	} `mapstructure:"kv" json:"kv" yaml:"kv"`
+	Cache struct {
+		LocalSize      int               `mapstructure:"local_size" json:"local_size" yaml:"local_size" validate:"min=0"` // keys kept by the in-process tier, 0 to disable it
+		LessonProgress CacheMethodConfig `mapstructure:"lesson_progress" json:"lesson_progress" yaml:"lesson_progress"`   // progress of lessons of a user
+		TimeSpent      CacheMethodConfig `mapstructure:"time_spent" json:"time_spent" yaml:"time_spent"`                  // daily time spent of a user
+	} `mapstructure:"cache" json:"cache" yaml:"cache"`
+	Leaderboard struct {
+		RebuildInterval time.Duration `mapstructure:"rebuild_interval" json:"rebuild_interval" yaml:"rebuild_interval"` // recompute leaderboards from database periodically, 0 to disable
+	} `mapstructure:"leaderboard" json:"leaderboard" yaml:"leaderboard"`
 	DevOP struct {
 		APM bool `mapstructure:"apm" json:"apm" yaml:"apm"`
 	} `mapstructure:"devop" json:"devop" yaml:"devop"`
 }
 
+// CacheMethodConfig caching policy of a method
+type CacheMethodConfig struct {
+	TTL      time.Duration `mapstructure:"ttl" json:"ttl" yaml:"ttl"`                   // lifetime in the KV store, 0 to disable caching
+	LocalTTL time.Duration `mapstructure:"local_ttl" json:"local_ttl" yaml:"local_ttl"` // lifetime in the in-process tier, 0 to skip it
+}
+
 // InitConfig init app config using viper
 func InitConfig() (*AppConfig, error) {
 	// app
@@ -85,6 +121,13 @@ func InitConfig() (*AppConfig, error) {
 work with time.Time, you may specify "parseTime=true"`)
 	pflag.Int32("database.maxconn", 200, `max connection count, if you encounter a "too many connections" error, please consider
 increasing the max_connection value of your db server, or lower this value`)
+	pflag.Int("database.tx_max_attempts", 3, "attempts of a transaction failed with deadlocks or serialization failures, including the first one")
+	pflag.Duration("database.tx_retry_delay", 20*time.Millisecond, "backoff before the first transaction retry, doubled on each retry")
+	pflag.Duration("database.tx_max_retry_delay", 500*time.Millisecond, "upper bound of transaction retry backoff")
+	pflag.StringSlice("database.replicas", nil, "read replica addresses(host:port), they share the other database options with the primary")
+	pflag.Duration("database.replica_check_interval", 5*time.Second, "interval of replica health checks")
+	pflag.Duration("database.replica_sticky_window", 5*time.Second, "reads of a client are sent to the primary for this long after its writes, so they see them despite replication lag")
+	pflag.Duration("database.slow_query_threshold", 200*time.Millisecond, "log statements taking longer at warn level, 0 to disable")
 
 	// logging
 	pflag.String("logging.level", "info", "logging level")
@@ -99,9 +142,30 @@ increasing the max_connection value of your db server, or lower this value`)
 	pflag.Duration("security.retry_timeout", 1*time.Hour, "retry wait")
 
 	// kv storage
-	pflag.String("kv.host", "127.0.0.1", "kv host")
-	pflag.Int("kv.port", 6379, "kv server port")
+	pflag.String("kv.mode", "standalone", "kv deployment mode, can be 'standalone', 'sentinel' or 'cluster'")
+	pflag.String("kv.host", "127.0.0.1", "kv host, used if kv.addrs is empty")
+	pflag.Int("kv.port", 6379, "kv server port, used if kv.addrs is empty")
+	pflag.StringSlice("kv.addrs", nil, "kv server, sentinel or cluster seed addresses(host:port)")
+	pflag.String("kv.master_name", "", "master name monitored by sentinels (required in sentinel mode)")
 	pflag.String("kv.password", "", "kv server password (required)")
+	pflag.String("kv.sentinel_password", "", "kv sentinel password")
+	pflag.Int("kv.db", 0, "kv database index, must be 0 in cluster mode")
+	pflag.Int("kv.pool_size", 0, "maximum kv connections per node, 0 for 10 per CPU")
+	pflag.Int("kv.min_idle_conns", 0, "idle kv connections kept per node")
+	pflag.Bool("kv.tls.enabled", false, "connect to kv servers with TLS")
+	pflag.Bool("kv.tls.skip_verify", false, "don't verify kv server certificates")
+	pflag.String("kv.tls.ca_file", "", "PEM encoded CA certificates to verify kv servers, system roots are used if empty")
+	pflag.String("kv.tls.server_name", "", "kv server name to verify, the host of the address if empty")
+
+	// cache
+	pflag.Int("cache.local_size", 10000, "keys kept by the in-process cache tier, 0 to disable it")
+	pflag.Duration("cache.lesson_progress.ttl", 5*time.Minute, "cache lifetime of lesson progress, 0 to disable caching")
+	pflag.Duration("cache.lesson_progress.local_ttl", 5*time.Second, "in-process cache lifetime of lesson progress, 0 to skip the in-process tier")
+	pflag.Duration("cache.time_spent.ttl", 5*time.Minute, "cache lifetime of daily time spent, 0 to disable caching")
+	pflag.Duration("cache.time_spent.local_ttl", 5*time.Second, "in-process cache lifetime of daily time spent, 0 to skip the in-process tier")
+
+	// leaderboard
+	pflag.Duration("leaderboard.rebuild_interval", 1*time.Hour, "interval of recomputing leaderboards from database, 0 to disable")
 
 	// DevOp
 	pflag.Bool("devop.apm", false, "enable apm metrics")
@@ -0,0 +1,139 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxBulkInsertArgs bind parameter limit of a single statement, MySQL allows at most 65535 placeholders
+const maxBulkInsertArgs = 65535
+
+// maxBulkInsertRows maximum rows in a single multi-row INSERT
+const maxBulkInsertRows = 1000
+
+// RowSource rows of a bulk insert, it has the same method set as pgx.CopyFromSource
+type RowSource interface {
+	// Next advance to the next row, false is returned after the last row or on error
+	Next() bool
+	// Values values of the current row in the order of columns
+	Values() ([]interface{}, error)
+	// Err error that stopped the iteration, if any
+	Err() error
+}
+
+// CopyFromRows RowSource of rows held in memory
+func CopyFromRows(rows [][]interface{}) RowSource {
+	return &rowsSource{rows: rows, idx: -1}
+}
+
+type rowsSource struct {
+	rows [][]interface{}
+	idx  int
+}
+
+func (rs *rowsSource) Next() bool {
+	rs.idx++
+	return rs.idx < len(rs.rows)
+}
+
+func (rs *rowsSource) Values() ([]interface{}, error) {
+	return rs.rows[rs.idx], nil
+}
+
+func (rs *rowsSource) Err() error {
+	return nil
+}
+
+// checkBulkColumns columns must fit at least one row in a statement
+func checkBulkColumns(columns []string) error {
+	if len(columns) == 0 {
+		return errors.New("Bulk insert needs at least one column")
+	}
+	if len(columns) > maxBulkInsertArgs {
+		return fmt.Errorf("Bulk insert of %d columns exceeds the limit of %d", len(columns), maxBulkInsertArgs)
+	}
+	return nil
+}
+
+// execFunc raw exec of a driver, the query is already adapted
+type execFunc func(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+// chunkedInsert send rows of src as multi-row INSERT statements, each holding at most maxBulkInsertRows rows
+func chunkedInsert(ctx context.Context, exec execFunc, d Dialect, table string, columns []string, src RowSource) (int64, error) {
+	chunk := maxBulkInsertArgs / len(columns)
+	if chunk > maxBulkInsertRows {
+		chunk = maxBulkInsertRows
+	}
+
+	var total int64
+	rows := make([][]interface{}, 0, chunk)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		// statements are large and vary with the chunk size, don't cache them
+		t, err := translate(d, multiRowInsert(table, columns, len(rows)))
+		if err != nil {
+			return err
+		}
+		args := make([]interface{}, 0, len(rows)*len(columns))
+		for _, row := range rows {
+			args = append(args, row...)
+		}
+		res, err := exec(ctx, t.query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		total += n
+		rows = rows[:0]
+		return nil
+	}
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return total, err
+		}
+		if len(values) != len(columns) {
+			return total, fmt.Errorf("expected %d values, got %d values", len(columns), len(values))
+		}
+		rows = append(rows, values)
+		if len(rows) == chunk {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := src.Err(); err != nil {
+		return total, err
+	}
+	return total, flush()
+}
+
+// multiRowInsert build INSERT INTO "table"("a", "b") VALUES($1, $2), ($3, $4)... for n rows
+func multiRowInsert(table string, columns []string, n int) string {
+	var b strings.Builder
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = `"` + c + `"`
+	}
+	fmt.Fprintf(&b, `INSERT INTO "%s"(%s) VALUES`, table, strings.Join(quoted, ", "))
+
+	placeholders := make([]string, len(columns))
+	for i := 0; i < n; i++ {
+		for j := range columns {
+			placeholders[j] = fmt.Sprintf("$%d", i*len(columns)+j+1)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" (" + strings.Join(placeholders, ", ") + ")")
+	}
+	return b.String()
+}
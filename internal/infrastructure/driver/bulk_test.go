@@ -0,0 +1,87 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+type countResult int64
+
+func (cr countResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (cr countResult) RowsAffected() (int64, error) {
+	return int64(cr), nil
+}
+
+func TestBulkInsertColumns(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		columns int
+	}{
+		{"no column", 0},
+		{"too many columns", maxBulkInsertArgs + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns := make([]string, tt.columns)
+			// rejected before touching the connection
+			if _, err := sqlBulkInsert(ctx, nil, nil, DialectMySQL, "lesson", columns, CopyFromRows(nil)); err == nil {
+				t.Fatal("sqlBulkInsert() error = nil")
+			}
+			if _, err := pgBulkInsert(ctx, nil, nil, "lesson", columns, CopyFromRows(nil)); err == nil {
+				t.Fatal("pgBulkInsert() error = nil")
+			}
+		})
+	}
+}
+
+func TestChunkedInsert(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		columns int
+		rows    int
+		want    []int
+	}{
+		{"row limit", 2, 2500, []int{1000, 1000, 500}},
+		{"argument limit", 100, 700, []int{655, 45}},
+		{"a row per statement", maxBulkInsertArgs, 2, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns := make([]string, tt.columns)
+			for i := range columns {
+				columns[i] = "c"
+			}
+			rows := make([][]interface{}, tt.rows)
+			for i := range rows {
+				rows[i] = make([]interface{}, tt.columns)
+			}
+			var got []int
+			exec := func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+				got = append(got, len(args)/tt.columns)
+				return countResult(len(args) / tt.columns), nil
+			}
+
+			n, err := chunkedInsert(ctx, exec, DialectSQLite, "lesson", columns, CopyFromRows(rows))
+			if err != nil {
+				t.Fatalf("chunkedInsert() error = %v", err)
+			}
+			if n != int64(tt.rows) {
+				t.Fatalf("chunkedInsert() = %d, want %d", n, tt.rows)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("statements = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("statements = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"regexp"
+	"net"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type TxAccessMode int
@@ -36,6 +40,10 @@ type TxOptions struct {
 type ISQLRows interface {
 	Next() bool
 	Scan(dest ...interface{}) (err error)
+	// Columns names of the result columns
+	Columns() ([]string, error)
+	// Err error encountered during iteration, check it after Next returns false
+	Err() error
 	Close() error
 }
 
@@ -43,6 +51,9 @@ type ISQLRows interface {
 type ITransactionalDB interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error)
+	// BulkInsert insert rows of src into table, values of each row are in the order of columns.
+	// Returns the number of inserted rows, use a transaction to make it atomic
+	BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error)
 	BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error)
 	Commit(ctx context.Context) error
 	Rollback(ctx context.Context) error
@@ -50,6 +61,23 @@ type ITransactionalDB interface {
 	Ping() error
 }
 
+// idInserter implemented by connections that can't report LastInsertId, the generated id is read with RETURNING instead
+type idInserter interface {
+	insertID(ctx context.Context, query string, args []interface{}) (int64, error)
+}
+
+// InsertID run an INSERT into a table with an auto generated id column and return the generated id
+func InsertID(ctx context.Context, db ITransactionalDB, query string, args ...interface{}) (int64, error) {
+	if ii, ok := db.(idInserter); ok {
+		return ii.insertID(ctx, query, args)
+	}
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
 // DBConfig TODO
 type DBConfig struct {
 	Driver   string // driver name
@@ -61,14 +89,18 @@ type DBConfig struct {
 	Query    string // DSN query parameter
 	Schema   string // use schema
 	User     string // username
+	// Replicas read replica addresses(host:port), they share the other options with the primary
+	Replicas []string
+	// ReplicaCheckInterval interval of replica health checks
+	ReplicaCheckInterval time.Duration
+	// SlowQueryThreshold statements taking longer are logged at warn level, 0 to disable
+	SlowQueryThreshold time.Duration
+	// Logger logger of background jobs, like replica health checks
+	Logger *zap.Logger
+	// Hooks user hooks of all connections, called after the built-in logging and statistics hooks
+	Hooks []QueryHook
 }
 
-// SpacePattern check for space, tab or newline
-var SpacePattern = regexp.MustCompile(`[\n\t\s]+`)
-
-// DollarPlaceholderPattern check for postgresql style var placeholder
-var DollarPlaceholderPattern = regexp.MustCompile(`\$[0-9]+`)
-
 func getDSN(cfg *DBConfig) (DSN string) {
 	if cfg.Protocol != "" {
 		DSN = fmt.Sprintf("%s:%s@%s(%s:%d)/%s", cfg.User, cfg.Password, cfg.Protocol, cfg.Host, cfg.Port, cfg.Schema)
@@ -81,8 +113,36 @@ func getDSN(cfg *DBConfig) (DSN string) {
 	return
 }
 
-// GetDBConnection create a DB connection from given config
-func GetDBConnection(cfg *DBConfig) (conn ITransactionalDB, err error) {
+// GetDBConnection create a DB connection from given config, reads are routed to replicas if there is any
+func GetDBConnection(cfg *DBConfig) (ITransactionalDB, error) {
+	primary, err := openDB(cfg)
+	if err != nil || len(cfg.Replicas) == 0 {
+		return primary, err
+	}
+
+	replicas := make(map[string]ITransactionalDB, len(cfg.Replicas))
+	for _, addr := range cfg.Replicas {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid replica address %s: %w", addr, err)
+		}
+		replicaCfg := *cfg
+		replicaCfg.Host = host
+		if replicaCfg.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("Invalid replica address %s: %w", addr, err)
+		}
+		if replicas[addr], err = openDB(&replicaCfg); err != nil {
+			return nil, fmt.Errorf("Failed to connect replica %s: %w", addr, err)
+		}
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return NewReplicaRouter(primary, replicas, cfg.ReplicaCheckInterval, logger), nil
+}
+
+func openDB(cfg *DBConfig) (conn ITransactionalDB, err error) {
 	DSN := getDSN(cfg)
 	driver := cfg.Driver
 
@@ -0,0 +1,332 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect SQL flavor spoken by a driver
+//
+// Queries are written once in a portable form and translated by the driver before execution:
+//
+//   - placeholders are either positional "$N"(may be reused or out of order) or sequential "?", not both
+//   - identifiers are quoted with double quotes, backticks are accepted too
+//   - string literals use single quotes, a quote inside is escaped by doubling it
+//
+// String literals, comments and PostgreSQL dollar quoted strings are copied as they are,
+// whitespace outside of them is collapsed into a single space. For MySQL, backslash escapes in
+// literals(the default sql_mode) and "#" comments are recognized too. Operators spelled with "?"
+// (like jsonb ?|) are not supported
+type Dialect int
+
+// supported dialects
+const (
+	DialectMySQL Dialect = iota
+	DialectPostgreSQL
+	// DialectSQLite used by tests, FOR UPDATE is dropped since SQLite locks the whole database for writes
+	DialectSQLite
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectMySQL:
+		return "mysql"
+	case DialectPostgreSQL:
+		return "postgres"
+	case DialectSQLite:
+		return "sqlite3"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrMixedPlaceholders query uses both "$N" and "?" placeholders
+var ErrMixedPlaceholders = errors.New("Query mixes $N and ? placeholders")
+
+// maxCachedTranslations translations are cached until there are this many of them, then the cache starts over.
+// Queries with IN lists or dynamic conditions have many variants, the cache must not grow without bound
+const maxCachedTranslations = 2048
+
+// translation query rewritten for a dialect
+type translation struct {
+	query string
+	// params index of the argument bound to each placeholder, nil if arguments are passed in order
+	params []int
+	// nargs number of arguments expected, -1 if it's left to the database to check
+	nargs int
+}
+
+type translationKey struct {
+	dialect Dialect
+	query   string
+}
+
+type translationCache struct {
+	mu      sync.RWMutex
+	entries map[translationKey]*translation
+}
+
+var translations = &translationCache{entries: make(map[translationKey]*translation)}
+
+// Translate rewrite a portable query into dialect d, args are reordered or repeated to match the placeholders
+func Translate(d Dialect, query string, args []interface{}) (string, []interface{}, error) {
+	t, err := translations.get(d, query)
+	if err != nil {
+		return "", nil, err
+	}
+	args, err = t.bind(args)
+	return t.query, args, err
+}
+
+func (tc *translationCache) get(d Dialect, query string) (*translation, error) {
+	key := translationKey{d, query}
+	tc.mu.RLock()
+	t, ok := tc.entries[key]
+	tc.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	t, err := translate(d, query)
+	if err != nil {
+		return nil, err
+	}
+	tc.mu.Lock()
+	if len(tc.entries) >= maxCachedTranslations {
+		tc.entries = make(map[translationKey]*translation)
+	}
+	tc.entries[key] = t
+	tc.mu.Unlock()
+	return t, nil
+}
+
+func (t *translation) bind(args []interface{}) ([]interface{}, error) {
+	if t.nargs >= 0 && len(args) != t.nargs {
+		return nil, fmt.Errorf("Query expects %d arguments, got %d", t.nargs, len(args))
+	}
+	if t.params == nil {
+		return args, nil
+	}
+	bound := make([]interface{}, len(t.params))
+	for i, p := range t.params {
+		bound[i] = args[p]
+	}
+	return bound, nil
+}
+
+// translate tokenize query and rewrite each token for dialect d
+func translate(d Dialect, query string) (*translation, error) {
+	var (
+		b          strings.Builder
+		params     []int
+		positional bool // "$N" seen
+		sequential int  // number of "?" seen
+		maxParam   int
+		space      bool // whitespace pending
+	)
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		if isSpace(c) {
+			space = true
+			i++
+			continue
+		}
+		if space {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+		}
+
+		switch {
+		case c == '\'':
+			end, err := scanQuoted(query, i, '\'', d == DialectMySQL)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case c == '"' || c == '`':
+			end, err := scanQuoted(query, i, c, false)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.Replace(query[i+1:end-1], string([]byte{c, c}), string(c), -1)
+			b.WriteString(quoteIdentifier(d, name))
+			i = end
+		case c == '-' && strings.HasPrefix(query[i:], "--"), c == '#' && d == DialectMySQL:
+			// the line break ends the comment, keep it
+			end := strings.IndexByte(query[i:], '\n') + 1
+			if end == 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated comment at offset %d", i)
+			}
+			end += i + 4
+			b.WriteString(query[i:end])
+			i = end
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			if sequential > 0 {
+				return nil, ErrMixedPlaceholders
+			}
+			positional = true
+			end := i + 1
+			for end < len(query) && isDigit(query[end]) {
+				end++
+			}
+			n, err := strconv.Atoi(query[i+1 : end])
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("Invalid placeholder %s", query[i:end])
+			}
+			if n > maxParam {
+				maxParam = n
+			}
+			if d == DialectPostgreSQL {
+				b.WriteString(query[i:end])
+			} else {
+				params = append(params, n-1)
+				b.WriteByte('?')
+			}
+			i = end
+		case c == '$' && d == DialectPostgreSQL:
+			end, ok := scanDollarQuoted(query, i)
+			if !ok {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case d == DialectSQLite && (c == 'F' || c == 'f') && (i == 0 || !isIdentifierByte(query[i-1])):
+			end, ok := scanForUpdate(query, i)
+			if !ok {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			i = end
+		case c == '?':
+			if positional {
+				return nil, ErrMixedPlaceholders
+			}
+			sequential++
+			if d == DialectPostgreSQL {
+				b.WriteString("$" + strconv.Itoa(sequential))
+			} else {
+				b.WriteByte('?')
+			}
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	// a stripped trailing clause leaves the space before it behind
+	t := &translation{query: strings.TrimRight(b.String(), " "), nargs: -1}
+	if positional {
+		t.nargs = maxParam
+		if d != DialectPostgreSQL && !inOrder(params, maxParam) {
+			t.params = params
+		}
+	}
+	return t, nil
+}
+
+// scanQuoted return the end offset(exclusive) of the quoted token starting at query[start],
+// a doubled quote character doesn't end the token, neither does an escaped one if backslash is set
+func scanQuoted(query string, start int, quote byte, backslash bool) (int, error) {
+	for i := start + 1; i < len(query); i++ {
+		if backslash && query[i] == '\\' {
+			i++
+			continue
+		}
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, nil
+	}
+	return 0, fmt.Errorf("Unterminated %c at offset %d", quote, start)
+}
+
+// scanDollarQuoted match a PostgreSQL $tag$...$tag$ string starting at query[start]
+func scanDollarQuoted(query string, start int) (int, bool) {
+	end := start + 1
+	for end < len(query) && (isLetter(query[end]) || isDigit(query[end]) || query[end] == '_') {
+		end++
+	}
+	if end >= len(query) || query[end] != '$' {
+		return 0, false
+	}
+	tag := query[start : end+1]
+	closing := strings.Index(query[end+1:], tag)
+	if closing < 0 {
+		return 0, false
+	}
+	return end + 1 + closing + len(tag), true
+}
+
+// scanForUpdate match a FOR UPDATE locking clause starting at query[start]
+func scanForUpdate(query string, start int) (int, bool) {
+	end := start + len("FOR")
+	if end >= len(query) || !strings.EqualFold(query[start:end], "FOR") || !isSpace(query[end]) {
+		return 0, false
+	}
+	for end < len(query) && isSpace(query[end]) {
+		end++
+	}
+	if len(query)-end < len("UPDATE") || !strings.EqualFold(query[end:end+len("UPDATE")], "UPDATE") {
+		return 0, false
+	}
+	end += len("UPDATE")
+	if end < len(query) && isIdentifierByte(query[end]) {
+		return 0, false
+	}
+	return end, true
+}
+
+func quoteIdentifier(d Dialect, name string) string {
+	if d == DialectMySQL {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// inOrder whether params bind $1..$n exactly once each in order, so arguments can be passed as they are
+func inOrder(params []int, n int) bool {
+	if len(params) != n {
+		return false
+	}
+	for i, p := range params {
+		if p != i {
+			return false
+		}
+	}
+	return true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,122 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		query    string
+		args     []interface{}
+		want     string
+		wantArgs []interface{}
+	}{
+		{"mysql in order", DialectMySQL,
+			`SELECT "id" FROM "user" WHERE "name" = $1 AND "age" > $2`, []interface{}{"a", 1},
+			"SELECT `id` FROM `user` WHERE `name` = ? AND `age` > ?", []interface{}{"a", 1}},
+		{"mysql reorder", DialectMySQL,
+			`UPDATE "user" SET "name" = $2 WHERE "id" = $1`, []interface{}{1, "a"},
+			"UPDATE `user` SET `name` = ? WHERE `id` = ?", []interface{}{"a", 1}},
+		{"sqlite reuse", DialectSQLite,
+			`SELECT * FROM "t" WHERE "a" = $1 OR "b" = $1`, []interface{}{7},
+			`SELECT * FROM "t" WHERE "a" = ? OR "b" = ?`, []interface{}{7, 7}},
+		{"postgres positional kept", DialectPostgreSQL,
+			`SELECT * FROM "t" WHERE "a" = $2 OR "b" = $1`, []interface{}{1, 2},
+			`SELECT * FROM "t" WHERE "a" = $2 OR "b" = $1`, []interface{}{1, 2}},
+		{"postgres sequential", DialectPostgreSQL,
+			`SELECT * FROM "t" WHERE "a" = ? AND "b" = ?`, []interface{}{1, 2},
+			`SELECT * FROM "t" WHERE "a" = $1 AND "b" = $2`, []interface{}{1, 2}},
+		{"mysql sequential", DialectMySQL,
+			"SELECT * FROM `t` WHERE `a` = ?", []interface{}{1},
+			"SELECT * FROM `t` WHERE `a` = ?", []interface{}{1}},
+		{"whitespace collapsed", DialectPostgreSQL,
+			"SELECT  *\n\tFROM \"t\"\n", nil,
+			`SELECT * FROM "t"`, nil},
+		{"quoted identifier", DialectMySQL,
+			`SELECT "we""ird", "back` + "`" + `tick" FROM "t"`, nil,
+			"SELECT `we\"ird`, `back``tick` FROM `t`", nil},
+		{"literal kept", DialectPostgreSQL,
+			`SELECT 'it''s $1 ?  "x"' FROM "t" WHERE "a" = $1`, []interface{}{1},
+			`SELECT 'it''s $1 ?  "x"' FROM "t" WHERE "a" = $1`, []interface{}{1}},
+		{"mysql backslash escape", DialectMySQL,
+			`SELECT 'a\'b $1' FROM "t" WHERE "a" = $1`, []interface{}{1},
+			"SELECT 'a\\'b $1' FROM `t` WHERE `a` = ?", []interface{}{1}},
+		{"mysql escaped backslash", DialectMySQL,
+			`SELECT 'a\\' FROM "t" WHERE "a" = $1`, []interface{}{1},
+			"SELECT 'a\\\\' FROM `t` WHERE `a` = ?", []interface{}{1}},
+		{"line comment", DialectMySQL,
+			"SELECT * -- $2 \"x\" ?\nFROM \"t\" WHERE \"a\" = $1", []interface{}{1},
+			"SELECT * -- $2 \"x\" ?\nFROM `t` WHERE `a` = ?", []interface{}{1}},
+		{"mysql hash comment", DialectMySQL,
+			"SELECT * # it's $2\nFROM \"t\" WHERE \"a\" = $1", []interface{}{1},
+			"SELECT * # it's $2\nFROM `t` WHERE `a` = ?", []interface{}{1}},
+		{"block comment", DialectSQLite,
+			`SELECT /* $3 'x */ * FROM "t" WHERE "a" = $1`, []interface{}{1},
+			`SELECT /* $3 'x */ * FROM "t" WHERE "a" = ?`, []interface{}{1}},
+		{"postgres dollar quote", DialectPostgreSQL,
+			`SELECT $tag$ it's ? $1 $tag$, $$x$$ FROM "t" WHERE "a" = ?`, []interface{}{1},
+			`SELECT $tag$ it's ? $1 $tag$, $$x$$ FROM "t" WHERE "a" = $1`, []interface{}{1}},
+		{"sqlite for update stripped", DialectSQLite,
+			`SELECT * FROM "t" WHERE "a" = $1 FOR  UPDATE`, []interface{}{1},
+			`SELECT * FROM "t" WHERE "a" = ?`, []interface{}{1}},
+		{"sqlite for update identifier kept", DialectSQLite,
+			`SELECT "for_update", format FROM "t"`, nil,
+			`SELECT "for_update", format FROM "t"`, nil},
+		{"mysql for update kept", DialectMySQL,
+			`SELECT * FROM "t" WHERE "a" = $1 FOR UPDATE`, []interface{}{1},
+			"SELECT * FROM `t` WHERE `a` = ? FOR UPDATE", []interface{}{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotArgs, err := Translate(tt.dialect, tt.query, tt.args)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate() query = %s, want %s", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("Translate() args = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		args    []interface{}
+	}{
+		{"mixed placeholders", DialectMySQL, `SELECT * FROM "t" WHERE "a" = $1 AND "b" = ?`, []interface{}{1, 2}},
+		{"mixed placeholders reversed", DialectPostgreSQL, `SELECT * FROM "t" WHERE "a" = ? AND "b" = $1`, []interface{}{1, 2}},
+		{"zero placeholder", DialectMySQL, `SELECT * FROM "t" WHERE "a" = $0`, []interface{}{1}},
+		{"argument count", DialectMySQL, `SELECT * FROM "t" WHERE "a" = $2`, []interface{}{1}},
+		{"unterminated literal", DialectPostgreSQL, `SELECT 'a`, nil},
+		{"unterminated escaped literal", DialectMySQL, `SELECT 'a\'`, nil},
+		{"unterminated identifier", DialectMySQL, `SELECT "a`, nil},
+		{"unterminated comment", DialectSQLite, `SELECT /* a`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Translate(tt.dialect, tt.query, tt.args); err == nil {
+				t.Errorf("Translate() expected an error")
+			}
+		})
+	}
+}
+
+func TestTranslatePostgreSQLBackslash(t *testing.T) {
+	// standard_conforming_strings is on by default, a backslash is an ordinary character
+	got, _, err := Translate(DialectPostgreSQL, `SELECT 'a\' WHERE "a" = ? -- comment`, []interface{}{1})
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if want := `SELECT 'a\' WHERE "a" = $1 -- comment`; got != want {
+		t.Errorf("Translate() = %s, want %s", got, want)
+	}
+}
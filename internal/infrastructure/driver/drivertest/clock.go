@@ -0,0 +1,48 @@
+package drivertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock source of the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock Clock moved manually, so expiration can be tested without sleeping
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock create a FakeClock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// Advance move the clock forward by d
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.now = fc.now.Add(d)
+	fc.mu.Unlock()
+}
+
+// Set move the clock to t
+func (fc *FakeClock) Set(t time.Time) {
+	fc.mu.Lock()
+	fc.now = t
+	fc.mu.Unlock()
+}
@@ -0,0 +1,401 @@
+// Package drivertest fakes of the driver package, so use cases and handlers can be tested without live databases
+package drivertest
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+// operations of ITransactionalDB expectations are set on
+const (
+	methodExec       = "Exec"
+	methodQuery      = "Query"
+	methodBulkInsert = "BulkInsert"
+	methodBeginTx    = "BeginTx"
+	methodCommit     = "Commit"
+	methodRollback   = "RollBack"
+)
+
+// FakeDB scriptable ITransactionalDB. Operations must happen in the order of expectations,
+// each expectation is met once. An operation not matching the next expectation fails with an error,
+// which is also reported by ExpectationsWereMet in case the code under test swallows it
+type FakeDB struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	next         int
+	failures     []error
+}
+
+// FakeTx transaction started by FakeDB.BeginTx, it can't be used after Commit or Rollback
+type FakeTx struct {
+	db   *FakeDB
+	opts *driver.TxOptions
+	done bool
+}
+
+var (
+	_ driver.ITransactionalDB = &FakeDB{}
+	_ driver.ITransactionalDB = &FakeTx{}
+)
+
+// NewFakeDB create a FakeDB without expectations
+func NewFakeDB() *FakeDB {
+	return &FakeDB{}
+}
+
+// ExpectExec expect an ExecContext with a statement matching pattern(a regular expression).
+// Statements are matched in the portable form passed by the caller, with whitespace collapsed
+func (fd *FakeDB) ExpectExec(pattern string) *Expectation {
+	return fd.expect(&Expectation{method: methodExec, pattern: regexp.MustCompile(pattern)})
+}
+
+// ExpectQuery expect a QueryContext with a statement matching pattern(a regular expression), see ExpectExec
+func (fd *FakeDB) ExpectQuery(pattern string) *Expectation {
+	return fd.expect(&Expectation{method: methodQuery, pattern: regexp.MustCompile(pattern)})
+}
+
+// ExpectBulkInsert expect a BulkInsert into table, columns are checked too if given
+func (fd *FakeDB) ExpectBulkInsert(table string, columns ...string) *Expectation {
+	return fd.expect(&Expectation{method: methodBulkInsert, table: table, columns: columns})
+}
+
+// ExpectBegin expect a transaction to be started
+func (fd *FakeDB) ExpectBegin() *Expectation {
+	return fd.expect(&Expectation{method: methodBeginTx})
+}
+
+// ExpectCommit expect the current transaction to be committed
+func (fd *FakeDB) ExpectCommit() *Expectation {
+	return fd.expect(&Expectation{method: methodCommit})
+}
+
+// ExpectRollback expect the current transaction to be rolled back
+func (fd *FakeDB) ExpectRollback() *Expectation {
+	return fd.expect(&Expectation{method: methodRollback})
+}
+
+func (fd *FakeDB) expect(e *Expectation) *Expectation {
+	fd.mu.Lock()
+	fd.expectations = append(fd.expectations, e)
+	fd.mu.Unlock()
+	return e
+}
+
+// ExpectationsWereMet returns the first unexpected operation, or the first expectation not met
+func (fd *FakeDB) ExpectationsWereMet() error {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	if len(fd.failures) > 0 {
+		return fd.failures[0]
+	}
+	if fd.next < len(fd.expectations) {
+		return fmt.Errorf("drivertest: expectation %s was not met", fd.expectations[fd.next])
+	}
+	return nil
+}
+
+// match consume the next expectation if op matches it
+func (fd *FakeDB) match(op *Expectation, args []interface{}) (*Expectation, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	if fd.next >= len(fd.expectations) {
+		return nil, fd.fail(fmt.Errorf("drivertest: unexpected %s, all expectations were met", op))
+	}
+	e := fd.expectations[fd.next]
+	if err := e.match(op, args); err != nil {
+		return nil, fd.fail(fmt.Errorf("drivertest: unexpected %s, next expectation is %s: %s", op, e, err))
+	}
+	fd.next++
+	return e, nil
+}
+
+func (fd *FakeDB) fail(err error) error {
+	fd.failures = append(fd.failures, err)
+	return err
+}
+
+func (fd *FakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e, err := fd.match(&Expectation{method: methodExec, query: collapseSpaces(query)}, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.result == nil {
+		return &result{}, nil
+	}
+	return e.result, nil
+}
+
+func (fd *FakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (driver.ISQLRows, error) {
+	e, err := fd.match(&Expectation{method: methodQuery, query: collapseSpaces(query)}, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.rows.cursor(), nil
+}
+
+// BulkInsert rows of src are drained and kept in the expectation, see Expectation.Inserted
+func (fd *FakeDB) BulkInsert(ctx context.Context, table string, columns []string, src driver.RowSource) (int64, error) {
+	e, err := fd.match(&Expectation{method: methodBulkInsert, table: table, columns: columns}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	var rows [][]interface{}
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		if len(values) != len(columns) {
+			return 0, fmt.Errorf("drivertest: row %d has %d values, expected %d", len(rows), len(values), len(columns))
+		}
+		rows = append(rows, append([]interface{}{}, values...))
+	}
+	if err := src.Err(); err != nil {
+		return 0, err
+	}
+
+	fd.mu.Lock()
+	e.inserted = rows
+	fd.mu.Unlock()
+	return int64(len(rows)), nil
+}
+
+func (fd *FakeDB) BeginTx(ctx context.Context, opts *driver.TxOptions) (driver.ITransactionalDB, error) {
+	e, err := fd.match(&Expectation{method: methodBeginTx}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &FakeTx{db: fd, opts: opts}, nil
+}
+
+func (fd *FakeDB) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (fd *FakeDB) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func (fd *FakeDB) Close(ctx context.Context) error {
+	return nil
+}
+
+func (fd *FakeDB) Ping() error {
+	return nil
+}
+
+// Options options the transaction was started with
+func (ft *FakeTx) Options() *driver.TxOptions {
+	return ft.opts
+}
+
+func (ft *FakeTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if ft.done {
+		return nil, sql.ErrTxDone
+	}
+	return ft.db.ExecContext(ctx, query, args...)
+}
+
+func (ft *FakeTx) QueryContext(ctx context.Context, query string, args ...interface{}) (driver.ISQLRows, error) {
+	if ft.done {
+		return nil, sql.ErrTxDone
+	}
+	return ft.db.QueryContext(ctx, query, args...)
+}
+
+func (ft *FakeTx) BulkInsert(ctx context.Context, table string, columns []string, src driver.RowSource) (int64, error) {
+	if ft.done {
+		return 0, sql.ErrTxDone
+	}
+	return ft.db.BulkInsert(ctx, table, columns, src)
+}
+
+func (ft *FakeTx) BeginTx(ctx context.Context, opts *driver.TxOptions) (driver.ITransactionalDB, error) {
+	panic("create transaction inside a transaction")
+}
+
+// Commit the transaction is finished even if the expectation returns an error, like a real one
+func (ft *FakeTx) Commit(ctx context.Context) error {
+	return ft.finish(methodCommit)
+}
+
+// Rollback see Commit
+func (ft *FakeTx) Rollback(ctx context.Context) error {
+	return ft.finish(methodRollback)
+}
+
+func (ft *FakeTx) finish(method string) error {
+	if ft.done {
+		return sql.ErrTxDone
+	}
+	ft.done = true
+	e, err := ft.db.match(&Expectation{method: method}, nil)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+func (ft *FakeTx) Close(ctx context.Context) error {
+	return nil
+}
+
+func (ft *FakeTx) Ping() error {
+	return nil
+}
+
+// Argument custom matcher of a statement argument
+type Argument interface {
+	Match(v interface{}) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(v interface{}) bool {
+	return true
+}
+
+// AnyArg matches any argument, for generated values like ids and timestamps
+func AnyArg() Argument {
+	return anyArg{}
+}
+
+// Expectation an expected operation and its outcome
+type Expectation struct {
+	method  string
+	pattern *regexp.Regexp
+	query   string // statement of an actual operation
+	table   string
+	columns []string
+	args    []interface{}
+
+	rows     *Rows
+	result   sql.Result
+	err      error
+	inserted [][]interface{}
+}
+
+// WithArgs arguments the statement must be called with, values are compared after the conversions of
+// database/sql(so int matches int64), an Argument matches with its own logic
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.args = args
+	return e
+}
+
+// WillReturnRows rows returned by the query, no rows by default
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult result of the statement, zero values by default
+func (e *Expectation) WillReturnResult(lastInsertID, rowsAffected int64) *Expectation {
+	e.result = &result{lastInsertID, rowsAffected}
+	return e
+}
+
+// WillReturnError fail the operation with err, like driver.ErrUniqueViolation
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Inserted rows received by the expected BulkInsert
+func (e *Expectation) Inserted() [][]interface{} {
+	return e.inserted
+}
+
+func (e *Expectation) String() string {
+	switch {
+	case e.pattern != nil:
+		return fmt.Sprintf("%s matching %q", e.method, e.pattern)
+	case e.query != "":
+		return fmt.Sprintf("%s %q", e.method, e.query)
+	case e.table != "":
+		return fmt.Sprintf("%s into %s", e.method, e.table)
+	}
+	return e.method
+}
+
+// match check if operation op called with args meets e
+func (e *Expectation) match(op *Expectation, args []interface{}) error {
+	if e.method != op.method {
+		return errors.New("method differs")
+	}
+	if e.pattern != nil && !e.pattern.MatchString(op.query) {
+		return errors.New("statement doesn't match")
+	}
+	if e.table != op.table {
+		return errors.New("table differs")
+	}
+	if len(e.columns) > 0 && !reflect.DeepEqual(e.columns, op.columns) {
+		return fmt.Errorf("columns %v differ", op.columns)
+	}
+	if e.args == nil {
+		return nil
+	}
+	if len(e.args) != len(args) {
+		return fmt.Errorf("called with %d arguments, expected %d", len(args), len(e.args))
+	}
+	for i, expected := range e.args {
+		if m, ok := expected.(Argument); ok {
+			if !m.Match(args[i]) {
+				return fmt.Errorf("argument %d %v doesn't match", i, args[i])
+			}
+			continue
+		}
+		if !reflect.DeepEqual(convertArg(expected), convertArg(args[i])) {
+			return fmt.Errorf("argument %d is %v, expected %v", i, args[i], expected)
+		}
+	}
+	return nil
+}
+
+// convertArg normalize v like database/sql does before passing it to drivers
+func convertArg(v interface{}) interface{} {
+	if cv, err := sqldriver.DefaultParameterConverter.ConvertValue(v); err == nil {
+		return cv
+	}
+	return v
+}
+
+func collapseSpaces(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
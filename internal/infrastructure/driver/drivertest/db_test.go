@@ -0,0 +1,158 @@
+package drivertest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+func TestFakeDBExpectations(t *testing.T) {
+	ctx := context.Background()
+	db := NewFakeDB()
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.ExpectBegin()
+	db.ExpectQuery(`SELECT .* FROM "user" WHERE id = \$1`).WithArgs(7).
+		WillReturnRows(NewRows("id", "name", "email", "created").AddRow(int64(7), "alice", nil, createdAt))
+	db.ExpectExec(`UPDATE "user"`).WithArgs("bob", AnyArg()).WillReturnResult(0, 1)
+	db.ExpectCommit()
+
+	tx, err := db.BeginTx(ctx, &driver.TxOptions{AccessMode: driver.AccessReadWrite})
+	if err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	// whitespace is collapsed before matching, int matches int64 like in database/sql
+	rows, err := tx.QueryContext(ctx, "SELECT id, name, email, created\n\tFROM \"user\" WHERE id = $1", int64(7))
+	if err != nil {
+		t.Fatalf("QueryContext() error = %v", err)
+	}
+	var (
+		id      int
+		name    string
+		email   *string
+		created time.Time
+	)
+	if !rows.Next() {
+		t.Fatal("Expected a row")
+	}
+	if err := rows.Scan(&id, &name, &email, &created); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if id != 7 || name != "alice" || email != nil || !created.Equal(createdAt) {
+		t.Fatalf("Scan() = %d, %s, %v, %s", id, name, email, created)
+	}
+	if rows.Next() {
+		t.Fatal("Expected a single row")
+	}
+	rows.Close()
+
+	res, err := tx.ExecContext(ctx, `UPDATE "user" SET name = $1 WHERE id = $2`, "bob", 7)
+	if err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("RowsAffected() = %d, want 1", n)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE "user" SET name = $1`, "eve"); err != sql.ErrTxDone {
+		t.Fatalf("ExecContext() error = %v after commit, want %v", err, sql.ErrTxDone)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeDBUnexpectedOperation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		expect func(db *FakeDB)
+		run    func(db *FakeDB) error
+	}{
+		{"statement", func(db *FakeDB) { db.ExpectExec(`DELETE FROM lesson`) },
+			func(db *FakeDB) error { _, err := db.ExecContext(ctx, `DELETE FROM "user"`); return err }},
+		{"method", func(db *FakeDB) { db.ExpectQuery(`SELECT`) },
+			func(db *FakeDB) error { _, err := db.ExecContext(ctx, `SELECT 1`); return err }},
+		{"arguments", func(db *FakeDB) { db.ExpectExec(`DELETE`).WithArgs(1) },
+			func(db *FakeDB) error {
+				_, err := db.ExecContext(ctx, `DELETE FROM lesson WHERE id = $1`, 2)
+				return err
+			}},
+		{"argument count", func(db *FakeDB) { db.ExpectExec(`DELETE`).WithArgs(1) },
+			func(db *FakeDB) error { _, err := db.ExecContext(ctx, `DELETE FROM lesson`); return err }},
+		{"exhausted", func(db *FakeDB) {},
+			func(db *FakeDB) error { _, err := db.QueryContext(ctx, `SELECT 1`); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewFakeDB()
+			tt.expect(db)
+			if err := tt.run(db); err == nil {
+				t.Fatal("Expected the operation to fail")
+			}
+			// reported even if the code under test swallows the error
+			if err := db.ExpectationsWereMet(); err == nil {
+				t.Fatal("ExpectationsWereMet() didn't report the unexpected operation")
+			}
+		})
+	}
+}
+
+func TestFakeDBUnmetExpectation(t *testing.T) {
+	db := NewFakeDB()
+	db.ExpectExec(`DELETE`)
+	if err := db.ExpectationsWereMet(); err == nil {
+		t.Fatal("ExpectationsWereMet() didn't report the unmet expectation")
+	}
+}
+
+func TestFakeDBErrors(t *testing.T) {
+	ctx := context.Background()
+	lost := errors.New("connection lost")
+	db := NewFakeDB()
+	db.ExpectExec(`INSERT`).WillReturnError(driver.ErrUniqueViolation)
+	db.ExpectQuery(`SELECT`).WillReturnRows(NewRows("n").AddRow(1).WillFailWith(lost))
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO lesson VALUES(1)`); err != driver.ErrUniqueViolation {
+		t.Fatalf("ExecContext() error = %v, want %v", err, driver.ErrUniqueViolation)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT n FROM lesson`)
+	if err != nil {
+		t.Fatalf("QueryContext() error = %v", err)
+	}
+	var n int
+	for rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+	}
+	if err := rows.Err(); err != lost {
+		t.Fatalf("Err() = %v, want %v", err, lost)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeDBBulkInsert(t *testing.T) {
+	ctx := context.Background()
+	db := NewFakeDB()
+	e := db.ExpectBulkInsert("lesson_progress", "user_id", "lesson_id")
+
+	rows := [][]interface{}{{"alice", 1}, {"bob", 2}}
+	n, err := db.BulkInsert(ctx, "lesson_progress", []string{"user_id", "lesson_id"}, driver.CopyFromRows(rows))
+	if err != nil || n != 2 {
+		t.Fatalf("BulkInsert() = %d, %v, want 2", n, err)
+	}
+	if got := e.Inserted(); len(got) != 2 || got[1][0] != "bob" {
+		t.Fatalf("Inserted() = %v", got)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,526 @@
+package drivertest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+// errors returned by MemoryKV in the same situations as redis
+var (
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNoSuchKey = errors.New("ERR no such key")
+	ErrNotInt    = errors.New("ERR value is not an integer or out of range")
+)
+
+// MemoryKV in-memory KeyValueDB following the semantics of redis, expiration is checked against its clock
+type MemoryKV struct {
+	mu      sync.Mutex
+	clock   Clock
+	entries map[string]*kvEntry
+}
+
+// kvEntry value of a key, either a string, a hash or a sorted set
+type kvEntry struct {
+	value    string
+	hash     map[string]string  // nil unless it's a hash
+	zset     map[string]float64 // nil unless it's a sorted set
+	expireAt time.Time          // zero if the key never expires
+}
+
+var _ driver.KeyValueDB = &MemoryKV{}
+
+// NewMemoryKV create an empty store, the real clock is used if clock is nil
+func NewMemoryKV(clock Clock) *MemoryKV {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &MemoryKV{clock: clock, entries: make(map[string]*kvEntry)}
+}
+
+// Keys names of keys not expired, in no particular order
+func (mk *MemoryKV) Keys() []string {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	keys := make([]string, 0, len(mk.entries))
+	for key := range mk.entries {
+		if mk.lookup(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// lookup entry of key, expired entries are removed
+func (mk *MemoryKV) lookup(key string) *kvEntry {
+	e, ok := mk.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !mk.clock.Now().Before(e.expireAt) {
+		delete(mk.entries, key)
+		return nil
+	}
+	return e
+}
+
+// lookupString string entry of key, nil if key doesn't exist
+func (mk *MemoryKV) lookupString(key string) (*kvEntry, error) {
+	e := mk.lookup(key)
+	if e != nil && (e.hash != nil || e.zset != nil) {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// lookupHash hash of key, created if create is true and key doesn't exist
+func (mk *MemoryKV) lookupHash(key string, create bool) (*kvEntry, error) {
+	e := mk.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &kvEntry{hash: make(map[string]string)}
+		mk.entries[key] = e
+	}
+	if e.hash == nil {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// lookupZSet sorted set of key, created if create is true and key doesn't exist
+func (mk *MemoryKV) lookupZSet(key string, create bool) (*kvEntry, error) {
+	e := mk.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &kvEntry{zset: make(map[string]float64)}
+		mk.entries[key] = e
+	}
+	if e.zset == nil {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+func (mk *MemoryKV) expireAt(expiration time.Duration) time.Time {
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return mk.clock.Now().Add(expiration)
+}
+
+// SetEX implement KeyValueDB
+func (mk *MemoryKV) SetEX(ctx context.Context, key string, value string, expiration time.Duration) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	mk.entries[key] = &kvEntry{value: value, expireAt: mk.expireAt(expiration)}
+	return nil
+}
+
+// SetNX implement KeyValueDB
+func (mk *MemoryKV) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	if mk.lookup(key) != nil {
+		return false, nil
+	}
+	mk.entries[key] = &kvEntry{value: value, expireAt: mk.expireAt(expiration)}
+	return true, nil
+}
+
+// Get implement KeyValueDB
+func (mk *MemoryKV) Get(ctx context.Context, key string) (string, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupString(key)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", driver.ErrNotFound
+	}
+	return e.value, nil
+}
+
+// MGet implement KeyValueDB, keys holding other types are left out like absent ones
+func (mk *MemoryKV) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if e, err := mk.lookupString(key); err == nil && e != nil {
+			result[key] = e.value
+		}
+	}
+	return result, nil
+}
+
+// MSet implement KeyValueDB
+func (mk *MemoryKV) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	for key, value := range values {
+		mk.entries[key] = &kvEntry{value: value, expireAt: mk.expireAt(expiration)}
+	}
+	return nil
+}
+
+// Exists implement KeyValueDB
+func (mk *MemoryKV) Exists(ctx context.Context, key string) (bool, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+	return mk.lookup(key) != nil, nil
+}
+
+// Del implement KeyValueDB
+func (mk *MemoryKV) Del(ctx context.Context, keys ...string) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	for _, key := range keys {
+		delete(mk.entries, key)
+	}
+	return nil
+}
+
+// Expire implement KeyValueDB, the key is deleted if expiration isn't positive
+func (mk *MemoryKV) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e := mk.lookup(key)
+	if e == nil {
+		return nil
+	}
+	if expiration <= 0 {
+		delete(mk.entries, key)
+		return nil
+	}
+	e.expireAt = mk.expireAt(expiration)
+	return nil
+}
+
+// TTL implement KeyValueDB
+func (mk *MemoryKV) TTL(ctx context.Context, key string) (time.Duration, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e := mk.lookup(key)
+	if e == nil {
+		return 0, driver.ErrNotFound
+	}
+	if e.expireAt.IsZero() {
+		return 0, nil
+	}
+	return e.expireAt.Sub(mk.clock.Now()), nil
+}
+
+// Rename implement KeyValueDB, the time to live moves with the value
+func (mk *MemoryKV) Rename(ctx context.Context, key string, newKey string) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e := mk.lookup(key)
+	if e == nil {
+		return ErrNoSuchKey
+	}
+	delete(mk.entries, key)
+	mk.entries[newKey] = e
+	return nil
+}
+
+// RenameFenced implement KeyValueDB, the fencing token is kept under the same key as driver.RedisClient does
+func (mk *MemoryKV) RenameFenced(ctx context.Context, key string, newKey string, token int64, expiration time.Duration) (bool, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	fence := driver.RedisFenceKey(newKey)
+	f, err := mk.lookupString(fence)
+	if err != nil {
+		return false, err
+	}
+	if f != nil {
+		current, err := strconv.ParseInt(f.value, 10, 64)
+		if err != nil {
+			return false, ErrNotInt
+		}
+		if current > token {
+			return false, nil
+		}
+	}
+	if e := mk.lookup(key); e != nil {
+		delete(mk.entries, key)
+		if expiration > 0 {
+			e.expireAt = mk.expireAt(expiration)
+		}
+		mk.entries[newKey] = e
+	} else {
+		delete(mk.entries, newKey)
+	}
+	mk.entries[fence] = &kvEntry{value: strconv.FormatInt(token, 10), expireAt: mk.expireAt(expiration)}
+	return true, nil
+}
+
+// Ping implement KeyValueDB
+func (mk *MemoryKV) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Incr implement KeyValueDB
+func (mk *MemoryKV) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	return mk.IncrBy(ctx, key, 1, expiration)
+}
+
+// IncrBy implement KeyValueDB
+func (mk *MemoryKV) IncrBy(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupString(key)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		e = &kvEntry{value: "0"}
+		mk.entries[key] = e
+	}
+	n, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return 0, ErrNotInt
+	}
+	n += delta
+	e.value = strconv.FormatInt(n, 10)
+	if e.expireAt.IsZero() {
+		e.expireAt = mk.expireAt(expiration)
+	}
+	return n, nil
+}
+
+// HSet implement KeyValueDB
+func (mk *MemoryKV) HSet(ctx context.Context, key string, fields map[string]string) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	if len(fields) == 0 {
+		return nil
+	}
+	e, err := mk.lookupHash(key, true)
+	if err != nil {
+		return err
+	}
+	for f, v := range fields {
+		e.hash[f] = v
+	}
+	return nil
+}
+
+// HGet implement KeyValueDB
+func (mk *MemoryKV) HGet(ctx context.Context, key string, field string) (string, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupHash(key, false)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", driver.ErrNotFound
+	}
+	v, ok := e.hash[field]
+	if !ok {
+		return "", driver.ErrNotFound
+	}
+	return v, nil
+}
+
+// HGetAll implement KeyValueDB
+func (mk *MemoryKV) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupHash(key, false)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	if e != nil {
+		for f, v := range e.hash {
+			result[f] = v
+		}
+	}
+	return result, nil
+}
+
+// HDel implement KeyValueDB, the key is deleted with its last field
+func (mk *MemoryKV) HDel(ctx context.Context, key string, fields ...string) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupHash(key, false)
+	if err != nil || e == nil {
+		return err
+	}
+	for _, f := range fields {
+		delete(e.hash, f)
+	}
+	if len(e.hash) == 0 {
+		delete(mk.entries, key)
+	}
+	return nil
+}
+
+// HIncrBy implement KeyValueDB
+func (mk *MemoryKV) HIncrBy(ctx context.Context, key string, field string, delta int64) (int64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupHash(key, true)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if v, ok := e.hash[field]; ok {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, ErrNotInt
+		}
+	}
+	n += delta
+	e.hash[field] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+// ZAdd implement KeyValueDB
+func (mk *MemoryKV) ZAdd(ctx context.Context, key string, members ...*driver.ZMember) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, true)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		e.zset[m.Member] = m.Score
+	}
+	return nil
+}
+
+// ZIncrBy implement KeyValueDB
+func (mk *MemoryKV) ZIncrBy(ctx context.Context, key string, member string, increment float64) (float64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+	e.zset[member] += increment
+	return e.zset[member], nil
+}
+
+// ZRem implement KeyValueDB, the key is deleted with its last member
+func (mk *MemoryKV) ZRem(ctx context.Context, key string, members ...string) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, false)
+	if err != nil || e == nil {
+		return err
+	}
+	for _, m := range members {
+		delete(e.zset, m)
+	}
+	if len(e.zset) == 0 {
+		delete(mk.entries, key)
+	}
+	return nil
+}
+
+// ZRevRangeWithScores implement KeyValueDB, negative indexes count from the lowest score like redis
+func (mk *MemoryKV) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]*driver.ZMember, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, false)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	members := sortedMembers(e.zset)
+	n := int64(len(members))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []*driver.ZMember{}, nil
+	}
+	return members[start : stop+1], nil
+}
+
+// ZRevRank implement KeyValueDB
+func (mk *MemoryKV) ZRevRank(ctx context.Context, key string, member string) (int64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		return -1, nil
+	}
+	for i, m := range sortedMembers(e.zset) {
+		if m.Member == member {
+			return int64(i), nil
+		}
+	}
+	return -1, nil
+}
+
+// ZScore implement KeyValueDB
+func (mk *MemoryKV) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	e, err := mk.lookupZSet(key, false)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.zset[member], nil
+}
+
+// sortedMembers members by descending score, ties are in descending lexicographical order like ZREVRANGE
+func sortedMembers(zset map[string]float64) []*driver.ZMember {
+	members := make([]*driver.ZMember, 0, len(zset))
+	for m, s := range zset {
+		members = append(members, &driver.ZMember{Member: m, Score: s})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score > members[j].Score
+		}
+		return members[i].Member > members[j].Member
+	})
+	return members
+}
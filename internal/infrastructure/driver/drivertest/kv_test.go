@@ -0,0 +1,287 @@
+package drivertest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+func newTestKV() (*MemoryKV, *FakeClock) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	return NewMemoryKV(clock), clock
+}
+
+func TestMemoryKVExpiration(t *testing.T) {
+	ctx := context.Background()
+	kv, clock := newTestKV()
+
+	kv.SetEX(ctx, "short", "a", time.Second)
+	kv.SetEX(ctx, "forever", "b", 0)
+	if ttl, err := kv.TTL(ctx, "short"); err != nil || ttl != time.Second {
+		t.Fatalf("TTL() = %s, %v, want 1s", ttl, err)
+	}
+	if ttl, err := kv.TTL(ctx, "forever"); err != nil || ttl != 0 {
+		t.Fatalf("TTL() = %s, %v, want 0", ttl, err)
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	if v, err := kv.Get(ctx, "short"); err != nil || v != "a" {
+		t.Fatalf("Get() = %q, %v before expiration", v, err)
+	}
+	clock.Advance(time.Millisecond)
+	if _, err := kv.Get(ctx, "short"); err != driver.ErrNotFound {
+		t.Fatalf("Get() error = %v, want %v after expiration", err, driver.ErrNotFound)
+	}
+	if ok, _ := kv.Exists(ctx, "short"); ok {
+		t.Fatal("Expired key still exists")
+	}
+	if _, err := kv.TTL(ctx, "short"); err != driver.ErrNotFound {
+		t.Fatalf("TTL() error = %v, want %v", err, driver.ErrNotFound)
+	}
+	if keys := kv.Keys(); !reflect.DeepEqual(keys, []string{"forever"}) {
+		t.Fatalf("Keys() = %v, want [forever]", keys)
+	}
+
+	// SetNX succeeds once the previous value expired
+	if ok, _ := kv.SetNX(ctx, "nx", "first", time.Minute); !ok {
+		t.Fatal("SetNX() failed on an absent key")
+	}
+	if ok, _ := kv.SetNX(ctx, "nx", "second", time.Minute); ok {
+		t.Fatal("SetNX() overwrote an existing key")
+	}
+	clock.Advance(time.Minute)
+	if ok, _ := kv.SetNX(ctx, "nx", "third", time.Minute); !ok {
+		t.Fatal("SetNX() failed on an expired key")
+	}
+
+	// Expire extends the lifetime, a non positive one deletes the key
+	kv.Expire(ctx, "nx", time.Hour)
+	clock.Advance(30 * time.Minute)
+	if v, _ := kv.Get(ctx, "nx"); v != "third" {
+		t.Fatalf("Get() = %q after Expire extended the lifetime", v)
+	}
+	kv.Expire(ctx, "nx", 0)
+	if ok, _ := kv.Exists(ctx, "nx"); ok {
+		t.Fatal("Expire(0) didn't delete the key")
+	}
+}
+
+func TestMemoryKVStrings(t *testing.T) {
+	ctx := context.Background()
+	kv, clock := newTestKV()
+
+	if _, err := kv.Get(ctx, "missing"); err != driver.ErrNotFound {
+		t.Fatalf("Get() error = %v, want %v", err, driver.ErrNotFound)
+	}
+	kv.MSet(ctx, map[string]string{"a": "1", "b": "2"}, time.Second)
+	kv.HSet(ctx, "hash", map[string]string{"f": "v"})
+	got, _ := kv.MGet(ctx, "a", "b", "missing", "hash")
+	if want := map[string]string{"a": "1", "b": "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("MGet() = %v, want %v", got, want)
+	}
+	if _, err := kv.Get(ctx, "hash"); err != ErrWrongType {
+		t.Fatalf("Get() error = %v on a hash, want %v", err, ErrWrongType)
+	}
+
+	kv.Del(ctx, "a", "missing")
+	if ok, _ := kv.Exists(ctx, "a"); ok {
+		t.Fatal("Del() didn't delete the key")
+	}
+
+	// the lifetime moves with the renamed value
+	if err := kv.Rename(ctx, "b", "c"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := kv.Rename(ctx, "b", "c"); err != ErrNoSuchKey {
+		t.Fatalf("Rename() error = %v, want %v", err, ErrNoSuchKey)
+	}
+	clock.Advance(time.Second)
+	if ok, _ := kv.Exists(ctx, "c"); ok {
+		t.Fatal("Renamed key didn't keep its lifetime")
+	}
+}
+
+func TestMemoryKVRenameFenced(t *testing.T) {
+	ctx := context.Background()
+	kv, clock := newTestKV()
+
+	kv.SetEX(ctx, "tmp", "2", 0)
+	if ok, err := kv.RenameFenced(ctx, "tmp", "board", 2, time.Minute); err != nil || !ok {
+		t.Fatalf("RenameFenced() = %v, %v", ok, err)
+	}
+	// a stale holder can't replace the value written with a greater token
+	kv.SetEX(ctx, "tmp", "1", 0)
+	if ok, err := kv.RenameFenced(ctx, "tmp", "board", 1, time.Minute); err != nil || ok {
+		t.Fatalf("RenameFenced() = %v, %v with a stale token", ok, err)
+	}
+	if v, _ := kv.Get(ctx, "board"); v != "2" {
+		t.Fatalf("Get() = %s, want the value of the greater token", v)
+	}
+	if ok, _ := kv.Exists(ctx, "tmp"); !ok {
+		t.Fatal("Refused RenameFenced() removed the key")
+	}
+
+	// a missing key deletes the target
+	kv.Del(ctx, "tmp")
+	if ok, err := kv.RenameFenced(ctx, "tmp", "board", 3, time.Minute); err != nil || !ok {
+		t.Fatalf("RenameFenced() = %v, %v", ok, err)
+	}
+	if ok, _ := kv.Exists(ctx, "board"); ok {
+		t.Fatal("RenameFenced() of a missing key kept the target")
+	}
+
+	// the fencing token expires with the target
+	clock.Advance(time.Minute)
+	kv.SetEX(ctx, "tmp", "1", 0)
+	if ok, err := kv.RenameFenced(ctx, "tmp", "board", 1, 0); err != nil || !ok {
+		t.Fatalf("RenameFenced() = %v, %v after the token expired", ok, err)
+	}
+}
+
+func TestMemoryKVCounters(t *testing.T) {
+	ctx := context.Background()
+	kv, clock := newTestKV()
+
+	if n, _ := kv.Incr(ctx, "hits", time.Minute); n != 1 {
+		t.Fatalf("Incr() = %d, want 1", n)
+	}
+	clock.Advance(30 * time.Second)
+	// the expiration is only set when the counter is created, like INCR followed by EXPIRE NX
+	if n, _ := kv.IncrBy(ctx, "hits", 5, time.Minute); n != 6 {
+		t.Fatalf("IncrBy() = %d, want 6", n)
+	}
+	if ttl, _ := kv.TTL(ctx, "hits"); ttl != 30*time.Second {
+		t.Fatalf("TTL() = %s, want 30s", ttl)
+	}
+	clock.Advance(30 * time.Second)
+	if n, _ := kv.Incr(ctx, "hits", 0); n != 1 {
+		t.Fatalf("Incr() = %d after the counter expired, want 1", n)
+	}
+
+	kv.SetEX(ctx, "name", "alice", 0)
+	if _, err := kv.Incr(ctx, "name", 0); err != ErrNotInt {
+		t.Fatalf("Incr() error = %v, want %v", err, ErrNotInt)
+	}
+	kv.HSet(ctx, "hash", map[string]string{"f": "v"})
+	if _, err := kv.Incr(ctx, "hash", 0); err != ErrWrongType {
+		t.Fatalf("Incr() error = %v, want %v", err, ErrWrongType)
+	}
+}
+
+func TestMemoryKVHashes(t *testing.T) {
+	ctx := context.Background()
+	kv, _ := newTestKV()
+
+	if all, err := kv.HGetAll(ctx, "h"); err != nil || len(all) != 0 {
+		t.Fatalf("HGetAll() = %v, %v on a missing key, want an empty map", all, err)
+	}
+	if _, err := kv.HGet(ctx, "h", "a"); err != driver.ErrNotFound {
+		t.Fatalf("HGet() error = %v, want %v", err, driver.ErrNotFound)
+	}
+
+	kv.HSet(ctx, "h", map[string]string{"a": "1", "b": "x"})
+	if _, err := kv.HGet(ctx, "h", "missing"); err != driver.ErrNotFound {
+		t.Fatalf("HGet() error = %v on a missing field, want %v", err, driver.ErrNotFound)
+	}
+	if n, _ := kv.HIncrBy(ctx, "h", "a", 2); n != 3 {
+		t.Fatalf("HIncrBy() = %d, want 3", n)
+	}
+	if n, _ := kv.HIncrBy(ctx, "h", "c", -1); n != -1 {
+		t.Fatalf("HIncrBy() = %d on a missing field, want -1", n)
+	}
+	if _, err := kv.HIncrBy(ctx, "h", "b", 1); err != ErrNotInt {
+		t.Fatalf("HIncrBy() error = %v, want %v", err, ErrNotInt)
+	}
+	all, _ := kv.HGetAll(ctx, "h")
+	if want := map[string]string{"a": "3", "b": "x", "c": "-1"}; !reflect.DeepEqual(all, want) {
+		t.Fatalf("HGetAll() = %v, want %v", all, want)
+	}
+
+	// the key is deleted with its last field
+	kv.HDel(ctx, "h", "a", "b")
+	if ok, _ := kv.Exists(ctx, "h"); !ok {
+		t.Fatal("HDel() deleted the key while fields are left")
+	}
+	kv.HDel(ctx, "h", "c")
+	if ok, _ := kv.Exists(ctx, "h"); ok {
+		t.Fatal("HDel() kept the key without fields")
+	}
+
+	kv.SetEX(ctx, "s", "v", 0)
+	if err := kv.HSet(ctx, "s", map[string]string{"a": "1"}); err != ErrWrongType {
+		t.Fatalf("HSet() error = %v on a string, want %v", err, ErrWrongType)
+	}
+}
+
+func TestMemoryKVSortedSets(t *testing.T) {
+	ctx := context.Background()
+	kv, _ := newTestKV()
+
+	kv.ZAdd(ctx, "z", &driver.ZMember{Member: "a", Score: 1}, &driver.ZMember{Member: "b", Score: 3}, &driver.ZMember{Member: "c", Score: 3})
+	if s, _ := kv.ZIncrBy(ctx, "z", "a", 4); s != 5 {
+		t.Fatalf("ZIncrBy() = %v, want 5", s)
+	}
+
+	// ties are in descending lexicographical order
+	members, _ := kv.ZRevRangeWithScores(ctx, "z", 0, -1)
+	want := []*driver.ZMember{{Member: "a", Score: 5}, {Member: "c", Score: 3}, {Member: "b", Score: 3}}
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("ZRevRangeWithScores() = %v, want %v", members, want)
+	}
+	if members, _ := kv.ZRevRangeWithScores(ctx, "z", 1, 10); len(members) != 2 || members[0].Member != "c" {
+		t.Fatalf("ZRevRangeWithScores(1, 10) = %v", members)
+	}
+	if members, _ := kv.ZRevRangeWithScores(ctx, "z", -1, -1); len(members) != 1 || members[0].Member != "b" {
+		t.Fatalf("ZRevRangeWithScores(-1, -1) = %v", members)
+	}
+	if rank, _ := kv.ZRevRank(ctx, "z", "b"); rank != 2 {
+		t.Fatalf("ZRevRank() = %d, want 2", rank)
+	}
+	if rank, _ := kv.ZRevRank(ctx, "z", "missing"); rank != -1 {
+		t.Fatalf("ZRevRank() = %d on a missing member, want -1", rank)
+	}
+
+	kv.ZRem(ctx, "z", "a", "b", "c")
+	if ok, _ := kv.Exists(ctx, "z"); ok {
+		t.Fatal("ZRem() kept the key without members")
+	}
+}
+
+func TestMemoryKVLocks(t *testing.T) {
+	ctx := context.Background()
+	kv, clock := newTestKV()
+
+	token, err := kv.AcquireLock(ctx, "job", "owner-1", time.Second)
+	if err != nil || token != 1 {
+		t.Fatalf("AcquireLock() = %d, %v, want token 1", token, err)
+	}
+	if token, _ := kv.AcquireLock(ctx, "job", "owner-2", time.Second); token != 0 {
+		t.Fatalf("AcquireLock() = %d while the lock is held, want 0", token)
+	}
+	if ok, _ := kv.RefreshLock(ctx, "job", "owner-2", time.Second); ok {
+		t.Fatal("RefreshLock() succeeded for another owner")
+	}
+	if ok, _ := kv.RefreshLock(ctx, "job", "owner-1", 2*time.Second); !ok {
+		t.Fatal("RefreshLock() failed for the owner")
+	}
+
+	// the lock expires, the fencing token keeps increasing
+	clock.Advance(2 * time.Second)
+	if token, _ := kv.AcquireLock(ctx, "job", "owner-2", time.Second); token != 2 {
+		t.Fatalf("AcquireLock() = %d after expiration, want 2", token)
+	}
+	if ok, _ := kv.ReleaseLock(ctx, "job", "owner-1"); ok {
+		t.Fatal("ReleaseLock() succeeded for a previous owner")
+	}
+	if ok, _ := kv.ReleaseLock(ctx, "job", "owner-2"); !ok {
+		t.Fatal("ReleaseLock() failed for the owner")
+	}
+
+	// only the fencing counter is left
+	if keys := kv.Keys(); len(keys) != 1 {
+		t.Fatalf("Keys() = %v after release, want the fencing counter only", keys)
+	}
+}
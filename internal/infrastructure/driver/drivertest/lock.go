@@ -0,0 +1,71 @@
+package drivertest
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+// MemoryKV stores locks under the same keys as driver.RedisClient, so driver.NewLocker works on it
+var _ driver.LockStore = &MemoryKV{}
+
+func memoryLockKeys(key string) (lock, fence string) {
+	return driver.RedisHashTag("lock:"+key, ""), driver.RedisHashTag("lock:"+key, ":fence")
+}
+
+// AcquireLock implement LockStore
+func (mk *MemoryKV) AcquireLock(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	lock, fence := memoryLockKeys(key)
+	if mk.lookup(lock) != nil {
+		return 0, nil
+	}
+	f, err := mk.lookupString(fence)
+	if err != nil {
+		return 0, err
+	}
+	if f == nil {
+		f = &kvEntry{value: "0"}
+		mk.entries[fence] = f
+	}
+	token, err := strconv.ParseInt(f.value, 10, 64)
+	if err != nil {
+		return 0, ErrNotInt
+	}
+	token++
+	f.value = strconv.FormatInt(token, 10)
+	mk.entries[lock] = &kvEntry{value: owner, expireAt: mk.expireAt(ttl)}
+	return token, nil
+}
+
+// RefreshLock implement LockStore
+func (mk *MemoryKV) RefreshLock(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	lock, _ := memoryLockKeys(key)
+	e, err := mk.lookupString(lock)
+	if err != nil || e == nil || e.value != owner {
+		return false, err
+	}
+	e.expireAt = mk.expireAt(ttl)
+	return true, nil
+}
+
+// ReleaseLock implement LockStore
+func (mk *MemoryKV) ReleaseLock(ctx context.Context, key string, owner string) (bool, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	lock, _ := memoryLockKeys(key)
+	e, err := mk.lookupString(lock)
+	if err != nil || e == nil || e.value != owner {
+		return false, err
+	}
+	delete(mk.entries, lock)
+	return true, nil
+}
@@ -0,0 +1,138 @@
+package drivertest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// Rows result set returned by an expected query, it can be returned by several queries
+type Rows struct {
+	columns []string
+	values  [][]interface{}
+	err     error
+}
+
+// NewRows create an empty result set with columns
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow append a row, values are in the order of columns and nil stands for NULL
+func (r *Rows) AddRow(values ...interface{}) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("drivertest: row has %d values, expected %d", len(values), len(r.columns)))
+	}
+	r.values = append(r.values, values)
+	return r
+}
+
+// WillFailWith stop the iteration with err after all rows are read, like a connection lost in the middle
+func (r *Rows) WillFailWith(err error) *Rows {
+	r.err = err
+	return r
+}
+
+func (r *Rows) cursor() *rowsCursor {
+	if r == nil {
+		return &rowsCursor{rows: &Rows{}, idx: -1}
+	}
+	return &rowsCursor{rows: r, idx: -1}
+}
+
+// rowsCursor ISQLRows iterating over Rows
+type rowsCursor struct {
+	rows   *Rows
+	idx    int
+	closed bool
+}
+
+func (rc *rowsCursor) Next() bool {
+	if rc.closed {
+		return false
+	}
+	rc.idx++
+	return rc.idx < len(rc.rows.values)
+}
+
+// Scan convert values like database/sql, NULL can be scanned into pointers and sql.Scanner
+func (rc *rowsCursor) Scan(dest ...interface{}) error {
+	if rc.closed || rc.idx < 0 || rc.idx >= len(rc.rows.values) {
+		return sql.ErrNoRows
+	}
+	row := rc.rows.values[rc.idx]
+	if len(dest) != len(row) {
+		return fmt.Errorf("drivertest: expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		if err := assign(d, row[i]); err != nil {
+			return fmt.Errorf("drivertest: converting column %s: %s", rc.rows.columns[i], err)
+		}
+	}
+	return nil
+}
+
+func (rc *rowsCursor) Columns() ([]string, error) {
+	return rc.rows.columns, nil
+}
+
+func (rc *rowsCursor) Err() error {
+	if rc.idx >= len(rc.rows.values) {
+		return rc.rows.err
+	}
+	return nil
+}
+
+func (rc *rowsCursor) Close() error {
+	rc.closed = true
+	return nil
+}
+
+// assign set value to what dest points to
+func assign(dest interface{}, value interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+	return assignValue(dv.Elem(), value)
+}
+
+func assignValue(v reflect.Value, value interface{}) error {
+	if reflect.PtrTo(v.Type()).Implements(scannerType) {
+		return v.Addr().Interface().(sql.Scanner).Scan(value)
+	}
+	if value == nil {
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			return fmt.Errorf("can't scan NULL into %s", v.Type())
+		}
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := assignValue(p.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	switch {
+	case src.Type().AssignableTo(v.Type()):
+		v.Set(src)
+	case v.Kind() == reflect.String && isNumber(src.Kind()):
+		v.SetString(fmt.Sprint(value))
+	case src.Type().ConvertibleTo(v.Type()) && !(src.Kind() == reflect.String && isNumber(v.Kind())):
+		v.Set(src.Convert(v.Type()))
+	default:
+		return fmt.Errorf("can't scan %T into %s", value, v.Type())
+	}
+	return nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
@@ -0,0 +1,228 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+)
+
+// portable database errors, match them with errors.Is. The driver error is kept in *Error
+var (
+	// ErrUniqueViolation insert or update violates a unique or primary key constraint
+	ErrUniqueViolation = errors.New("Unique constraint violated")
+	// ErrForeignKeyViolation referenced row doesn't exist, or it's still referenced
+	ErrForeignKeyViolation = errors.New("Foreign key constraint violated")
+	// ErrNotNullViolation NULL is written to a NOT NULL column
+	ErrNotNullViolation = errors.New("Not null constraint violated")
+	// ErrDeadlock transaction is chosen as the deadlock victim and rolled back
+	ErrDeadlock = errors.New("Deadlock detected")
+	// ErrSerializationFailure transaction can't be serialized with concurrent ones
+	ErrSerializationFailure = errors.New("Serialization failure")
+	// ErrConnectionLost connection to the database is broken, the statement may or may not have been executed
+	ErrConnectionLost = errors.New("Connection lost")
+)
+
+// Error driver error classified as one of the portable errors
+type Error struct {
+	Kind       error  // one of the portable errors
+	Constraint string // violated constraint(or column of not null violations), if the driver reports it
+	Err        error  // original driver error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the portable error as well as the wrapped driver error
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// IsRetryable whether the transaction failed because of concurrent ones and can be run again as a whole
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerializationFailure)
+}
+
+// ConstraintName name of the violated constraint, empty if err is not a constraint violation or the name is unknown
+func ConstraintName(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Constraint
+	}
+	return ""
+}
+
+// MySQL error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	mysqlDupEntry         = 1062
+	mysqlDupEntryWithKey  = 1586
+	mysqlBadNull          = 1048
+	mysqlNoDefault        = 1364
+	mysqlRowIsReferenced  = 1451
+	mysqlNoReferencedRow  = 1452
+	mysqlRowIsReferenced2 = 1217
+	mysqlNoReferencedRow2 = 1216
+	mysqlLockDeadlock     = 1213
+	mysqlServerShutdown   = 1053
+	mysqlConnectionKilled = 1927
+	mysqlServerGone       = 2006
+	mysqlServerLost       = 2013
+)
+
+// PostgreSQL SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgNotNullViolation     = "23502"
+	pgDeadlockDetected     = "40P01"
+	pgSerializationFailure = "40001"
+	pgAdminShutdown        = "57P01"
+	pgConnectionException  = "08" // class
+)
+
+// SQLite extended result codes, see https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy                 = 5 // primary code
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintNotNull    = 1299
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// sqlitePackage errors of the SQLite driver are recognized by reflection, so it's only linked into tests
+const sqlitePackage = "github.com/mattn/go-sqlite3"
+
+var (
+	mysqlKeyPattern        = regexp.MustCompile(`for key '([^']+)'`)
+	mysqlConstraintPattern = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	mysqlColumnPattern     = regexp.MustCompile(`(?:Column|Field) '([^']+)'`)
+)
+
+// classifyError wrap err as *Error if it's recognized, other errors are returned as they are
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var (
+		myErr      *mysql.MySQLError
+		pgErr      *pgconn.PgError
+		sqliteCode = sqliteErrorCode(err)
+	)
+	switch {
+	case errors.As(err, &myErr):
+		return classifyMySQLError(myErr, err)
+	case errors.As(err, &pgErr):
+		return classifyPgError(pgErr, err)
+	case sqliteCode != 0:
+		return classifySQLiteError(sqliteCode, err)
+	case isConnectionLost(err):
+		return &Error{Kind: ErrConnectionLost, Err: err}
+	}
+	return err
+}
+
+func classifyMySQLError(myErr *mysql.MySQLError, err error) error {
+	switch myErr.Number {
+	case mysqlDupEntry, mysqlDupEntryWithKey:
+		return &Error{Kind: ErrUniqueViolation, Constraint: submatch(mysqlKeyPattern, myErr.Message), Err: err}
+	case mysqlRowIsReferenced, mysqlNoReferencedRow, mysqlRowIsReferenced2, mysqlNoReferencedRow2:
+		return &Error{Kind: ErrForeignKeyViolation, Constraint: submatch(mysqlConstraintPattern, myErr.Message), Err: err}
+	case mysqlBadNull, mysqlNoDefault:
+		return &Error{Kind: ErrNotNullViolation, Constraint: submatch(mysqlColumnPattern, myErr.Message), Err: err}
+	case mysqlLockDeadlock:
+		return &Error{Kind: ErrDeadlock, Err: err}
+	case mysqlServerGone, mysqlServerLost, mysqlServerShutdown, mysqlConnectionKilled:
+		return &Error{Kind: ErrConnectionLost, Err: err}
+	}
+	return err
+}
+
+func classifyPgError(pgErr *pgconn.PgError, err error) error {
+	switch {
+	case pgErr.Code == pgUniqueViolation:
+		return &Error{Kind: ErrUniqueViolation, Constraint: pgErr.ConstraintName, Err: err}
+	case pgErr.Code == pgForeignKeyViolation:
+		return &Error{Kind: ErrForeignKeyViolation, Constraint: pgErr.ConstraintName, Err: err}
+	case pgErr.Code == pgNotNullViolation:
+		return &Error{Kind: ErrNotNullViolation, Constraint: pgErr.ColumnName, Err: err}
+	case pgErr.Code == pgDeadlockDetected:
+		return &Error{Kind: ErrDeadlock, Err: err}
+	case pgErr.Code == pgSerializationFailure:
+		return &Error{Kind: ErrSerializationFailure, Err: err}
+	case pgErr.Code == pgAdminShutdown || strings.HasPrefix(pgErr.Code, pgConnectionException):
+		return &Error{Kind: ErrConnectionLost, Err: err}
+	}
+	return err
+}
+
+// sqliteErrorCode extended result code of the SQLite error in the chain of err, 0 if there is none
+func sqliteErrorCode(err error) int64 {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if v.Kind() == reflect.Struct && v.Type().PkgPath() == sqlitePackage {
+			if code := v.FieldByName("ExtendedCode"); code.IsValid() {
+				return code.Int()
+			}
+		}
+	}
+	return 0
+}
+
+// classifySQLiteError the constraint is reported as table.column
+func classifySQLiteError(code int64, err error) error {
+	var constraint string
+	if i := strings.LastIndex(err.Error(), ": "); i >= 0 {
+		constraint = err.Error()[i+2:]
+	}
+	switch {
+	case code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey:
+		return &Error{Kind: ErrUniqueViolation, Constraint: constraint, Err: err}
+	case code == sqliteConstraintForeignKey:
+		return &Error{Kind: ErrForeignKeyViolation, Err: err}
+	case code == sqliteConstraintNotNull:
+		return &Error{Kind: ErrNotNullViolation, Constraint: constraint, Err: err}
+	case code&0xff == sqliteBusy:
+		// a concurrent transaction holds the write lock
+		return &Error{Kind: ErrSerializationFailure, Err: err}
+	}
+	return err
+}
+
+func isConnectionLost(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// the caller gave up, the connection itself may be fine and retrying elsewhere can't beat an expired context
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
+// submatch first capture group of pattern in s, the table prefix MySQL 8 adds to key names is removed
+func submatch(pattern *regexp.Regexp, s string) string {
+	m := pattern.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	name := m[1]
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
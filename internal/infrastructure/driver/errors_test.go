@@ -0,0 +1,156 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantKind       error
+		wantConstraint string
+	}{
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'user.uk_username'"},
+			ErrUniqueViolation, "uk_username"},
+		{"mysql 5.7 duplicate entry", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'uk_username'"},
+			ErrUniqueViolation, "uk_username"},
+		{"mysql row is referenced", &mysql.MySQLError{Number: 1451,
+			Message: "Cannot delete or update a parent row: a foreign key constraint fails (`db`.`progress`, CONSTRAINT `fk_progress_lesson` FOREIGN KEY (`lesson_id`) REFERENCES `lesson` (`id`))"},
+			ErrForeignKeyViolation, "fk_progress_lesson"},
+		{"mysql no referenced row", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"},
+			ErrForeignKeyViolation, ""},
+		{"mysql bad null", &mysql.MySQLError{Number: 1048, Message: "Column 'title' cannot be null"},
+			ErrNotNullViolation, "title"},
+		{"mysql no default", &mysql.MySQLError{Number: 1364, Message: "Field 'title' doesn't have a default value"},
+			ErrNotNullViolation, "title"},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+			ErrDeadlock, ""},
+		{"mysql server gone", &mysql.MySQLError{Number: 2006, Message: "MySQL server has gone away"},
+			ErrConnectionLost, ""},
+		{"mysql invalid connection", mysql.ErrInvalidConn, ErrConnectionLost, ""},
+		{"pg unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "uk_username"},
+			ErrUniqueViolation, "uk_username"},
+		{"pg foreign key violation", &pgconn.PgError{Code: "23503", ConstraintName: "fk_progress_lesson"},
+			ErrForeignKeyViolation, "fk_progress_lesson"},
+		{"pg not null violation", &pgconn.PgError{Code: "23502", ColumnName: "title"},
+			ErrNotNullViolation, "title"},
+		{"pg deadlock", &pgconn.PgError{Code: "40P01"}, ErrDeadlock, ""},
+		{"pg serialization failure", &pgconn.PgError{Code: "40001"}, ErrSerializationFailure, ""},
+		{"pg admin shutdown", &pgconn.PgError{Code: "57P01"}, ErrConnectionLost, ""},
+		{"pg connection exception", &pgconn.PgError{Code: "08006"}, ErrConnectionLost, ""},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy, ExtendedCode: sqlite3.ErrBusySnapshot},
+			ErrSerializationFailure, ""},
+		{"wrapped", fmt.Errorf("save lesson: %w", &pgconn.PgError{Code: "23505", ConstraintName: "uk_title"}),
+			ErrUniqueViolation, "uk_title"},
+		{"bad connection", sqldriver.ErrBadConn, ErrConnectionLost, ""},
+		{"unexpected eof", io.ErrUnexpectedEOF, ErrConnectionLost, ""},
+		{"network", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, ErrConnectionLost, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err)
+			if !errors.Is(err, tt.wantKind) {
+				t.Fatalf("classifyError() = %v, want %v", err, tt.wantKind)
+			}
+			if !errors.Is(err, tt.err) && !errors.Is(errors.Unwrap(err), tt.err) {
+				t.Errorf("classifyError() lost the driver error %v", tt.err)
+			}
+			if got := ConstraintName(err); got != tt.wantConstraint {
+				t.Errorf("ConstraintName() = %q, want %q", got, tt.wantConstraint)
+			}
+		})
+	}
+}
+
+// timeoutError net.Error of a read past its deadline
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyErrorUnrecognized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"nil", nil},
+		{"canceled", context.Canceled},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded)},
+		{"network timeout", &net.OpError{Op: "read", Err: timeoutError{}}},
+		{"network deadline", &net.OpError{Op: "dial", Err: context.DeadlineExceeded}},
+		{"network canceled", &net.OpError{Op: "dial", Err: context.Canceled}},
+		{"no rows", sql.ErrNoRows},
+		{"mysql syntax", &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}},
+		{"pg undefined table", &pgconn.PgError{Code: "42P01"}},
+		{"sqlite error", sqlite3.Error{Code: sqlite3.ErrError, ExtendedCode: sqlite3.ErrNoExtended(sqlite3.ErrError)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := classifyError(tt.err); err != tt.err {
+				t.Errorf("classifyError() = %#v, want the error as it is", err)
+			}
+		})
+	}
+}
+
+// TestClassifySQLiteError errors are produced by a real database, so the extended codes and messages are the driver's
+func TestClassifySQLiteError(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // every connection has its own in-memory database
+
+	for _, stmt := range []string{
+		`CREATE TABLE lesson (id INTEGER PRIMARY KEY, title TEXT NOT NULL UNIQUE)`,
+		`CREATE TABLE progress (lesson_id INTEGER NOT NULL REFERENCES lesson(id))`,
+		`INSERT INTO lesson(id, title) VALUES(1, 'intro')`,
+		`INSERT INTO progress(lesson_id) VALUES(1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to prepare database: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		stmt           string
+		wantKind       error
+		wantConstraint string
+	}{
+		{"unique", `INSERT INTO lesson(id, title) VALUES(2, 'intro')`, ErrUniqueViolation, "lesson.title"},
+		{"primary key", `INSERT INTO lesson(id, title) VALUES(1, 'other')`, ErrUniqueViolation, "lesson.id"},
+		{"not null", `INSERT INTO lesson(id) VALUES(3)`, ErrNotNullViolation, "lesson.title"},
+		{"no referenced row", `INSERT INTO progress(lesson_id) VALUES(9)`, ErrForeignKeyViolation, ""},
+		{"row is referenced", `DELETE FROM lesson WHERE id = 1`, ErrForeignKeyViolation, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Exec(tt.stmt)
+			if err == nil {
+				t.Fatalf("Expected %s to fail", tt.stmt)
+			}
+			err = classifyError(err)
+			if !errors.Is(err, tt.wantKind) {
+				t.Fatalf("classifyError() = %v, want %v", err, tt.wantKind)
+			}
+			if got := ConstraintName(err); got != tt.wantConstraint {
+				t.Errorf("ConstraintName() = %q, want %q", got, tt.wantConstraint)
+			}
+		})
+	}
+}
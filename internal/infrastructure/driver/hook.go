@@ -0,0 +1,113 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.uber.org/zap"
+)
+
+// QueryEvent an operation of a connection passed through QueryHook
+type QueryEvent struct {
+	Method    string        // Exec, Query, BulkInsert, BeginTx, Commit or RollBack
+	Query     string        // statement, empty for transaction control
+	Args      []interface{} // arguments of the statement
+	Table     string        // target table of BulkInsert
+	Columns   []string      // target columns of BulkInsert
+	Rows      int64         // inserted rows of BulkInsert
+	StartTime time.Time
+	Duration  time.Duration // set before AfterQuery
+	Err       error         // set before AfterQuery
+}
+
+// QueryHook intercept operations of a connection. Hooks are called in the order of registration
+// before the operation, and in the reverse order after it.
+//
+// BeforeQuery sees the portable statement and may rewrite Query and Args, AfterQuery sees the statement
+// translated for the dialect. If BeforeQuery returns an error the operation is skipped, the error is
+// returned to the caller and only the hooks called before are called after it
+type QueryHook interface {
+	// BeforeQuery the returned context is used by the operation and the following hooks
+	BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error)
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+// queryHooks hook chain of a connection
+type queryHooks []QueryHook
+
+// newQueryHooks built-in hooks followed by user hooks
+func newQueryHooks(cfg *DBConfig) queryHooks {
+	hooks := queryHooks{LoggingHook{}, &StatsHook{SlowThreshold: cfg.SlowQueryThreshold}}
+	return append(hooks, cfg.Hooks...)
+}
+
+// run op through the chain, op must set Query and Args of event to the statement actually sent
+func (qh queryHooks) run(ctx context.Context, event *QueryEvent, op func(ctx context.Context) error) error {
+	event.StartTime = time.Now()
+	var (
+		called int
+		err    error
+	)
+	for _, hook := range qh {
+		var next context.Context
+		if next, err = hook.BeforeQuery(ctx, event); err != nil {
+			break
+		}
+		ctx = next
+		called++
+	}
+	if err == nil {
+		err = classifyError(op(ctx))
+	}
+	event.Duration = time.Since(event.StartTime)
+	event.Err = err
+	for i := called - 1; i >= 0; i-- {
+		qh[i].AfterQuery(ctx, event)
+	}
+	return err
+}
+
+// LoggingHook log operations with the logger in context, at debug level if succeeded and at error level if failed
+type LoggingHook struct{}
+
+func (LoggingHook) BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (LoggingHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	logger := logging.ExtractLoggerFromContext(ctx)
+	fields := []zap.Field{zap.String("db.method", event.Method)}
+	if event.Query != "" {
+		fields = append(fields, zap.String("db.sql", event.Query), zap.Any("db.args", logQueryArgs(event.Args)))
+	}
+	if event.Table != "" {
+		// rows are not logged, there can be too many of them
+		fields = append(fields, zap.String("db.table", event.Table),
+			zap.Strings("db.columns", event.Columns),
+			zap.Int64("db.rows", event.Rows))
+	}
+	if event.Err != nil {
+		if shouldLogError(event.Err) {
+			logger.Error(event.Err.Error(), fields...)
+		}
+		return
+	}
+	logger.Debug("", append(fields, zap.Duration("db.time", event.Duration))...)
+}
+
+// StatsHook record statements in QueryStatistics, and log those slower than SlowThreshold at warn level
+type StatsHook struct {
+	SlowThreshold time.Duration // 0 to disable slow query logs
+}
+
+func (sh *StatsHook) BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (sh *StatsHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if event.Query == "" || event.Table != "" {
+		return
+	}
+	observeQuery(ctx, sh.SlowThreshold, event.Method, event.Query, event.Args, event.Duration, event.Err)
+}
@@ -1,11 +1,94 @@
 package driver
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
-// KeyValueDB define a key-value storage interface
+// ErrNotFound key(or hash field) doesn't exist
+var ErrNotFound = errors.New("Key not found")
+
+// KeyValueDB define a key-value storage interface.
+//
+// Expiration 0 means the key never expires
 type KeyValueDB interface {
-	SetEX(key string, value string, expiration time.Duration) error
-	Get(key string) (string, error)
-	Exists(key string) (bool, error)
-	Ping() error
+	SetEX(ctx context.Context, key string, value string, expiration time.Duration) error
+	// SetNX set key only if it doesn't exist, returns whether it's set
+	SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error)
+	// Get returns ErrNotFound if key doesn't exist
+	Get(ctx context.Context, key string) (string, error)
+	// MGet values of existing keys, absent keys are left out
+	MGet(ctx context.Context, keys ...string) (map[string]string, error)
+	// MSet set all values atomically, except for clustered stores
+	MSet(ctx context.Context, values map[string]string, expiration time.Duration) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+	// TTL remaining time to live of key, 0 if it never expires, ErrNotFound if it doesn't exist
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Rename atomically replace newKey with key, both keys must be on the same node of clustered stores
+	Rename(ctx context.Context, key string, newKey string) error
+	// RenameFenced Rename as the lock holder of token, refused if newKey was replaced with a greater token, which is
+	// kept beside newKey. newKey is deleted if key doesn't exist, and expires after expiration. Returns whether it's replaced
+	RenameFenced(ctx context.Context, key string, newKey string, token int64, expiration time.Duration) (bool, error)
+	Ping(ctx context.Context) error
+
+	// counters
+
+	// Incr same as IncrBy with delta 1
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	// IncrBy returns the new value, a missing key counts from 0. expiration is set if the key has none,
+	// so a counter created by the first increment expires after expiration
+	IncrBy(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error)
+
+	// hashes
+
+	HSet(ctx context.Context, key string, fields map[string]string) error
+	// HGet returns ErrNotFound if key or field doesn't exist
+	HGet(ctx context.Context, key string, field string) (string, error)
+	// HGetAll empty if key doesn't exist
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	// HIncrBy returns the new value of field
+	HIncrBy(ctx context.Context, key string, field string, delta int64) (int64, error)
+
+	// sorted set
+
+	ZAdd(ctx context.Context, key string, members ...*ZMember) error
+	// ZIncrBy returns the new score of member
+	ZIncrBy(ctx context.Context, key string, member string, increment float64) (float64, error)
+	ZRem(ctx context.Context, key string, members ...string) error
+	// ZRevRangeWithScores members ranked from start to stop(inclusive) by descending score
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]*ZMember, error)
+	// ZRevRank zero-based rank of member by descending score, -1 if member is absent
+	ZRevRank(ctx context.Context, key string, member string) (int64, error)
+	// ZScore score of member, 0 if member is absent
+	ZScore(ctx context.Context, key string, member string) (float64, error)
+}
+
+// ZMember member of a sorted set
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+const (
+	KVRoleMaster   = "master"
+	KVRoleReplica  = "replica"
+	KVRoleSentinel = "sentinel"
+)
+
+// KVNodeStatusModel health of a node of the key-value store
+type KVNodeStatusModel struct {
+	Addr    string `json:"addr"`
+	Role    string `json:"role"` // master, replica or sentinel
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"` // reason of being unhealthy
+}
+
+// KVNodeReporter key-value store able to report the health of each node
+type KVNodeReporter interface {
+	// NodeStatus the store can serve requests if all masters are healthy
+	NodeStatus(ctx context.Context) []*KVNodeStatusModel
 }
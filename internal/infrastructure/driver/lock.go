@@ -0,0 +1,184 @@
+package driver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLockNotAcquired lock is held by another owner
+	ErrLockNotAcquired = errors.New("Lock is held by another owner")
+	// ErrLockLost lock expired or was taken over before being released
+	ErrLockLost = errors.New("Lock is lost")
+)
+
+// LockStore storage of locks, implemented by KeyValueDB implementations able to run the operations atomically
+type LockStore interface {
+	// AcquireLock set key to owner for ttl if it doesn't exist, the returned fencing token is greater than
+	// those of all previous holders of key, 0 if key is held
+	AcquireLock(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error)
+	// RefreshLock reset the ttl of key if it's still held by owner, returns whether it is
+	RefreshLock(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLock delete key if it's still held by owner, returns whether it was
+	ReleaseLock(ctx context.Context, key string, owner string) (bool, error)
+}
+
+// Locker mutual exclusion of tasks across processes, like background jobs run by every replica
+type Locker interface {
+	// TryLock acquire key for ttl, ErrLockNotAcquired is returned if it's held
+	TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// WithLock run fn with the fencing token while holding key, the lock is renewed until fn returns and released afterwards.
+	// ErrLockNotAcquired is returned if key is held, without running fn. If the lock may be lost while fn is running,
+	// the context of fn is canceled and ErrLockLost is returned
+	WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context, token int64) error) error
+}
+
+// KVLocker Locker on a LockStore
+type KVLocker struct {
+	Store LockStore
+}
+
+var _ Locker = &KVLocker{}
+
+// NewLocker create a Locker storing locks in store
+func NewLocker(store LockStore) *KVLocker {
+	return &KVLocker{Store: store}
+}
+
+// Lock lock held by this process
+type Lock struct {
+	store LockStore
+	key   string
+	owner string
+	token int64
+}
+
+// Key name of the lock
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token fencing token, pass it along with writes so storages can reject those of stale holders
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Refresh extend the lock by ttl, ErrLockLost is returned if it's no longer held
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	ok, err := l.store.RefreshLock(ctx, l.key, l.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release unlock, ErrLockLost is returned if it's no longer held
+func (l *Lock) Release(ctx context.Context) error {
+	ok, err := l.store.ReleaseLock(ctx, l.key, l.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// TryLock implement Locker
+func (kl *KVLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+	token, err := kl.Store.AcquireLock(ctx, key, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrLockNotAcquired
+	}
+	return &Lock{store: kl.Store, key: key, owner: owner, token: token}, nil
+}
+
+// WithLock implement Locker, the lock is renewed every third of ttl. Failed renewals are retried, but the context
+// of fn is canceled a third of ttl before the lock would expire since the last successful one, leaving fn time
+// to stop before another process can take over. The lock expires by itself if releasing it fails, so the result
+// of a finished fn is returned regardless
+func (kl *KVLocker) WithLock(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context, token int64) error) error {
+	margin := ttl / 3
+	acquired := time.Now()
+	lock, err := kl.TryLock(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	var (
+		wg   sync.WaitGroup
+		lost bool
+		done = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(margin)
+		defer ticker.Stop()
+		// the lock lives for ttl from the start of the last successful request at least
+		deadline := acquired.Add(ttl - margin)
+		expired := time.NewTimer(time.Until(deadline))
+		defer expired.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-expired.C:
+				lost = true
+				cancel()
+				return
+			case <-ticker.C:
+			}
+			start := time.Now()
+			refreshCtx, refreshCancel := context.WithDeadline(ctx, deadline)
+			err := lock.Refresh(refreshCtx, ttl)
+			refreshCancel()
+			if err == ErrLockLost {
+				lost = true
+				cancel()
+				return
+			}
+			if err == nil {
+				deadline = start.Add(ttl - margin)
+				if !expired.Stop() {
+					<-expired.C
+				}
+				expired.Reset(time.Until(deadline))
+			}
+		}
+	}()
+
+	err = fn(fnCtx, lock.Token())
+	close(done)
+	wg.Wait()
+	cancel()
+	if lost {
+		return ErrLockLost
+	}
+	lock.Release(ctx)
+	return err
+}
+
+// lockOwner random identifier of a lock holder
+func lockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,139 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+)
+
+const lockTTL = 60 * time.Millisecond
+
+// flakyLockStore fails renewals, or reports the lock gone on release
+type flakyLockStore struct {
+	*drivertest.MemoryKV
+	refreshErr  error
+	releaseLost bool
+}
+
+func (fs *flakyLockStore) RefreshLock(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	if fs.refreshErr != nil {
+		return false, fs.refreshErr
+	}
+	return fs.MemoryKV.RefreshLock(ctx, key, owner, ttl)
+}
+
+func (fs *flakyLockStore) ReleaseLock(ctx context.Context, key string, owner string) (bool, error) {
+	if fs.releaseLost {
+		return false, nil
+	}
+	return fs.MemoryKV.ReleaseLock(ctx, key, owner)
+}
+
+func TestWithLock(t *testing.T) {
+	ctx := context.Background()
+	locker := driver.NewLocker(drivertest.NewMemoryKV(nil))
+
+	for want := int64(1); want <= 2; want++ {
+		var got int64
+		err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error {
+			got = token
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithLock() error = %v", err)
+		}
+		// released afterwards, the next holder gets a greater token
+		if got != want {
+			t.Fatalf("token = %d, want %d", got, want)
+		}
+	}
+
+	failed := errors.New("failed")
+	if err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error { return failed }); err != failed {
+		t.Fatalf("WithLock() error = %v, want %v", err, failed)
+	}
+}
+
+func TestWithLockHeld(t *testing.T) {
+	ctx := context.Background()
+	locker := driver.NewLocker(drivertest.NewMemoryKV(nil))
+
+	// renewed while fn runs longer than ttl
+	err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error {
+		time.Sleep(3 * lockTTL)
+		err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error {
+			t.Error("fn run while the lock is held")
+			return nil
+		})
+		if err != driver.ErrLockNotAcquired {
+			t.Errorf("WithLock() error = %v, want %v", err, driver.ErrLockNotAcquired)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("WithLock() error = %v", err)
+	}
+}
+
+func TestWithLockLost(t *testing.T) {
+	ctx := context.Background()
+	kv := drivertest.NewMemoryKV(nil)
+	locker := driver.NewLocker(kv)
+
+	err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error {
+		// taken over by another owner
+		for _, key := range kv.Keys() {
+			kv.Del(ctx, key)
+		}
+		if _, err := kv.AcquireLock(ctx, "job", "another", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("fn wasn't canceled")
+		}
+		return nil
+	})
+	if err != driver.ErrLockLost {
+		t.Fatalf("WithLock() error = %v, want %v", err, driver.ErrLockLost)
+	}
+}
+
+func TestWithLockRenewalFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyLockStore{MemoryKV: drivertest.NewMemoryKV(nil), refreshErr: errors.New("connection refused")}
+	locker := driver.NewLocker(store)
+
+	start := time.Now()
+	err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("fn wasn't canceled")
+		}
+		// stopped before another process could acquire the lock
+		if elapsed := time.Since(start); elapsed >= lockTTL {
+			t.Errorf("fn canceled after %s, the lock expires after %s", elapsed, lockTTL)
+		}
+		return ctx.Err()
+	})
+	if err != driver.ErrLockLost {
+		t.Fatalf("WithLock() error = %v, want %v", err, driver.ErrLockLost)
+	}
+}
+
+func TestWithLockReleaseLost(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyLockStore{MemoryKV: drivertest.NewMemoryKV(nil), releaseLost: true}
+	locker := driver.NewLocker(store)
+
+	err := locker.WithLock(ctx, "job", lockTTL, func(ctx context.Context, token int64) error { return nil })
+	if err != nil {
+		t.Fatalf("WithLock() error = %v after fn succeeded", err)
+	}
+}
@@ -3,25 +3,36 @@ package driver
 import (
 	"context"
 	"database/sql"
-	"strings"
-	"time"
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
-	"go.uber.org/zap"
 )
 
 // SQLWrapper Wraps a *sql.db object and provides the implementation of ITransactionalDB.
 //
-// it uses zap for default logging
+// operations are passed through the hooks, which log them with zap by default
 type SQLWrapper struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect Dialect
+	hooks   queryHooks
 }
 
 // SQLWrapperTx transaction wrapper
 type SQLWrapperTx struct {
-	tx *sql.Tx
+	tx      *sql.Tx
+	dialect Dialect
+	hooks   queryHooks
+}
+
+// SQLQueryResult query result of database/sql, errors during iteration are classified
+type SQLQueryResult struct {
+	rows *sql.Rows
+}
+
+// sqlExecutor statement methods shared by *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
 // NewMySQLConn Returns a MySQL connection pool
@@ -31,27 +42,38 @@ func NewMySQLConn(dsn string, cfg *DBConfig) (ITransactionalDB, error) {
 		return nil, err
 	}
 	conn.SetMaxOpenConns(int(cfg.MaxConn))
-	return &SQLWrapper{conn}, err
+	return NewSQLWrapper(conn, DialectMySQL, cfg), err
+}
+
+// NewSQLWrapper wrap a database/sql pool speaking dialect d, like a SQLite database opened by tests
+func NewSQLWrapper(db *sql.DB, d Dialect, cfg *DBConfig) *SQLWrapper {
+	return &SQLWrapper{db, d, newQueryHooks(cfg)}
+}
+
+func (sr SQLQueryResult) Next() bool {
+	return sr.rows.Next()
+}
+func (sr SQLQueryResult) Scan(dest ...interface{}) (err error) {
+	return sr.rows.Scan(dest...)
+}
+func (sr SQLQueryResult) Columns() ([]string, error) {
+	return sr.rows.Columns()
+}
+func (sr SQLQueryResult) Err() error {
+	return classifyError(sr.rows.Err())
+}
+func (sr SQLQueryResult) Close() error {
+	return sr.rows.Close()
 }
 
 // BeginTx start a new transaction context
 func (mw *SQLWrapper) BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	txConfig := mysqlTxOptionAdapter(opts)
-	tx, err := mw.db.BeginTx(ctx, txConfig)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "BeginTx"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "BeginTx"),
-		)
-	}
-	return &SQLWrapperTx{tx}, err
+	var tx *sql.Tx
+	err := mw.hooks.run(ctx, &QueryEvent{Method: "BeginTx"}, func(ctx context.Context) (err error) {
+		tx, err = mw.db.BeginTx(ctx, mysqlTxOptionAdapter(opts))
+		return err
+	})
+	return &SQLWrapperTx{tx, mw.dialect, mw.hooks}, err
 }
 
 func mysqlTxOptionAdapter(opts *TxOptions) *sql.TxOptions {
@@ -83,47 +105,20 @@ func (mw *SQLWrapper) Close(ctx context.Context) error {
 }
 
 func (mw *SQLWrapper) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	query = mysqlAdapter(query)
-	res, err := mw.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Exec"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Exec"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return res, err
+	return sqlExec(ctx, mw.hooks, mw.db, mw.dialect, query, args)
 }
 
 func (mw *SQLWrapper) QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
+	return sqlQuery(ctx, mw.hooks, mw.db, mw.dialect, query, args)
+}
 
-	query = mysqlAdapter(query)
-	rows, err := mw.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Query"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Query"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return rows, err
+func (mw *SQLWrapper) sqlDialect() Dialect {
+	return mw.dialect
+}
+
+// BulkInsert send chunked multi-row INSERT statements
+func (mw *SQLWrapper) BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error) {
+	return sqlBulkInsert(ctx, mw.hooks, mw.db, mw.dialect, table, columns, src)
 }
 
 func (mwt *SQLWrapperTx) BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error) {
@@ -131,81 +126,32 @@ func (mwt *SQLWrapperTx) BeginTx(ctx context.Context, opts *TxOptions) (ITransac
 }
 
 func (mwt *SQLWrapperTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	query = mysqlAdapter(query)
-	res, err := mwt.tx.ExecContext(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Exec"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Exec"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return res, err
+	return sqlExec(ctx, mwt.hooks, mwt.tx, mwt.dialect, query, args)
 }
 
 func (mwt *SQLWrapperTx) QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
+	return sqlQuery(ctx, mwt.hooks, mwt.tx, mwt.dialect, query, args)
+}
 
-	query = mysqlAdapter(query)
-	rows, err := mwt.tx.QueryContext(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Query"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Query"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return rows, err
+func (mwt *SQLWrapperTx) sqlDialect() Dialect {
+	return mwt.dialect
+}
+
+// BulkInsert send chunked multi-row INSERT statements
+func (mwt *SQLWrapperTx) BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error) {
+	return sqlBulkInsert(ctx, mwt.hooks, mwt.tx, mwt.dialect, table, columns, src)
 }
 
 func (mwt *SQLWrapperTx) Commit(ctx context.Context) error {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-	err := mwt.tx.Commit()
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "Commit"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Commit"),
-		)
-	}
-	return err
+	return mwt.hooks.run(ctx, &QueryEvent{Method: "Commit"}, func(ctx context.Context) error {
+		return mwt.tx.Commit()
+	})
 }
 
 func (mwt *SQLWrapperTx) Rollback(ctx context.Context) error {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-	err := mwt.tx.Rollback()
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "RollBack"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "RollBack"),
-		)
-	}
-	return err
+	return mwt.hooks.run(ctx, &QueryEvent{Method: "RollBack"}, func(ctx context.Context) error {
+		return mwt.tx.Rollback()
+	})
 }
 
 func (mwt *SQLWrapperTx) Ping() error {
@@ -216,9 +162,43 @@ func (mwt *SQLWrapperTx) Close(ctx context.Context) error {
 	return nil
 }
 
-func mysqlAdapter(query string) string {
-	query = strings.Replace(query, "\"", "`", -1)
-	query = DollarPlaceholderPattern.ReplaceAllString(query, "?")
-	query = SpacePattern.ReplaceAllString(query, " ")
-	return query
+func sqlExec(ctx context.Context, hooks queryHooks, db sqlExecutor, d Dialect, query string, args []interface{}) (sql.Result, error) {
+	var res sql.Result
+	event := &QueryEvent{Method: "Exec", Query: query, Args: args}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		if event.Query, event.Args, err = Translate(d, event.Query, event.Args); err != nil {
+			return err
+		}
+		res, err = db.ExecContext(ctx, event.Query, event.Args...)
+		return err
+	})
+	return res, err
+}
+
+func sqlQuery(ctx context.Context, hooks queryHooks, db sqlExecutor, d Dialect, query string, args []interface{}) (ISQLRows, error) {
+	var rows *sql.Rows
+	event := &QueryEvent{Method: "Query", Query: query, Args: args}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		if event.Query, event.Args, err = Translate(d, event.Query, event.Args); err != nil {
+			return err
+		}
+		rows, err = db.QueryContext(ctx, event.Query, event.Args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SQLQueryResult{rows}, nil
+}
+
+func sqlBulkInsert(ctx context.Context, hooks queryHooks, db sqlExecutor, d Dialect, table string, columns []string, src RowSource) (int64, error) {
+	if err := checkBulkColumns(columns); err != nil {
+		return 0, err
+	}
+	event := &QueryEvent{Method: "BulkInsert", Table: table, Columns: columns}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		event.Rows, err = chunkedInsert(ctx, db.ExecContext, d, table, columns, src)
+		return err
+	})
+	return event.Rows, err
 }
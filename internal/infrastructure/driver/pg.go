@@ -3,32 +3,45 @@ package driver
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"strings"
-	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
-	"go.uber.org/zap"
 )
 
+// PGWrapper Wraps a pgx pool and provides the implementation of ITransactionalDB.
+//
+// operations are passed through the hooks, which log them with zap by default
 type PGWrapper struct {
-	db *pgxpool.Pool
+	db    *pgxpool.Pool
+	hooks queryHooks
 }
 
 type PGWrapperTx struct {
-	tx pgx.Tx
+	tx    pgx.Tx
+	hooks queryHooks
 }
 
 type PGExecResult struct {
 	ct pgconn.CommandTag
 }
 
+// errLastInsertIDUnsupported returned by PGExecResult.LastInsertId
+var errLastInsertIDUnsupported = errors.New("LastInsertId is not supported by PostgreSQL, use InsertID")
+
 type PGQueryResult struct {
 	rows pgx.Rows
 }
 
+// pgExecutor statement methods shared by *pgxpool.Pool and pgx.Tx
+type pgExecutor interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
 // NewPostgreSQLConn Returns a postgreSQL connection pool
 func NewPostgreSQLConn(dsn string, cfg *DBConfig) (ITransactionalDB, error) {
 	poolConfig, err := pgxpool.ParseConfig(dsn)
@@ -39,11 +52,12 @@ func NewPostgreSQLConn(dsn string, cfg *DBConfig) (ITransactionalDB, error) {
 	// the lib will handle logging
 	poolConfig.MaxConns = cfg.MaxConn
 	conn, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
-	return &PGWrapper{conn}, err
+	return &PGWrapper{conn, newQueryHooks(cfg)}, err
 }
 
+// LastInsertId PostgreSQL doesn't report generated ids, use InsertID
 func (pr PGExecResult) LastInsertId() (int64, error) {
-	return 0, nil
+	return 0, errLastInsertIDUnsupported
 }
 
 func (pr PGExecResult) RowsAffected() (int64, error) {
@@ -56,28 +70,29 @@ func (pr PGQueryResult) Next() bool {
 func (pr PGQueryResult) Scan(dest ...interface{}) (err error) {
 	return pr.rows.Scan(dest...)
 }
+func (pr PGQueryResult) Columns() ([]string, error) {
+	fields := pr.rows.FieldDescriptions()
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = string(f.Name)
+	}
+	return columns, nil
+}
+func (pr PGQueryResult) Err() error {
+	return classifyError(pr.rows.Err())
+}
 func (pr PGQueryResult) Close() error {
 	pr.rows.Close()
 	return nil
 }
 
 func (pw *PGWrapper) BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	txConfig := pgTxOptionAdapter(opts)
-	tx, err := pw.db.BeginTx(ctx, txConfig)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "BeginTx"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "BeginTx"),
-		)
-	}
-	return &PGWrapperTx{tx}, err
+	var tx pgx.Tx
+	err := pw.hooks.run(ctx, &QueryEvent{Method: "BeginTx"}, func(ctx context.Context) (err error) {
+		tx, err = pw.db.BeginTx(ctx, pgTxOptionAdapter(opts))
+		return err
+	})
+	return &PGWrapperTx{tx, pw.hooks}, err
 }
 
 func pgTxOptionAdapter(opts *TxOptions) pgx.TxOptions {
@@ -115,7 +130,13 @@ func (pw *PGWrapper) Rollback(ctx context.Context) error {
 }
 
 func (pw *PGWrapper) Ping() error {
-	return nil
+	ctx := context.Background()
+	conn, err := pw.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return conn.Conn().Ping(ctx)
 }
 
 // Close close the whole pool, you better know what you are doing
@@ -125,47 +146,24 @@ func (pw *PGWrapper) Close(ctx context.Context) error {
 }
 
 func (pw *PGWrapper) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	query = pgsqlAdapter(query)
-	res, err := pw.db.Exec(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Exec"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Exec"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return &PGExecResult{res}, err
+	return pgExec(ctx, pw.hooks, pw.db, query, args)
 }
 
 func (pw *PGWrapper) QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
+	return pgQuery(ctx, pw.hooks, pw.db, query, args)
+}
 
-	query = pgsqlAdapter(query)
-	rows, err := pw.db.Query(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Query"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Query"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return &PGQueryResult{rows}, err
+// BulkInsert use the COPY protocol
+func (pw *PGWrapper) BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error) {
+	return pgBulkInsert(ctx, pw.hooks, pw.db, table, columns, src)
+}
+
+func (pw *PGWrapper) sqlDialect() Dialect {
+	return DialectPostgreSQL
+}
+
+func (pw *PGWrapper) insertID(ctx context.Context, query string, args []interface{}) (int64, error) {
+	return pgInsertID(ctx, pw.hooks, pw.db, query, args)
 }
 
 func (pwt *PGWrapperTx) BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error) {
@@ -173,81 +171,36 @@ func (pwt *PGWrapperTx) BeginTx(ctx context.Context, opts *TxOptions) (ITransact
 }
 
 func (pwt *PGWrapperTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-
-	query = pgsqlAdapter(query)
-	res, err := pwt.tx.Exec(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Exec"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Exec"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return &PGExecResult{res}, err
+	return pgExec(ctx, pwt.hooks, pwt.tx, query, args)
 }
 
 func (pwt *PGWrapperTx) QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error) {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
+	return pgQuery(ctx, pwt.hooks, pwt.tx, query, args)
+}
 
-	query = pgsqlAdapter(query)
-	rows, err := pwt.tx.Query(ctx, query, args...)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.sql", query),
-				zap.String("db.method", "Query"),
-				zap.Any("db.args", logQueryArgs(args)))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.String("db.sql", query),
-			zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Query"),
-			zap.Any("db.args", logQueryArgs(args)))
-	}
-	return &PGQueryResult{rows}, err
+// BulkInsert use the COPY protocol
+func (pwt *PGWrapperTx) BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error) {
+	return pgBulkInsert(ctx, pwt.hooks, pwt.tx, table, columns, src)
+}
+
+func (pwt *PGWrapperTx) sqlDialect() Dialect {
+	return DialectPostgreSQL
+}
+
+func (pwt *PGWrapperTx) insertID(ctx context.Context, query string, args []interface{}) (int64, error) {
+	return pgInsertID(ctx, pwt.hooks, pwt.tx, query, args)
 }
 
 func (pwt *PGWrapperTx) Commit(ctx context.Context) error {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-	err := pwt.tx.Commit(ctx)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "Commit"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "Commit"),
-		)
-	}
-	return err
+	return pwt.hooks.run(ctx, &QueryEvent{Method: "Commit"}, func(ctx context.Context) error {
+		return pwt.tx.Commit(ctx)
+	})
 }
 
 func (pwt *PGWrapperTx) Rollback(ctx context.Context) error {
-	logger := logging.ExtractLoggerFromContext(ctx)
-	startTime := time.Now()
-	err := pwt.tx.Rollback(ctx)
-	if err != nil {
-		if shouldLogError(err) {
-			logger.Error(err.Error(), zap.String("db.method", "RollBack"))
-		}
-	} else {
-		endTime := time.Now()
-		logger.Debug("", zap.Duration("db.time", endTime.Sub(startTime)),
-			zap.String("db.method", "RollBack"),
-		)
-	}
-	return err
+	return pwt.hooks.run(ctx, &QueryEvent{Method: "RollBack"}, func(ctx context.Context) error {
+		return pwt.tx.Rollback(ctx)
+	})
 }
 
 func (pwt *PGWrapperTx) Ping() error {
@@ -258,6 +211,65 @@ func (pwt *PGWrapperTx) Close(ctx context.Context) error {
 	return nil
 }
 
-func pgsqlAdapter(query string) string {
-	return SpacePattern.ReplaceAllString(query, " ")
+func pgExec(ctx context.Context, hooks queryHooks, db pgExecutor, query string, args []interface{}) (sql.Result, error) {
+	var ct pgconn.CommandTag
+	event := &QueryEvent{Method: "Exec", Query: query, Args: args}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		if event.Query, event.Args, err = Translate(DialectPostgreSQL, event.Query, event.Args); err != nil {
+			return err
+		}
+		ct, err = db.Exec(ctx, event.Query, event.Args...)
+		return err
+	})
+	return &PGExecResult{ct}, err
+}
+
+func pgQuery(ctx context.Context, hooks queryHooks, db pgExecutor, query string, args []interface{}) (ISQLRows, error) {
+	var rows pgx.Rows
+	event := &QueryEvent{Method: "Query", Query: query, Args: args}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		if event.Query, event.Args, err = Translate(DialectPostgreSQL, event.Query, event.Args); err != nil {
+			return err
+		}
+		rows, err = db.Query(ctx, event.Query, event.Args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PGQueryResult{rows}, nil
+}
+
+// pgInsertID append RETURNING id to the INSERT statement and read it
+func pgInsertID(ctx context.Context, hooks queryHooks, db pgExecutor, query string, args []interface{}) (int64, error) {
+	query = strings.TrimRight(query, " \t\r\n;") + " RETURNING id"
+	rows, err := pgQuery(ctx, hooks, db, query, args)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var id int64
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrNoRows
+	}
+	if err := rows.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, rows.Err()
+}
+
+func pgBulkInsert(ctx context.Context, hooks queryHooks, db pgExecutor, table string, columns []string, src RowSource) (int64, error) {
+	if err := checkBulkColumns(columns); err != nil {
+		return 0, err
+	}
+	event := &QueryEvent{Method: "BulkInsert", Table: table, Columns: columns}
+	err := hooks.run(ctx, event, func(ctx context.Context) (err error) {
+		event.Rows, err = db.CopyFrom(ctx, pgx.Identifier{table}, columns, src)
+		return err
+	})
+	return event.Rows, err
 }
@@ -2,59 +2,600 @@ package driver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"go.elastic.co/apm"
 )
 
-var ctx = context.Background()
+const (
+	// RedisStandalone a single server
+	RedisStandalone = "standalone"
+	// RedisSentinel master discovered from sentinels, Addrs are sentinel addresses
+	RedisSentinel = "sentinel"
+	// RedisCluster Addrs are seed nodes of the cluster
+	RedisCluster = "cluster"
+)
+
+// RedisConfig options of NewRedisClient
+type RedisConfig struct {
+	Mode             string   // standalone, sentinel or cluster, standalone if empty
+	Addrs            []string // server, sentinel or cluster seed addresses(host:port)
+	MasterName       string   // master name monitored by sentinels, sentinel mode only
+	Password         string   // server password
+	SentinelPassword string   // sentinel password, sentinel mode only
+	DB               int      // database index, must be 0 in cluster mode
+	PoolSize         int      // maximum connections per node, 0 for the default(10 per CPU)
+	MinIdleConns     int      // idle connections kept per node
+	TLS              bool     // connect with TLS
+	TLSSkipVerify    bool     // don't verify server certificates
+	TLSCAFile        string   // PEM encoded CA certificates to verify servers, system roots are used if empty
+	TLSServerName    string   // server name to verify, the host of the address if empty
+}
 
 // RedisClient .
 type RedisClient struct {
-	conn *redis.Client
+	conn       redis.UniversalClient
+	mode       string
+	addrs      []string
+	masterName string
+	sentinels  []*redis.SentinelClient // sentinel mode only, for health checks
 }
 
 // interface assertion
-var _ KeyValueDB = &RedisClient{}
+var (
+	_ KeyValueDB     = &RedisClient{}
+	_ KVNodeReporter = &RedisClient{}
+	_ LockStore      = &RedisClient{}
+)
 
-// NewRedisClient create an redis client
-func NewRedisClient(host string, port int, password string) *RedisClient {
-	conn := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", host, port),
-		Password: password,
-	})
-	return &RedisClient{
-		conn: conn,
+// incrByScript INCRBY and set the expiration(milliseconds) if the key has none, atomically
+var incrByScript = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v`)
+
+// acquireLockScript SET NX PX the lock(KEYS[1]) to the owner and return the next fencing token from KEYS[2], 0 if it's held
+var acquireLockScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+
+// refreshLockScript PEXPIRE the lock if it's held by the owner
+var refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLockScript DEL the lock if it's held by the owner
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// renameFencedScript RENAME KEYS[1] to KEYS[2] unless the fencing token in KEYS[3] is greater than ARGV[1], which
+// then replaces it. KEYS[2] and KEYS[3] expire after ARGV[2] milliseconds if it's positive
+var renameFencedScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[3]) or '0') > tonumber(ARGV[1]) then
+	return 0
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+else
+	redis.call('DEL', KEYS[2])
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+	redis.call('SET', KEYS[3], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[3], ARGV[1])
+end
+return 1`)
+
+// NewRedisClient create an redis client of cfg.Mode
+func NewRedisClient(cfg *RedisConfig) (*RedisClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("at least one redis address is required")
+	}
+	tlsConfig, err := redisTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opt := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		DB:               cfg.DB,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		MasterName:       cfg.MasterName,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		TLSConfig:        tlsConfig,
+	}
+
+	rdb := &RedisClient{mode: cfg.Mode, addrs: cfg.Addrs, masterName: cfg.MasterName}
+	switch cfg.Mode {
+	case RedisStandalone, "":
+		if len(cfg.Addrs) > 1 {
+			return nil, fmt.Errorf("standalone mode takes one address, got %d", len(cfg.Addrs))
+		}
+		rdb.mode = RedisStandalone
+		rdb.conn = redis.NewClient(opt.Simple())
+	case RedisSentinel:
+		if cfg.MasterName == "" {
+			return nil, errors.New("master name is required in sentinel mode")
+		}
+		rdb.conn = redis.NewFailoverClient(opt.Failover())
+		for _, addr := range cfg.Addrs {
+			rdb.sentinels = append(rdb.sentinels, redis.NewSentinelClient(&redis.Options{
+				Addr:      addr,
+				Password:  cfg.SentinelPassword,
+				PoolSize:  1,
+				TLSConfig: tlsConfig,
+			}))
+		}
+	case RedisCluster:
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("cluster mode only supports database 0, got %d", cfg.DB)
+		}
+		rdb.conn = redis.NewClusterClient(opt.Cluster())
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+	rdb.conn.AddHook(redisAPMHook{})
+	return rdb, nil
+}
+
+func redisTLSConfig(cfg *RedisConfig) (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
 	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+		ServerName:         cfg.TLSServerName,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in redis CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Close close connections to all nodes
+func (rdb *RedisClient) Close() error {
+	err := rdb.conn.Close()
+	for _, s := range rdb.sentinels {
+		s.Close()
+	}
+	return err
+}
+
+// cluster whether keys may live on different nodes, in which case multi-key commands are split per key
+func (rdb *RedisClient) cluster() bool {
+	return rdb.mode == RedisCluster
+}
+
+// redisError map redis.Nil to ErrNotFound
+func redisError(err error) error {
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	return err
 }
 
 // SetEX implement KeyValueDB
-func (rdb *RedisClient) SetEX(key string, value string, expiration time.Duration) error {
+func (rdb *RedisClient) SetEX(ctx context.Context, key string, value string, expiration time.Duration) error {
 	return rdb.conn.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX implement KeyValueDB
+func (rdb *RedisClient) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	return rdb.conn.SetNX(ctx, key, value, expiration).Result()
+}
+
 // Get implement KeyValueDB
-func (rdb *RedisClient) Get(key string) (string, error) {
-	cmd := rdb.conn.Get(ctx, key)
-	return cmd.Result()
+func (rdb *RedisClient) Get(ctx context.Context, key string) (string, error) {
+	v, err := rdb.conn.Get(ctx, key).Result()
+	return v, redisError(err)
+}
+
+// MGet implement KeyValueDB
+func (rdb *RedisClient) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	if rdb.cluster() {
+		cmds := make([]*redis.StringCmd, len(keys))
+		_, err := rdb.conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, k := range keys {
+				cmds[i] = pipe.Get(ctx, k)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			if v, err := cmd.Result(); err == nil {
+				result[keys[i]] = v
+			}
+		}
+		return result, nil
+	}
+	values, err := rdb.conn.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			result[keys[i]] = s
+		}
+	}
+	return result, nil
+}
+
+// MSet implement KeyValueDB, keys with expiration are set in a transaction since MSET can't expire keys.
+// In cluster mode keys are set by a pipeline, which isn't atomic
+func (rdb *RedisClient) MSet(ctx context.Context, values map[string]string, expiration time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if rdb.cluster() {
+		_, err := rdb.conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for k, v := range values {
+				pipe.Set(ctx, k, v, expiration)
+			}
+			return nil
+		})
+		return err
+	}
+	if expiration == 0 {
+		pairs := make([]interface{}, 0, len(values)*2)
+		for k, v := range values {
+			pairs = append(pairs, k, v)
+		}
+		return rdb.conn.MSet(ctx, pairs...).Err()
+	}
+	_, err := rdb.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for k, v := range values {
+			pipe.Set(ctx, k, v, expiration)
+		}
+		return nil
+	})
+	return err
 }
 
 // Exists implement KeyValueDB
-func (rdb *RedisClient) Exists(key string) (bool, error) {
+func (rdb *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
 	cmd := rdb.conn.Exists(ctx, key)
 	ok, err := cmd.Result()
 	return ok == 1, err
 }
 
+// Del implement KeyValueDB
+func (rdb *RedisClient) Del(ctx context.Context, keys ...string) error {
+	if rdb.cluster() && len(keys) > 1 {
+		_, err := rdb.conn.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, k := range keys {
+				pipe.Del(ctx, k)
+			}
+			return nil
+		})
+		return err
+	}
+	return rdb.conn.Del(ctx, keys...).Err()
+}
+
+// Expire implement KeyValueDB
+func (rdb *RedisClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return rdb.conn.Expire(ctx, key, expiration).Err()
+}
+
+// TTL implement KeyValueDB
+func (rdb *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := rdb.conn.PTTL(ctx, key).Result()
+	switch {
+	case err != nil:
+		return 0, err
+	case ttl == -2:
+		return 0, ErrNotFound
+	case ttl == -1:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Rename implement KeyValueDB, in cluster mode both keys must hash to the same slot, see RedisHashTag
+func (rdb *RedisClient) Rename(ctx context.Context, key string, newKey string) error {
+	return rdb.conn.Rename(ctx, key, newKey).Err()
+}
+
+// RenameFenced implement KeyValueDB
+func (rdb *RedisClient) RenameFenced(ctx context.Context, key string, newKey string, token int64, expiration time.Duration) (bool, error) {
+	keys := []string{key, newKey, RedisFenceKey(newKey)}
+	n, err := renameFencedScript.Run(ctx, rdb.conn, keys, token, expiration.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+// Incr implement KeyValueDB
+func (rdb *RedisClient) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	return rdb.IncrBy(ctx, key, 1, expiration)
+}
+
+// IncrBy implement KeyValueDB
+func (rdb *RedisClient) IncrBy(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	return incrByScript.Run(ctx, rdb.conn, []string{key}, delta, expiration.Milliseconds()).Int64()
+}
+
+// HSet implement KeyValueDB
+func (rdb *RedisClient) HSet(ctx context.Context, key string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	pairs := make([]interface{}, 0, len(fields)*2)
+	for f, v := range fields {
+		pairs = append(pairs, f, v)
+	}
+	return rdb.conn.HSet(ctx, key, pairs...).Err()
+}
+
+// HGet implement KeyValueDB
+func (rdb *RedisClient) HGet(ctx context.Context, key string, field string) (string, error) {
+	v, err := rdb.conn.HGet(ctx, key, field).Result()
+	return v, redisError(err)
+}
+
+// HGetAll implement KeyValueDB
+func (rdb *RedisClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return rdb.conn.HGetAll(ctx, key).Result()
+}
+
+// HDel implement KeyValueDB
+func (rdb *RedisClient) HDel(ctx context.Context, key string, fields ...string) error {
+	return rdb.conn.HDel(ctx, key, fields...).Err()
+}
+
+// HIncrBy implement KeyValueDB
+func (rdb *RedisClient) HIncrBy(ctx context.Context, key string, field string, delta int64) (int64, error) {
+	return rdb.conn.HIncrBy(ctx, key, field, delta).Result()
+}
+
+// ZAdd implement KeyValueDB
+func (rdb *RedisClient) ZAdd(ctx context.Context, key string, members ...*ZMember) error {
+	zs := make([]*redis.Z, len(members))
+	for i, m := range members {
+		zs[i] = &redis.Z{Member: m.Member, Score: m.Score}
+	}
+	return rdb.conn.ZAdd(ctx, key, zs...).Err()
+}
+
+// ZIncrBy implement KeyValueDB
+func (rdb *RedisClient) ZIncrBy(ctx context.Context, key string, member string, increment float64) (float64, error) {
+	return rdb.conn.ZIncrBy(ctx, key, increment, member).Result()
+}
+
+// ZRem implement KeyValueDB
+func (rdb *RedisClient) ZRem(ctx context.Context, key string, members ...string) error {
+	ms := make([]interface{}, len(members))
+	for i, m := range members {
+		ms[i] = m
+	}
+	return rdb.conn.ZRem(ctx, key, ms...).Err()
+}
+
+// ZRevRangeWithScores implement KeyValueDB
+func (rdb *RedisClient) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]*ZMember, error) {
+	zs, err := rdb.conn.ZRevRangeWithScores(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*ZMember, len(zs))
+	for i, z := range zs {
+		members[i] = &ZMember{Member: fmt.Sprint(z.Member), Score: z.Score}
+	}
+	return members, nil
+}
+
+// ZRevRank implement KeyValueDB
+func (rdb *RedisClient) ZRevRank(ctx context.Context, key string, member string) (int64, error) {
+	rank, err := rdb.conn.ZRevRank(ctx, key, member).Result()
+	if err == redis.Nil {
+		return -1, nil
+	}
+	return rank, err
+}
+
+// ZScore implement KeyValueDB
+func (rdb *RedisClient) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	score, err := rdb.conn.ZScore(ctx, key, member).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return score, err
+}
+
 // Ping health check
-func (rdb *RedisClient) Ping() error {
+func (rdb *RedisClient) Ping(ctx context.Context) error {
 	cmd := rdb.conn.Ping(ctx)
 	if r, err := cmd.Result(); err != nil {
 		return err
 	} else if r != "PONG" {
-		return errors.New("")
+		return fmt.Errorf("Unexpected reply to PING: %s", r)
 	}
 	return nil
 }
+
+// redisLockKeys keys of the lock and its fencing token counter, in the same hash slot
+func redisLockKeys(key string) []string {
+	return []string{RedisHashTag("lock:"+key, ""), RedisHashTag("lock:"+key, ":fence")}
+}
+
+// AcquireLock implement LockStore
+func (rdb *RedisClient) AcquireLock(ctx context.Context, key string, owner string, ttl time.Duration) (int64, error) {
+	return acquireLockScript.Run(ctx, rdb.conn, redisLockKeys(key), owner, ttl.Milliseconds()).Int64()
+}
+
+// RefreshLock implement LockStore
+func (rdb *RedisClient) RefreshLock(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	n, err := refreshLockScript.Run(ctx, rdb.conn, redisLockKeys(key)[:1], owner, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+// ReleaseLock implement LockStore
+func (rdb *RedisClient) ReleaseLock(ctx context.Context, key string, owner string) (bool, error) {
+	n, err := releaseLockScript.Run(ctx, rdb.conn, redisLockKeys(key)[:1], owner).Int64()
+	return n == 1, err
+}
+
+// RedisFenceKey key of the greatest fencing token that replaced key by RenameFenced, in the same hash slot
+func RedisFenceKey(key string) string {
+	return RedisHashTag(key, ":fence")
+}
+
+// RedisHashTag key sharing the hash slot of key in cluster mode, for keys used together by Rename
+func RedisHashTag(key, suffix string) string {
+	return "{" + key + "}" + suffix
+}
+
+// NodeStatus implement KVNodeReporter
+func (rdb *RedisClient) NodeStatus(ctx context.Context) []*KVNodeStatusModel {
+	switch rdb.mode {
+	case RedisCluster:
+		return rdb.clusterStatus(ctx)
+	case RedisSentinel:
+		return rdb.sentinelStatus(ctx)
+	}
+	return []*KVNodeStatusModel{pingNode(ctx, rdb.addrs[0], KVRoleMaster, rdb.Ping)}
+}
+
+// clusterStatus status of nodes known from the cluster state, seed nodes are reported if the state can't be loaded
+func (rdb *RedisClient) clusterStatus(ctx context.Context) []*KVNodeStatusModel {
+	var (
+		mu     sync.Mutex
+		nodes  []*KVNodeStatusModel
+		client = rdb.conn.(*redis.ClusterClient)
+	)
+	collect := func(role string) func(context.Context, *redis.Client) error {
+		return func(ctx context.Context, node *redis.Client) error {
+			status := pingNode(ctx, node.Options().Addr, role, func(ctx context.Context) error {
+				return node.Ping(ctx).Err()
+			})
+			mu.Lock()
+			nodes = append(nodes, status)
+			mu.Unlock()
+			return nil
+		}
+	}
+	if err := client.ForEachMaster(ctx, collect(KVRoleMaster)); err != nil {
+		for _, addr := range rdb.addrs {
+			nodes = append(nodes, &KVNodeStatusModel{Addr: addr, Role: KVRoleMaster, Error: err.Error()})
+		}
+		return nodes
+	}
+	client.ForEachSlave(ctx, collect(KVRoleReplica))
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Role != nodes[j].Role {
+			return nodes[i].Role == KVRoleMaster
+		}
+		return nodes[i].Addr < nodes[j].Addr
+	})
+	return nodes
+}
+
+// sentinelStatus status of the current master and each sentinel
+func (rdb *RedisClient) sentinelStatus(ctx context.Context) []*KVNodeStatusModel {
+	nodes := make([]*KVNodeStatusModel, 0, len(rdb.sentinels)+1)
+	master := rdb.masterName
+	for i, s := range rdb.sentinels {
+		s := s
+		status := pingNode(ctx, rdb.addrs[i], KVRoleSentinel, func(ctx context.Context) error {
+			return s.Ping(ctx).Err()
+		})
+		if status.Healthy && master == rdb.masterName {
+			if addr, err := s.GetMasterAddrByName(ctx, rdb.masterName).Result(); err == nil && len(addr) == 2 {
+				master = net.JoinHostPort(addr[0], addr[1])
+			}
+		}
+		nodes = append(nodes, status)
+	}
+	return append([]*KVNodeStatusModel{pingNode(ctx, master, KVRoleMaster, rdb.Ping)}, nodes...)
+}
+
+func pingNode(ctx context.Context, addr, role string, ping func(context.Context) error) *KVNodeStatusModel {
+	status := &KVNodeStatusModel{Addr: addr, Role: role, Healthy: true}
+	if err := ping(ctx); err != nil {
+		status.Healthy = false
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// redisAPMHook report each command(or pipeline) as a span of the transaction in context
+type redisAPMHook struct{}
+
+// redisSpanKey span started by redisAPMHook, dropped spans are not in context otherwise
+type redisSpanKey struct{}
+
+func (redisAPMHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return startRedisSpan(ctx, strings.ToUpper(cmd.Name())), nil
+}
+
+func (redisAPMHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (redisAPMHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return startRedisSpan(ctx, "PIPELINE"), nil
+}
+
+func (redisAPMHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil {
+			break
+		}
+	}
+	endRedisSpan(ctx, err)
+	return nil
+}
+
+func startRedisSpan(ctx context.Context, name string) context.Context {
+	span, ctx := apm.StartSpan(ctx, name, "db.redis")
+	span.Context.SetDatabase(apm.DatabaseSpanContext{Type: "redis"})
+	return context.WithValue(ctx, redisSpanKey{}, span)
+}
+
+// endRedisSpan a missing key isn't reported as an error
+func endRedisSpan(ctx context.Context, err error) {
+	span, ok := ctx.Value(redisSpanKey{}).(*apm.Span)
+	if !ok {
+		return
+	}
+	if err != nil && err != redis.Nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	span.End()
+}
@@ -0,0 +1,166 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type primaryContextKey struct{}
+
+// WithPrimary route all queries of ctx to the primary, so writes made earlier are visible to reads
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryContextKey{}).(bool)
+	return v
+}
+
+// ReplicaRouter ITransactionalDB sending reads outside of transactions to read replicas.
+//
+// Replicas are picked round-robin among healthy ones, the primary is used if none is healthy.
+// Writes, bulk inserts, transactions and reads of contexts created by WithPrimary go to the primary
+type ReplicaRouter struct {
+	primary  ITransactionalDB
+	replicas []*replica
+	next     uint32
+	logger   *zap.Logger
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type replica struct {
+	addr    string
+	conn    ITransactionalDB
+	healthy int32 // accessed atomically, 1 if healthy
+}
+
+var _ ITransactionalDB = &ReplicaRouter{}
+
+// NewReplicaRouter create a router over primary and replicas(keyed by address), replicas are pinged every checkInterval
+func NewReplicaRouter(primary ITransactionalDB, replicas map[string]ITransactionalDB, checkInterval time.Duration, logger *zap.Logger) *ReplicaRouter {
+	rr := &ReplicaRouter{
+		primary: primary,
+		logger:  logger,
+		stop:    make(chan struct{}),
+	}
+	for addr, conn := range replicas {
+		rr.replicas = append(rr.replicas, &replica{addr: addr, conn: conn, healthy: 1})
+	}
+	if len(rr.replicas) > 0 && checkInterval > 0 {
+		go rr.checkHealth(checkInterval)
+	}
+	return rr
+}
+
+func (rr *ReplicaRouter) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rr.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, r := range rr.replicas {
+			rr.setHealthy(r, r.conn.Ping())
+		}
+	}
+}
+
+// setHealthy update health state of r from the result of a ping or query, transitions are logged
+func (rr *ReplicaRouter) setHealthy(r *replica, err error) {
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&r.healthy, 0, 1) {
+			rr.logger.Info("Replica is back online", zap.String("db.host", r.addr))
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&r.healthy, 1, 0) {
+		rr.logger.Warn("Replica is unhealthy", zap.String("db.host", r.addr), zap.Error(err))
+	}
+}
+
+// pick next healthy replica, nil if there is none
+func (rr *ReplicaRouter) pick() *replica {
+	n := uint32(len(rr.replicas))
+	for i := uint32(0); i < n; i++ {
+		r := rr.replicas[atomic.AddUint32(&rr.next, 1)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+func (rr *ReplicaRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (ISQLRows, error) {
+	if usePrimary(ctx) {
+		return rr.primary.QueryContext(ctx, query, args...)
+	}
+	r := rr.pick()
+	if r == nil {
+		return rr.primary.QueryContext(ctx, query, args...)
+	}
+	rows, err := r.conn.QueryContext(ctx, query, args...)
+	if errors.Is(err, ErrConnectionLost) {
+		rr.setHealthy(r, err)
+		return rr.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (rr *ReplicaRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return rr.primary.ExecContext(ctx, query, args...)
+}
+
+func (rr *ReplicaRouter) BulkInsert(ctx context.Context, table string, columns []string, src RowSource) (int64, error) {
+	return rr.primary.BulkInsert(ctx, table, columns, src)
+}
+
+func (rr *ReplicaRouter) sqlDialect() Dialect {
+	return DialectOf(rr.primary)
+}
+
+// insertID the INSERT is sent to the primary even if it's run as a query
+func (rr *ReplicaRouter) insertID(ctx context.Context, query string, args []interface{}) (int64, error) {
+	return InsertID(ctx, rr.primary, query, args...)
+}
+
+// BeginTx transactions always run on the primary
+func (rr *ReplicaRouter) BeginTx(ctx context.Context, opts *TxOptions) (ITransactionalDB, error) {
+	return rr.primary.BeginTx(ctx, opts)
+}
+
+func (rr *ReplicaRouter) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (rr *ReplicaRouter) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// Ping only the primary is checked, reads fall back to it if replicas are down
+func (rr *ReplicaRouter) Ping() error {
+	return rr.primary.Ping()
+}
+
+// Close stop health checks and close the primary and all replicas
+func (rr *ReplicaRouter) Close(ctx context.Context) error {
+	rr.once.Do(func() {
+		close(rr.stop)
+	})
+	err := rr.primary.Close(ctx)
+	for _, r := range rr.replicas {
+		if cerr := r.conn.Close(ctx); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package driver
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.elastic.co/apm"
+	"go.uber.org/zap"
+)
+
+// transaction retry counters, exposed at /debug/vars
+var (
+	txRetries   = expvar.NewInt("db.tx_retries")   // retried attempts
+	txExhausted = expvar.NewInt("db.tx_exhausted") // units of work that still failed after the last attempt
+)
+
+// TxRetryConfig retry policy of TxRunner
+type TxRetryConfig struct {
+	MaxAttempts int           // attempts of a unit of work, including the first one
+	BaseDelay   time.Duration // backoff before the first retry, doubled on each retry
+	MaxDelay    time.Duration // upper bound of backoff
+}
+
+// TxRunner run units of work in transactions, the whole unit is run again if it fails with
+// a deadlock or serialization failure(see IsRetryable).
+//
+// A unit of work may run several times, so it must not have side effects outside the transaction
+// (like writing the response) and must reset the state it captures at the beginning
+type TxRunner struct {
+	conn   ITransactionalDB
+	config TxRetryConfig
+}
+
+// NewTxRunner create a TxRunner on conn, zero fields of cfg are replaced with defaults
+func NewTxRunner(conn ITransactionalDB, cfg *TxRetryConfig) *TxRunner {
+	config := TxRetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   20 * time.Millisecond,
+		MaxDelay:    500 * time.Millisecond,
+	}
+	if cfg != nil {
+		if cfg.MaxAttempts > 0 {
+			config.MaxAttempts = cfg.MaxAttempts
+		}
+		if cfg.BaseDelay > 0 {
+			config.BaseDelay = cfg.BaseDelay
+		}
+		if cfg.MaxDelay > 0 {
+			config.MaxDelay = cfg.MaxDelay
+		}
+	}
+	return &TxRunner{conn, config}
+}
+
+// RunInTx run fn in a transaction started with opts, it's committed if fn returns nil and rolled back otherwise.
+//
+// Retrying stops when the attempts are used up, or the backoff would pass the deadline of ctx.
+// The error of the last attempt is returned
+func (tr *TxRunner) RunInTx(ctx context.Context, opts *TxOptions, fn func(tx ITransactionalDB) error) error {
+	logger := logging.ExtractLoggerFromContext(ctx)
+	delay := tr.config.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := tr.runOnce(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) {
+			recordTxAttempts(ctx, attempt)
+			return err
+		}
+		if attempt >= tr.config.MaxAttempts {
+			txExhausted.Add(1)
+			recordTxAttempts(ctx, attempt)
+			logger.Warn("Transaction retries exhausted", zap.Int("db.attempts", attempt), zap.Error(err))
+			return err
+		}
+
+		// full jitter, spread out the transactions that collided
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			recordTxAttempts(ctx, attempt)
+			return err
+		}
+		txRetries.Add(1)
+		logger.Debug("Retry transaction", zap.Int("db.attempt", attempt+1),
+			zap.Duration("db.backoff", wait),
+			zap.String("error.message", err.Error()))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > tr.config.MaxDelay {
+			delay = tr.config.MaxDelay
+		}
+	}
+}
+
+func (tr *TxRunner) runOnce(ctx context.Context, opts *TxOptions, fn func(tx ITransactionalDB) error) (err error) {
+	tx, err := tr.conn.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+	return fn(tx)
+}
+
+// recordTxAttempts label the APM transaction of ctx, if any
+func recordTxAttempts(ctx context.Context, attempts int) {
+	if attempts <= 1 {
+		return
+	}
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		tx.Context.SetLabel("db_tx_attempts", attempts)
+	}
+}
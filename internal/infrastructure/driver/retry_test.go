@@ -0,0 +1,163 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.uber.org/zap/zaptest"
+)
+
+var (
+	deadlock       = &driver.Error{Kind: driver.ErrDeadlock, Err: errors.New("deadlock")}
+	unserializable = &driver.Error{Kind: driver.ErrSerializationFailure, Err: errors.New("could not serialize")}
+)
+
+func testContext(t *testing.T) context.Context {
+	return logging.SetLoggerInContext(context.Background(), zaptest.NewLogger(t))
+}
+
+func fastRetry(attempts int) *driver.TxRetryConfig {
+	return &driver.TxRetryConfig{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+}
+
+func touch(ctx context.Context) func(tx driver.ITransactionalDB) error {
+	return func(tx driver.ITransactionalDB) error {
+		_, err := tx.ExecContext(ctx, `UPDATE "t" SET "n" = "n" + 1`)
+		return err
+	}
+}
+
+func TestRunInTxRetriesDeadlock(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnError(deadlock)
+	db.ExpectRollback()
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnResult(0, 1)
+	db.ExpectCommit()
+
+	if err := driver.NewTxRunner(db, fastRetry(3)).RunInTx(ctx, nil, touch(ctx)); err != nil {
+		t.Fatalf("RunInTx() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxRetriesFailedCommit(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnResult(0, 1)
+	db.ExpectCommit().WillReturnError(unserializable)
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnResult(0, 1)
+	db.ExpectCommit()
+
+	if err := driver.NewTxRunner(db, fastRetry(3)).RunInTx(ctx, nil, touch(ctx)); err != nil {
+		t.Fatalf("RunInTx() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxExhausted(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	for i := 0; i < 2; i++ {
+		db.ExpectBegin()
+		db.ExpectExec(`UPDATE "t"`).WillReturnError(deadlock)
+		db.ExpectRollback()
+	}
+
+	err := driver.NewTxRunner(db, fastRetry(2)).RunInTx(ctx, nil, touch(ctx))
+	if !errors.Is(err, driver.ErrDeadlock) {
+		t.Fatalf("RunInTx() error = %v, want %v", err, driver.ErrDeadlock)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxDoesNotRetryOtherErrors(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	violation := &driver.Error{Kind: driver.ErrUniqueViolation, Err: errors.New("duplicate")}
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnError(violation)
+	db.ExpectRollback()
+
+	err := driver.NewTxRunner(db, fastRetry(3)).RunInTx(ctx, nil, touch(ctx))
+	if !errors.Is(err, driver.ErrUniqueViolation) {
+		t.Fatalf("RunInTx() error = %v, want %v", err, driver.ErrUniqueViolation)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxStopsBeforeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(testContext(t), 50*time.Millisecond)
+	defer cancel()
+	db := drivertest.NewFakeDB()
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnError(deadlock)
+	db.ExpectRollback()
+
+	// the backoff is far longer than the deadline, so the error is returned instead of waiting
+	runner := driver.NewTxRunner(db, &driver.TxRetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	start := time.Now()
+	err := runner.RunInTx(ctx, nil, touch(ctx))
+	if !errors.Is(err, driver.ErrDeadlock) {
+		t.Fatalf("RunInTx() error = %v, want %v", err, driver.ErrDeadlock)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("RunInTx() waited %s before giving up", elapsed)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(testContext(t))
+	db := drivertest.NewFakeDB()
+	db.ExpectBegin()
+	db.ExpectExec(`UPDATE "t"`).WillReturnError(deadlock)
+	db.ExpectRollback()
+
+	runner := driver.NewTxRunner(db, &driver.TxRetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := runner.RunInTx(ctx, nil, touch(ctx)); err != context.Canceled {
+		t.Fatalf("RunInTx() error = %v, want %v", err, context.Canceled)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunInTxRollsBackOnPanic(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	db.ExpectBegin()
+	db.ExpectRollback()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected the panic to be propagated")
+		}
+		if err := db.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	driver.NewTxRunner(db, fastRetry(3)).RunInTx(ctx, nil, func(tx driver.ITransactionalDB) error {
+		panic("boom")
+	})
+}
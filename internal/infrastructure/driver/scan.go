@@ -0,0 +1,186 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRows returned by Get if the query yields no row
+var ErrNoRows = sql.ErrNoRows
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// fieldMaps cache of column to field index paths for each struct type
+var fieldMaps sync.Map
+
+// SelectAll run query and append every row to dest, which must be a pointer to a slice.
+//
+// Struct elements(or pointers to struct) are filled by matching column names against the db tag of fields,
+// the lower cased field name is used if a field has no tag, and `db:"-"` skips a field. Fields of embedded
+// structs are promoted. NULL is scanned as the zero value unless the field is a pointer or a sql.Scanner.
+// Other element types are scanned from a single column
+func SelectAll(ctx context.Context, db ITransactionalDB, dest interface{}, query string, args ...interface{}) error {
+	sv := reflect.ValueOf(dest)
+	if sv.Kind() != reflect.Ptr || sv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice, got %T", dest)
+	}
+	slice := sv.Elem()
+	elemType := slice.Type().Elem()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var elem reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			elem = reflect.New(elemType.Elem())
+			err = scanValue(rows, columns, elem.Elem())
+		} else {
+			elem = reflect.New(elemType).Elem()
+			err = scanValue(rows, columns, elem)
+		}
+		if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	return rows.Err()
+}
+
+// Get run query and scan the first row into dest, which must be a pointer. See SelectAll for the mapping rules.
+//
+// ErrNoRows is returned if there is no row
+func Get(ctx context.Context, db ITransactionalDB, dest interface{}, query string, args ...interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("dest must be a non-nil pointer, got %T", dest)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrNoRows
+	}
+	if err := scanValue(rows, columns, dv.Elem()); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// scanValue scan the current row into v, which must be addressable
+func scanValue(rows ISQLRows, columns []string, v reflect.Value) error {
+	if !isStruct(v.Type()) {
+		if len(columns) != 1 {
+			return fmt.Errorf("scanning %d columns into %s, use a struct instead", len(columns), v.Type())
+		}
+		return scanFields(rows, []reflect.Value{v})
+	}
+
+	fm := getFieldMap(v.Type())
+	fields := make([]reflect.Value, len(columns))
+	for i, column := range columns {
+		index, ok := fm[strings.ToLower(column)]
+		if !ok {
+			return fmt.Errorf("column %s has no destination field in %s", column, v.Type())
+		}
+		fields[i] = v.FieldByIndex(index)
+	}
+	return scanFields(rows, fields)
+}
+
+// scanFields scan a row into fields, NULL is converted to the zero value of fields that can't hold it
+func scanFields(rows ISQLRows, fields []reflect.Value) error {
+	dest := make([]interface{}, len(fields))
+	holders := make([]reflect.Value, len(fields))
+	for i, f := range fields {
+		if f.Kind() == reflect.Ptr || f.Addr().Type().Implements(scannerType) {
+			dest[i] = f.Addr().Interface()
+			continue
+		}
+		// drivers scan NULL into a pointer to pointer as nil
+		holders[i] = reflect.New(reflect.PtrTo(f.Type()))
+		dest[i] = holders[i].Interface()
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	for i, h := range holders {
+		if !h.IsValid() {
+			continue
+		}
+		if p := h.Elem(); p.IsNil() {
+			fields[i].Set(reflect.Zero(fields[i].Type()))
+		} else {
+			fields[i].Set(p.Elem())
+		}
+	}
+	return nil
+}
+
+// isStruct whether t is a struct mapped field by field, rather than a single column value
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+func getFieldMap(t reflect.Type) map[string][]int {
+	if fm, ok := fieldMaps.Load(t); ok {
+		return fm.(map[string][]int)
+	}
+	fm := make(map[string][]int)
+	buildFieldMap(t, nil, fm)
+	fieldMaps.Store(t, fm)
+	return fm
+}
+
+func buildFieldMap(t reflect.Type, prefix []int, fm map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		index := append(append([]int{}, prefix...), i)
+		if f.Anonymous && tag == "" && isStruct(f.Type) {
+			buildFieldMap(f.Type, index, fm)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToLower(name)
+		// fields of the outer struct take precedence over promoted ones
+		if _, ok := fm[name]; !ok || len(fm[name]) > len(index) {
+			fm[name] = index
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package driver
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxQueryFingerprints statements of new fingerprints are counted as overflow once there are this many
+	maxQueryFingerprints = 1000
+	// queryLatencySamples latest latencies kept for each fingerprint to compute percentiles
+	queryLatencySamples = 256
+)
+
+// QueryStatModel aggregated statistics of statements sharing a fingerprint, durations are in nanoseconds
+type QueryStatModel struct {
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Total       time.Duration `json:"total"`
+	Max         time.Duration `json:"max"`
+	P95         time.Duration `json:"p95"` // of the latest samples
+}
+
+// QueryStats in-process statistics of executed statements grouped by normalized SQL
+type QueryStats struct {
+	mu       sync.Mutex
+	entries  map[string]*queryStat
+	overflow int64
+}
+
+type queryStat struct {
+	QueryStatModel
+	samples []time.Duration // ring buffer
+	next    int
+}
+
+var queryStats = &QueryStats{entries: make(map[string]*queryStat)}
+
+// QueryStatistics statistics collected from all connections
+func QueryStatistics() *QueryStats {
+	return queryStats
+}
+
+func (qs *QueryStats) record(fingerprint string, elapsed time.Duration, err error) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	s, ok := qs.entries[fingerprint]
+	if !ok {
+		if len(qs.entries) >= maxQueryFingerprints {
+			qs.overflow++
+			return
+		}
+		s = &queryStat{QueryStatModel: QueryStatModel{Fingerprint: fingerprint}}
+		qs.entries[fingerprint] = s
+	}
+	s.Count++
+	if err != nil {
+		s.Errors++
+	}
+	s.Total += elapsed
+	if elapsed > s.Max {
+		s.Max = elapsed
+	}
+	if len(s.samples) < queryLatencySamples {
+		s.samples = append(s.samples, elapsed)
+	} else {
+		s.samples[s.next] = elapsed
+		s.next = (s.next + 1) % queryLatencySamples
+	}
+}
+
+// Snapshot statistics ordered by total time(descending), and the number of statements not collected
+// because there were too many fingerprints
+func (qs *QueryStats) Snapshot() ([]*QueryStatModel, int64) {
+	qs.mu.Lock()
+	result := make([]*QueryStatModel, 0, len(qs.entries))
+	for _, s := range qs.entries {
+		item := s.QueryStatModel
+		item.P95 = percentile(s.samples, 0.95)
+		result = append(result, &item)
+	}
+	overflow := qs.overflow
+	qs.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Total > result[j].Total
+	})
+	return result, overflow
+}
+
+// Reset drop all statistics
+func (qs *QueryStats) Reset() {
+	qs.mu.Lock()
+	qs.entries = make(map[string]*queryStat)
+	qs.overflow = 0
+	qs.mu.Unlock()
+}
+
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+// observeQuery record statistics of a statement, and log it at warn level if it's slower than slowThreshold(0 to disable)
+func observeQuery(ctx context.Context, slowThreshold time.Duration, method, query string, args []interface{}, elapsed time.Duration, err error) {
+	fingerprint := normalizeQuery(query)
+	queryStats.record(fingerprint, elapsed, err)
+	if slowThreshold <= 0 || elapsed < slowThreshold {
+		return
+	}
+	logger := logging.ExtractLoggerFromContext(ctx)
+	logger.Warn("Slow query", zap.String("db.sql", fingerprint),
+		zap.Duration("db.time", elapsed),
+		zap.String("db.method", method),
+		zap.Any("db.args", logQueryArgs(args)),
+		zap.String("db.caller", queryCaller()))
+}
+
+// valueListPattern list of values after normalization
+var valueListPattern = regexp.MustCompile(`\?(?: ?, ?\?)+`)
+
+// normalizeQuery replace literals and placeholders with ?, lists of them are collapsed into "?, ...",
+// so statements differing only in values or the length of IN lists share a fingerprint
+func normalizeQuery(query string) string {
+	var (
+		b     strings.Builder
+		space bool
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		if isSpace(c) {
+			space = true
+			i++
+			continue
+		}
+		if space {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := scanQuoted(query, i, c, false)
+			if err != nil {
+				end = len(query)
+			}
+			if c == '\'' {
+				b.WriteByte('?')
+			} else {
+				b.WriteString(query[i:end])
+			}
+			i = end
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]),
+			isDigit(c) && (i == 0 || !isIdentifierByte(query[i-1])):
+			i++
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return valueListPattern.ReplaceAllString(b.String(), "?, ...")
+}
+
+func isIdentifierByte(c byte) bool {
+	return isLetter(c) || isDigit(c) || c == '_' || c == '$'
+}
+
+var driverPackage = reflect.TypeOf(QueryStats{}).PkgPath()
+
+// queryCaller file:line of the first caller outside of the driver package
+func queryCaller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, driverPackage+".") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// dialectReporter implemented by connections that know the dialect they speak
+type dialectReporter interface {
+	sqlDialect() Dialect
+}
+
+// DialectOf dialect spoken by db, connections that don't report one(like fakes) are assumed to speak PostgreSQL
+func DialectOf(db ITransactionalDB) Dialect {
+	if dr, ok := db.(dialectReporter); ok {
+		return dr.sqlDialect()
+	}
+	return DialectPostgreSQL
+}
+
+// UpsertSpec single row INSERT that updates the row conflicting on Key instead
+type UpsertSpec struct {
+	Table   string
+	Columns []string // inserted columns, values are passed in this order
+	Key     []string // columns of the unique key the conflict is detected on
+	Replace []string // columns overwritten by the inserted values
+	Add     []string // numeric columns incremented by the inserted values
+}
+
+// Upsert insert a row of values, on conflict Replace columns take the inserted values and Add columns are incremented
+// by them. The conflicting row is left as it is if both are empty.
+//
+// Unlike SELECT ... FOR UPDATE followed by an INSERT, concurrent upserts of a missing row don't fail on the unique key
+func Upsert(ctx context.Context, db ITransactionalDB, spec *UpsertSpec, values ...interface{}) (sql.Result, error) {
+	return db.ExecContext(ctx, upsertQuery(DialectOf(db), spec), values...)
+}
+
+// upsertQuery build the portable statement with the conflict clause of d
+func upsertQuery(d Dialect, spec *UpsertSpec) string {
+	var b strings.Builder
+	placeholders := make([]string, len(spec.Columns))
+	for i := range spec.Columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	fmt.Fprintf(&b, `INSERT INTO "%s"(%s) VALUES(%s)`, spec.Table, quoteColumns(spec.Columns), strings.Join(placeholders, ", "))
+
+	var sets []string
+	if d == DialectMySQL {
+		for _, c := range spec.Replace {
+			sets = append(sets, fmt.Sprintf(`"%s" = VALUES("%s")`, c, c))
+		}
+		for _, c := range spec.Add {
+			sets = append(sets, fmt.Sprintf(`"%s" = "%s" + VALUES("%s")`, c, c, c))
+		}
+		if len(sets) == 0 {
+			// MySQL has no DO NOTHING, a self assignment keeps the row
+			sets = append(sets, fmt.Sprintf(`"%s" = "%s"`, spec.Key[0], spec.Key[0]))
+		}
+		b.WriteString(" ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "))
+		return b.String()
+	}
+
+	for _, c := range spec.Replace {
+		sets = append(sets, fmt.Sprintf(`"%s" = excluded."%s"`, c, c))
+	}
+	for _, c := range spec.Add {
+		sets = append(sets, fmt.Sprintf(`"%s" = "%s"."%s" + excluded."%s"`, c, spec.Table, c, c))
+	}
+	fmt.Fprintf(&b, " ON CONFLICT (%s)", quoteColumns(spec.Key))
+	if len(sets) == 0 {
+		b.WriteString(" DO NOTHING")
+	} else {
+		b.WriteString(" DO UPDATE SET " + strings.Join(sets, ", "))
+	}
+	return b.String()
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = `"` + c + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
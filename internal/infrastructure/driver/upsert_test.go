@@ -0,0 +1,46 @@
+package driver
+
+import "testing"
+
+func TestUpsertQuery(t *testing.T) {
+	accumulate := &UpsertSpec{
+		Table:   "counter",
+		Columns: []string{"user_id", "day", "hits", "label"},
+		Key:     []string{"user_id", "day"},
+		Replace: []string{"label"},
+		Add:     []string{"hits"},
+	}
+	ensure := &UpsertSpec{
+		Table:   "counter",
+		Columns: []string{"user_id", "hits"},
+		Key:     []string{"user_id"},
+	}
+	tests := []struct {
+		name    string
+		dialect Dialect
+		spec    *UpsertSpec
+		want    string
+	}{
+		{"mysql update", DialectMySQL, accumulate,
+			"INSERT INTO `counter`(`user_id`, `day`, `hits`, `label`) VALUES(?, ?, ?, ?) " +
+				"ON DUPLICATE KEY UPDATE `label` = VALUES(`label`), `hits` = `hits` + VALUES(`hits`)"},
+		{"mysql keep", DialectMySQL, ensure,
+			"INSERT INTO `counter`(`user_id`, `hits`) VALUES(?, ?) ON DUPLICATE KEY UPDATE `user_id` = `user_id`"},
+		{"postgres update", DialectPostgreSQL, accumulate,
+			`INSERT INTO "counter"("user_id", "day", "hits", "label") VALUES($1, $2, $3, $4) ` +
+				`ON CONFLICT ("user_id", "day") DO UPDATE SET "label" = excluded."label", "hits" = "counter"."hits" + excluded."hits"`},
+		{"sqlite keep", DialectSQLite, ensure,
+			`INSERT INTO "counter"("user_id", "hits") VALUES(?, ?) ON CONFLICT ("user_id") DO NOTHING`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Translate(tt.dialect, upsertQuery(tt.dialect, tt.spec), make([]interface{}, len(tt.spec.Columns)))
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("upsertQuery() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVWriter .
+type CSVWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+// interface assertion
+var _ Writer = &CSVWriter{}
+
+// NewCSVWriter create a CSV writer
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write implement Writer
+func (cw *CSVWriter) Write(row ...interface{}) error {
+	cw.record = cw.record[:0]
+	for _, v := range row {
+		text, _ := formatCell(v)
+		cw.record = append(cw.record, text)
+	}
+	return cw.w.Write(cw.record)
+}
+
+// Close implement Writer
+func (cw *CSVWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,57 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// supported formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer write rows of cells one at a time, rows are not kept in memory
+//
+// supported cell types are string, bool, int, int64, float32, float64 and time.Time,
+// other values are written in their default format
+type Writer interface {
+	Write(row ...interface{}) error
+	// Close flush buffered rows and finish the document, the underlying io.Writer is left open
+	Close() error
+}
+
+// ContentType MIME type of format
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// formatCell format a cell as text, numeric reports whether it's a number
+func formatCell(v interface{}) (text string, numeric bool) {
+	switch c := v.(type) {
+	case string:
+		return c, false
+	case bool:
+		return strconv.FormatBool(c), false
+	case int:
+		return strconv.Itoa(c), true
+	case int64:
+		return strconv.FormatInt(c, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(c), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(c, 'f', -1, 64), true
+	case time.Time:
+		return c.Format(time.RFC3339), false
+	case nil:
+		return "", false
+	default:
+		return fmt.Sprint(c), false
+	}
+}
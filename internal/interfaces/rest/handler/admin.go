@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const (
+	defaultPageSize = 20
+	maximumPageSize = 100
+)
+
+// AdminHandler user management operations
+type AdminHandler struct {
+	userUseCase  user.UserUseCase
+	validator    validate.Validator
+	maximumRetry int
+	retryTimeout time.Duration
+}
+
+// AdminUserDetailModel user detail with login retry state
+type AdminUserDetailModel struct {
+	*user.UserModel
+	LoginBlocked      bool  `json:"login_blocked"`
+	LoginBlockedUntil int64 `json:"login_blocked_until,omitempty"` // seconds
+}
+
+type AdminAssignRolesModel struct {
+	Roles []string `json:"roles" validate:"dive,required,max=32"`
+}
+
+// NewAdminHandler create an admin controller instance
+func NewAdminHandler(
+	UserUseCase user.UserUseCase,
+	MaximumRetry int,
+	RetryTimeout time.Duration,
+	Validator validate.Validator,
+) *AdminHandler {
+	handler := &AdminHandler{UserUseCase, Validator, MaximumRetry, RetryTimeout}
+	return handler
+}
+
+// HandleListUsers list users with filters, the next page is fetched by passing back next_cursor
+func (ah *AdminHandler) HandleListUsers(c echo.Context) (err error) {
+	UserUseCase := ah.userUseCase
+	ctx := c.Request().Context()
+
+	filter, errs := parseUserFilter(c)
+	if len(errs) > 0 {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", errs))
+	}
+
+	page, err := UserUseCase.ListUsers(ctx, filter)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidCursor) {
+			return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params",
+				[]*validate.FieldError{validate.NewFieldError("cursor", err.Error())}))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// HandleGetUser get user detail
+func (ah *AdminHandler) HandleGetUser(c echo.Context) (err error) {
+	UserUseCase := ah.userUseCase
+	ctx := c.Request().Context()
+
+	entity, err := UserUseCase.GetUser(ctx, c.Param("id"))
+	if err != nil {
+		return ah.handleUserError(c, err)
+	}
+
+	detail := &AdminUserDetailModel{UserModel: entity}
+	if entity.LoginRetry >= ah.maximumRetry {
+		until := entity.LastLogin + int64(ah.retryTimeout.Seconds())
+		if until > time.Now().Unix() {
+			detail.LoginBlocked = true
+			detail.LoginBlockedUntil = until
+		}
+	}
+	return c.JSON(http.StatusOK, detail)
+}
+
+// HandleLockUser lock user
+func (ah *AdminHandler) HandleLockUser(c echo.Context) (err error) {
+	if err := ah.userUseCase.SetLocked(c.Request().Context(), c.Param("id"), true); err != nil {
+		return ah.handleUserError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleUnlockUser unlock user, login retry count is also reset
+func (ah *AdminHandler) HandleUnlockUser(c echo.Context) (err error) {
+	if err := ah.userUseCase.SetLocked(c.Request().Context(), c.Param("id"), false); err != nil {
+		return ah.handleUserError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleForcePasswordReset require user to reset password before signing in
+func (ah *AdminHandler) HandleForcePasswordReset(c echo.Context) (err error) {
+	if err := ah.userUseCase.ForcePasswordReset(c.Request().Context(), c.Param("id")); err != nil {
+		return ah.handleUserError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleAssignRoles replace roles of user
+func (ah *AdminHandler) HandleAssignRoles(c echo.Context) (err error) {
+	post := new(AdminAssignRolesModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind roles"))
+	}
+	if err := ah.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	if err := ah.userUseCase.AssignRoles(c.Request().Context(), c.Param("id"), post.Roles); err != nil {
+		return ah.handleUserError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ah *AdminHandler) handleUserError(c echo.Context, err error) error {
+	if errors.Is(err, user.ErrUserNotFound) {
+		return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+	}
+	return err
+}
+
+func parseUserFilter(c echo.Context) (*user.UserFilter, []*validate.FieldError) {
+	var errs []*validate.FieldError
+	filter := &user.UserFilter{
+		Search: c.QueryParam("q"),
+		Cursor: c.QueryParam("cursor"),
+		Limit:  defaultPageSize,
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maximumPageSize {
+			errs = append(errs, validate.NewFieldError("limit", fmt.Sprintf("limit must be an integer between 1 and %d", maximumPageSize)))
+		} else {
+			filter.Limit = limit
+		}
+	}
+	if t, err := parseTimeParam(c, "created_from"); err != nil {
+		errs = append(errs, err)
+	} else {
+		filter.CreatedFrom = t
+	}
+	if t, err := parseTimeParam(c, "created_to"); err != nil {
+		errs = append(errs, err)
+	} else {
+		filter.CreatedTo = t
+	}
+	if b, err := parseBoolParam(c, "locked"); err != nil {
+		errs = append(errs, err)
+	} else {
+		filter.Locked = b
+	}
+	if b, err := parseBoolParam(c, "verified"); err != nil {
+		errs = append(errs, err)
+	} else {
+		filter.Verified = b
+	}
+	return filter, errs
+}
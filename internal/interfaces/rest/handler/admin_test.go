@@ -0,0 +1,200 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+func TestAdminAssignRoles(t *testing.T) {
+	kit := resttest.New(t)
+	member := kit.CreateUser("member", "member-password")
+	kit.LoginAs("administrator", user.RoleAdmin)
+
+	path := resttest.APIPrefix + "/admin/users/" + member.ID
+	rec := kit.Do(http.MethodPut, path+"/roles", map[string][]string{"roles": {user.RoleAdmin}})
+	kit.AssertStatus(rec, http.StatusNoContent)
+
+	detail := new(user.UserModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, path, nil), detail)
+	if len(detail.Roles) != 1 || detail.Roles[0] != user.RoleAdmin {
+		t.Fatalf("Expected roles [%s], got %v", user.RoleAdmin, detail.Roles)
+	}
+
+	rec = kit.Do(http.MethodPut, path+"/roles", map[string][]string{"roles": {}})
+	kit.AssertStatus(rec, http.StatusNoContent)
+	detail = new(user.UserModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, path, nil), detail)
+	if len(detail.Roles) != 0 {
+		t.Fatalf("Expected roles to be revoked, got %v", detail.Roles)
+	}
+}
+
+func TestAdminAssignRolesUnknownUser(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+
+	rec := kit.Do(http.MethodPut, resttest.APIPrefix+"/admin/users/missing/roles", map[string][]string{"roles": {user.RoleAdmin}})
+	kit.AssertError(rec, http.StatusNotFound, user.ErrUserNotFound.Error())
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodGet, resttest.APIPrefix+"/admin/users", nil)
+	kit.AssertStatus(rec, http.StatusForbidden)
+}
+
+func TestAdminRevokedRoleTakesEffect(t *testing.T) {
+	kit := resttest.New(t)
+	admin := kit.LoginAs("administrator", user.RoleAdmin)
+
+	rec := kit.Do(http.MethodGet, resttest.APIPrefix+"/admin/users", nil)
+	kit.AssertStatus(rec, http.StatusOK)
+	if err := kit.UserRepo.SetRoles(kit.Context(), admin.ID, nil); err != nil {
+		t.Fatalf("Failed to revoke roles: %s", err)
+	}
+	rec = kit.Do(http.MethodGet, resttest.APIPrefix+"/admin/users", nil)
+	kit.AssertStatus(rec, http.StatusForbidden)
+}
+
+func TestAdminLockedUserLosesSession(t *testing.T) {
+	kit := resttest.New(t)
+	admin := kit.LoginAs("administrator", user.RoleAdmin)
+
+	if err := kit.UserRepo.SetLocked(kit.Context(), admin.ID, true); err != nil {
+		t.Fatalf("Failed to lock user: %s", err)
+	}
+	rec := kit.Do(http.MethodGet, resttest.APIPrefix+"/admin/users", nil)
+	kit.AssertStatus(rec, http.StatusUnauthorized)
+}
+
+func TestLockedUserSessionIsNotRefreshed(t *testing.T) {
+	cfg := resttest.DefaultConfig()
+	cfg.SessionTimeout = time.Minute // shorter than the refresh threshold, every request refreshes the token
+	kit := resttest.NewWithConfig(t, cfg)
+	learner := kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodGet, resttest.APIPrefix+"/user/preferences", nil)
+	kit.AssertStatus(rec, http.StatusOK)
+	if err := kit.UserRepo.SetLocked(kit.Context(), learner.ID, true); err != nil {
+		t.Fatalf("Failed to lock user: %s", err)
+	}
+	rec = kit.Do(http.MethodGet, resttest.APIPrefix+"/user/preferences", nil)
+	kit.AssertStatus(rec, http.StatusUnauthorized)
+}
+
+const adminUsersPath = resttest.APIPrefix + "/admin/users"
+
+// createUserAt create a user whose account was created at t
+func createUserAt(kit *resttest.Kit, username string, t time.Time) *user.UserModel {
+	kit.T.Helper()
+	entity := kit.CreateUser(username, "password")
+	kit.Exec(`UPDATE "user" SET created_at = $1 WHERE id = $2`, t, entity.ID)
+	return entity
+}
+
+// listUsers usernames on the page of query
+func listUsers(kit *resttest.Kit, query string) ([]string, string) {
+	kit.T.Helper()
+	page := new(user.UserPage)
+	kit.DecodeJSON(kit.Do(http.MethodGet, adminUsersPath+"?"+query, nil), page)
+	names := make([]string, len(page.Items))
+	for i, u := range page.Items {
+		names[i] = u.Username
+	}
+	return names, page.NextCursor
+}
+
+func TestAdminListUsersPaging(t *testing.T) {
+	kit := resttest.New(t)
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	admin := kit.LoginAs("administrator", user.RoleAdmin)
+	kit.Exec(`UPDATE "user" SET created_at = $1 WHERE id = $2`, day, admin.ID)
+	for i, name := range []string{"learner-a", "learner-b", "learner-c", "learner-d"} {
+		createUserAt(kit, name, day.AddDate(0, 0, i+1))
+	}
+	// a tie on created_at is broken by id
+	createUserAt(kit, "learner-e", day.AddDate(0, 0, 4))
+
+	var (
+		names  []string
+		cursor string
+		pages  int
+	)
+	for {
+		page, next := listUsers(kit, "limit=2&cursor="+cursor)
+		names = append(names, page...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if pages != 3 || len(names) != 6 {
+		t.Fatalf("Expected 6 users on 3 pages, got %v on %d", names, pages)
+	}
+	// ids are random, so is the order of the tied users
+	if !(names[0] == "learner-d" && names[1] == "learner-e") && !(names[0] == "learner-e" && names[1] == "learner-d") {
+		t.Fatalf("Expected the tied users first, got %v", names)
+	}
+	want := []string{"learner-c", "learner-b", "learner-a", "administrator"}
+	for i, name := range want {
+		if names[i+2] != name {
+			t.Fatalf("Expected users newest first, got %v", names)
+		}
+	}
+
+	rec := kit.Do(http.MethodGet, adminUsersPath+"?cursor=not-a-cursor", nil)
+	kit.AssertValidationError(rec, "cursor")
+}
+
+func TestAdminListUsersFilters(t *testing.T) {
+	kit := resttest.New(t)
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	createUserAt(kit, "ab%cdef", day)
+	createUserAt(kit, "abxcdef", day.AddDate(0, 0, 1))
+	createUserAt(kit, "ab_cdef", day.AddDate(0, 0, 2))
+	locked := createUserAt(kit, "abzcdef", day.AddDate(0, 0, 3))
+	if err := kit.UserRepo.SetLocked(kit.Context(), locked.ID, true); err != nil {
+		t.Fatalf("Failed to lock user: %s", err)
+	}
+	kit.Exec(`UPDATE "user" SET verified = $1 WHERE username = $2`, true, "abxcdef")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// wildcards are matched literally
+		{"q=ab%25", []string{"ab%cdef"}},
+		{"q=ab_", []string{"ab_cdef"}},
+		{"q=abx", []string{"abxcdef"}},
+		// by email too
+		{"q=abzcdef@example", []string{"abzcdef"}},
+		{"q=ab&created_from=2020-01-02T00:00:00Z&created_to=2020-01-04T00:00:00Z", []string{"ab_cdef", "abxcdef"}},
+		{"q=ab&locked=true", []string{"abzcdef"}},
+		{"q=ab&locked=false&verified=false", []string{"ab_cdef", "ab%cdef"}},
+		{"q=ab&verified=true", []string{"abxcdef"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			names, _ := listUsers(kit, tt.query)
+			if len(names) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, names)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("Expected %v, got %v", tt.want, names)
+				}
+			}
+		})
+	}
+
+	rec := kit.Do(http.MethodGet, adminUsersPath+"?created_from=yesterday&locked=maybe", nil)
+	kit.AssertValidationError(rec, "created_from", "locked")
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/auth"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/spreadsheet"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+	timespent "github.com/pot-code/go-boilerplate/internal/time_spent"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+// ExportHandler export learning history as spreadsheets, rows are streamed to the response as they are read
+type ExportHandler struct {
+	timeSpentUseCase timespent.TimeSpentUseCase
+	lessonUseCase    lesson.LessonUseCase
+	userUseCase      user.UserUseCase
+	jwtUtil          *auth.JWTUtil
+}
+
+func NewExportHandler(
+	TimeSpentUseCase timespent.TimeSpentUseCase,
+	LessonUseCase lesson.LessonUseCase,
+	UserUseCase user.UserUseCase,
+	JWTUtil *auth.JWTUtil,
+) *ExportHandler {
+	handler := &ExportHandler{TimeSpentUseCase, LessonUseCase, UserUseCase, JWTUtil}
+	return handler
+}
+
+// exportParams common query params of export endpoints
+type exportParams struct {
+	format   string
+	from, to *time.Time // calendar dates, both inclusive
+}
+
+// HandleExportTimeSpent export time spent of each day
+func (eh *ExportHandler) HandleExportTimeSpent(c echo.Context) (err error) {
+	user := eh.exportUser(c)
+	params, errs := parseExportParams(c, user)
+	if len(errs) > 0 {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", errs))
+	}
+
+	w := newExportWriter(c, params.format, "time-spent", "Time spent",
+		"date", "vocabulary", "grammar", "listening", "writing", "total")
+	err = eh.timeSpentUseCase.ExportTimeSpent(c.Request().Context(), user, params.from, params.to, func(e *timespent.TimeSpentModel) error {
+		return w.Write(e.TS.Format("2006-01-02"), e.Vocabulary, e.Grammar, e.Listening, e.Writing, e.Total())
+	})
+	return eh.finishExport(c, w, err)
+}
+
+// HandleExportLessonProgress export progress snapshots of all lessons
+func (eh *ExportHandler) HandleExportLessonProgress(c echo.Context) (err error) {
+	user := eh.exportUser(c)
+	params, errs := parseExportParams(c, user)
+	if len(errs) > 0 {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", errs))
+	}
+
+	ctx := c.Request().Context()
+	if err := eh.userUseCase.GetPreferences(ctx, user); err != nil {
+		return eh.handleExportError(c, err)
+	}
+	loc, err := user.Location()
+	if err != nil {
+		return eh.handleExportError(c, err)
+	}
+	// dates are converted to instants in the user's time zone
+	var from, to *time.Time
+	if params.from != nil {
+		y, m, d := params.from.Date()
+		t := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		from = &t
+	}
+	if params.to != nil {
+		y, m, d := params.to.Date()
+		t := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		to = &t
+	}
+
+	w := newExportWriter(c, params.format, "lesson-progress", "Lesson progress",
+		"time", "lesson_id", "lesson", "progress", "reset")
+	err = eh.lessonUseCase.ExportProgressHistory(ctx, user, from, to, func(e *lesson.ProgressHistoryModel) error {
+		return w.Write(e.CreatedAt.In(loc), e.LessonID, e.Title, e.Progress, e.Reset)
+	})
+	return eh.finishExport(c, w, err)
+}
+
+// exportUser the user in path param id for admins, otherwise the caller
+func (eh *ExportHandler) exportUser(c echo.Context) *user.UserModel {
+	claims := eh.jwtUtil.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+	if id := c.Param("id"); id != "" {
+		user.ID = id
+	}
+	return user
+}
+
+// finishExport close the writer, errors after the response is committed can't be reported to the client
+// and the download is truncated
+func (eh *ExportHandler) finishExport(c echo.Context, w *exportWriter, err error) error {
+	if err != nil {
+		if w.w == nil {
+			return eh.handleExportError(c, err)
+		}
+		return err
+	}
+	return w.Close()
+}
+
+func (eh *ExportHandler) handleExportError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+	case isTimeSpentInputError(err):
+		return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+	}
+	return err
+}
+
+func parseExportParams(c echo.Context, u *user.UserModel) (*exportParams, []*validate.FieldError) {
+	var errs []*validate.FieldError
+	params := &exportParams{format: c.QueryParam("format")}
+	switch params.format {
+	case "":
+		params.format = spreadsheet.FormatCSV
+	case spreadsheet.FormatCSV, spreadsheet.FormatXLSX:
+	default:
+		errs = append(errs, validate.NewFieldError("format", "format must be one of (csv xlsx)"))
+	}
+	if t, err := parseDateParam(c, "from"); err != nil {
+		errs = append(errs, err)
+	} else {
+		params.from = t
+	}
+	if t, err := parseDateParam(c, "to"); err != nil {
+		errs = append(errs, err)
+	} else {
+		params.to = t
+	}
+	if params.from != nil && params.to != nil && params.from.After(*params.to) {
+		errs = append(errs, validate.NewFieldError("from", timespent.ErrInvalidRange.Error()))
+	}
+	if err := bindLocale(c, u); err != nil {
+		errs = append(errs, err)
+	}
+	return params, errs
+}
+
+// exportWriter commit the response on the first row, so that errors raised before are still sent as JSON
+type exportWriter struct {
+	c                   echo.Context
+	format, name, sheet string
+	header              []interface{}
+	w                   spreadsheet.Writer
+}
+
+func newExportWriter(c echo.Context, format, name, sheet string, header ...interface{}) *exportWriter {
+	return &exportWriter{c: c, format: format, name: name, sheet: sheet, header: header}
+}
+
+func (ew *exportWriter) Write(row ...interface{}) error {
+	if ew.w == nil {
+		if err := ew.open(); err != nil {
+			return err
+		}
+	}
+	return ew.w.Write(row...)
+}
+
+// Close a document with only the header is sent if there is no row
+func (ew *exportWriter) Close() error {
+	if ew.w == nil {
+		if err := ew.open(); err != nil {
+			return err
+		}
+	}
+	return ew.w.Close()
+}
+
+func (ew *exportWriter) open() (err error) {
+	c := ew.c
+	filename := ew.name + "-" + time.Now().Format("20060102") + "." + ew.format
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, spreadsheet.ContentType(ew.format))
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Response().WriteHeader(http.StatusOK)
+
+	if ew.format == spreadsheet.FormatXLSX {
+		if ew.w, err = spreadsheet.NewXLSXWriter(c.Response(), ew.sheet); err != nil {
+			return err
+		}
+	} else {
+		ew.w = spreadsheet.NewCSVWriter(c.Response())
+	}
+	return ew.w.Write(ew.header...)
+}
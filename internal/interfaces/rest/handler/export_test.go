@@ -0,0 +1,114 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const exportPath = resttest.APIPrefix + "/export"
+
+func readCSV(t *testing.T, kit *resttest.Kit, rec *httptest.ResponseRecorder) [][]string {
+	t.Helper()
+	kit.AssertStatus(rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV document, got %s", ct)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %s", err)
+	}
+	return records
+}
+
+func TestExportTimeSpent(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", "2020-01-06", 10), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", "2020-01-07", 20), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-3", "2020-01-08", 30), http.StatusOK)
+
+	records := readCSV(t, kit, kit.Do(http.MethodGet, exportPath+"/time-spent?from=2020-01-06&to=2020-01-07", nil))
+	want := [][]string{
+		{"date", "vocabulary", "grammar", "listening", "writing", "total"},
+		{"2020-01-06", "10", "0", "0", "0", "10"},
+		{"2020-01-07", "20", "0", "0", "0", "20"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("Unexpected export %v", records)
+	}
+
+	// a document with only the header is sent if there is no row
+	records = readCSV(t, kit, kit.Do(http.MethodGet, exportPath+"/time-spent?from=2019-01-01&to=2019-01-31", nil))
+	if len(records) != 1 {
+		t.Fatalf("Expected the header only, got %v", records)
+	}
+}
+
+func TestExportTimeSpentXLSX(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", "2020-01-06", 10), http.StatusOK)
+
+	rec := kit.Do(http.MethodGet, exportPath+"/time-spent?format=xlsx", nil)
+	kit.AssertStatus(rec, http.StatusOK)
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, ".xlsx") {
+		t.Fatalf("Expected an xlsx attachment, got %s", cd)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len())); err != nil {
+		t.Fatalf("Expected an OOXML package: %s", err)
+	}
+}
+
+func TestExportLessonProgress(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+	kit.LoginAs("learner")
+
+	path := fmt.Sprintf("%s/lesson/%d/progress", resttest.APIPrefix, entity.ID)
+	kit.AssertStatus(kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 0.5}), http.StatusOK)
+	kit.AssertStatus(kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 1}), http.StatusOK)
+
+	records := readCSV(t, kit, kit.Do(http.MethodGet, exportPath+"/lesson-progress", nil))
+	if len(records) != 3 || records[1][2] != "greetings" || records[1][3] != "0.5" || records[2][3] != "1" {
+		t.Fatalf("Unexpected export %v", records)
+	}
+}
+
+func TestExportOtherUser(t *testing.T) {
+	kit := resttest.New(t)
+	learner := kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", "2020-01-06", 10), http.StatusOK)
+	kit.LoginAs("administrator", user.RoleAdmin)
+
+	path := resttest.APIPrefix + "/admin/users/" + learner.ID + "/export/time-spent"
+	records := readCSV(t, kit, kit.Do(http.MethodGet, path, nil))
+	if len(records) != 2 || records[1][0] != "2020-01-06" {
+		t.Fatalf("Expected the learner's time spent, got %v", records)
+	}
+
+	rec := kit.Do(http.MethodGet, resttest.APIPrefix+"/admin/users/missing/export/time-spent", nil)
+	kit.AssertError(rec, http.StatusNotFound, user.ErrUserNotFound.Error())
+}
+
+func TestExportValidation(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodGet, exportPath+"/time-spent?format=pdf", nil)
+	kit.AssertValidationError(rec, "format")
+	rec = kit.Do(http.MethodGet, exportPath+"/time-spent?from=2020-01-07&to=2020-01-06", nil)
+	kit.AssertValidationError(rec, "from")
+	rec = kit.Do(http.MethodGet, exportPath+"/lesson-progress?tz=Mars/Olympus", nil)
+	kit.AssertValidationError(rec, "tz")
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/importer"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+)
+
+// ImportHandler bulk import, the request body is the input and is read as a stream
+type ImportHandler struct {
+	importerUseCase importer.ImporterUseCase
+}
+
+func NewImportHandler(ImporterUseCase importer.ImporterUseCase) *ImportHandler {
+	handler := &ImportHandler{ImporterUseCase}
+	return handler
+}
+
+// HandleImportLessons .
+func (ih *ImportHandler) HandleImportLessons(c echo.Context) (err error) {
+	return ih.handleImport(c, ih.importerUseCase.ImportLessons)
+}
+
+// HandleImportProgress .
+func (ih *ImportHandler) HandleImportProgress(c echo.Context) (err error) {
+	return ih.handleImport(c, ih.importerUseCase.ImportProgress)
+}
+
+func (ih *ImportHandler) handleImport(
+	c echo.Context,
+	run func(ctx context.Context, r io.Reader, options *importer.OptionsModel) (*importer.ResultModel, error),
+) error {
+	options := &importer.OptionsModel{Format: c.QueryParam("format")}
+	if options.Format == "" {
+		options.Format = importFormat(c.Request().Header.Get(echo.HeaderContentType))
+	}
+	if b, err := parseBoolParam(c, "dry_run"); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	} else if b != nil {
+		options.DryRun = *b
+	}
+
+	result, err := run(c.Request().Context(), c.Request().Body, options)
+	if err != nil {
+		switch {
+		case errors.Is(err, importer.ErrUnknownFormat):
+			return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params",
+				[]*validate.FieldError{validate.NewFieldError("format", "format must be one of (csv json)")}))
+		case errors.Is(err, importer.ErrMalformedInput):
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// importFormat infer format from content type, JSON is the default
+func importFormat(contentType string) string {
+	if strings.HasPrefix(contentType, "text/csv") {
+		return importer.FormatCSV
+	}
+	return importer.FormatJSON
+}
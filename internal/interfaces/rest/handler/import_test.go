@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/importer"
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const importPath = resttest.APIPrefix + "/admin/import"
+
+func doImport(kit *resttest.Kit, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	return kit.DoRequest(req)
+}
+
+func TestImportLessons(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+
+	body := fmt.Sprintf("unit_id,index,title,status\n%[1]d,1,numbers,draft\n%[1]d,2,,published\n%[1]d,3,colors,published\n", entity.UnitID)
+	result := new(importer.ResultModel)
+	kit.DecodeJSON(doImport(kit, importPath+"/lessons?dry_run=true", "text/csv", body), result)
+	if !result.DryRun || result.Total != 3 || result.Imported != 2 || result.Failed != 1 {
+		t.Fatalf("Unexpected dry run result %+v", result)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 2 || result.Errors[0].Errors[0].Domain != "title" {
+		t.Fatalf("Unexpected row errors %+v", result.Errors)
+	}
+
+	result = new(importer.ResultModel)
+	kit.DecodeJSON(doImport(kit, importPath+"/lessons", "text/csv; charset=utf-8", body), result)
+	if result.DryRun || result.Imported != 2 || result.Failed != 1 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+}
+
+func TestImportProgress(t *testing.T) {
+	kit := resttest.New(t)
+	kit.CreateUser("learner", "password")
+	// matched whatever the case of the stored address
+	kit.Exec(`UPDATE "user" SET email = $1 WHERE username = $2`, "Learner@Example.com", "learner")
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+
+	body := fmt.Sprintf(`[
+		{"email": "learner@EXAMPLE.com", "lesson_id": %[1]d, "progress": 1, "updated_at": "2020-01-06T10:00:00Z"},
+		{"email": "nobody@example.com", "lesson_id": %[1]d, "progress": 1},
+		{"email": "learner@example.com", "lesson_id": %[1]d, "progress": 0.5}
+	]`, entity.ID)
+	result := new(importer.ResultModel)
+	kit.DecodeJSON(doImport(kit, importPath+"/progress", "application/json", body), result)
+	// the third row collides with the progress imported by the first one
+	if result.Total != 3 || result.Imported != 1 || result.Failed != 2 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+
+	kit.Login("learner", "password")
+	records := readCSV(t, kit, kit.Do(http.MethodGet, exportPath+"/lesson-progress", nil))
+	if len(records) != 2 || records[1][0] != "2020-01-06T10:00:00Z" || records[1][3] != "1" {
+		t.Fatalf("Expected the imported progress, got %v", records)
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+
+	rec := doImport(kit, importPath+"/lessons?format=xml", "application/xml", "<lessons/>")
+	kit.AssertValidationError(rec, "format")
+	rec = doImport(kit, importPath+"/lessons?dry_run=maybe", "application/json", "[]")
+	kit.AssertValidationError(rec, "dry_run")
+	rec = doImport(kit, importPath+"/lessons", "application/json", "{")
+	kit.AssertStatus(rec, http.StatusBadRequest)
+
+	kit.LoginAs("learner")
+	rec = doImport(kit, importPath+"/lessons", "application/json", "[]")
+	kit.AssertStatus(rec, http.StatusForbidden)
+}
+
+func TestImportProgressInvalidatesCache(t *testing.T) {
+	cfg := resttest.DefaultConfig()
+	cfg.Cache.LessonProgress.TTL = time.Hour
+	kit := resttest.NewWithConfig(t, cfg)
+	kit.CreateUser("administrator", "password", user.RoleAdmin)
+	kit.CreateUser("learner", "password")
+	kit.Login("administrator", "password")
+	entity := createLesson(t, kit, "greetings")
+
+	kit.Login("learner", "password")
+	// an empty progress is cached
+	kit.AssertStatus(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/progress", nil), http.StatusOK)
+
+	kit.Login("administrator", "password")
+	body := fmt.Sprintf(`[{"email": "learner@example.com", "lesson_id": %d, "progress": 1}]`, entity.ID)
+	result := new(importer.ResultModel)
+	kit.DecodeJSON(doImport(kit, importPath+"/progress", "application/json", body), result)
+	if result.Imported != 1 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+
+	kit.Login("learner", "password")
+	var progress []*lesson.LessonProgressModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/progress", nil), &progress)
+	if len(progress) != 1 || progress[0].Progress != 1 {
+		t.Fatalf("Expected the imported progress, got %+v", progress)
+	}
+}
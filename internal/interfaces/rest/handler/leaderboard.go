@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/auth"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
+)
+
+const defaultLeaderboardSize = 10
+
+type LeaderboardHandler struct {
+	leaderboardUseCase leaderboard.LeaderboardUseCase
+	validator          validate.Validator
+	jwtUtil            *auth.JWTUtil
+}
+
+type LeaderboardOptOutModel struct {
+	OptOut *bool `json:"opt_out" validate:"required"`
+}
+
+func NewLeaderboardHandler(
+	LeaderboardUseCase leaderboard.LeaderboardUseCase,
+	JWTUtil *auth.JWTUtil,
+	Validator validate.Validator,
+) *LeaderboardHandler {
+	handler := &LeaderboardHandler{LeaderboardUseCase, Validator, JWTUtil}
+	return handler
+}
+
+// HandleGetLeaderboard get top entries of a leaderboard and the caller's own rank
+func (lh *LeaderboardHandler) HandleGetLeaderboard(c echo.Context) (err error) {
+	claims := lh.jwtUtil.GetContextToken(c)
+	period := c.QueryParam("period")
+	if period == "" {
+		period = leaderboard.PeriodWeekly
+	}
+	limit := defaultLeaderboardSize
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > leaderboard.MaxTopN {
+			return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params",
+				[]*validate.FieldError{validate.NewFieldError("limit", fmt.Sprintf("limit must be an integer between 1 and %d", leaderboard.MaxTopN))}))
+		}
+	}
+
+	board, err := lh.leaderboardUseCase.GetLeaderboard(c.Request().Context(), c.Param("metric"), period, limit, claims.UID)
+	if err != nil {
+		switch {
+		case errors.Is(err, leaderboard.ErrUnknownMetric):
+			return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+		case errors.Is(err, leaderboard.ErrUnknownPeriod):
+			return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params",
+				[]*validate.FieldError{validate.NewFieldError("period", err.Error())}))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, board)
+}
+
+// HandleSetOptOut hide or show the caller on leaderboards
+func (lh *LeaderboardHandler) HandleSetOptOut(c echo.Context) (err error) {
+	claims := lh.jwtUtil.GetContextToken(c)
+	post := new(LeaderboardOptOutModel)
+	if err = c.Bind(&post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind opt-out setting"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	if err := lh.leaderboardUseCase.SetOptOut(c.Request().Context(), claims.UID, *post.OptOut); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleRebuild recompute leaderboards from the database
+func (lh *LeaderboardHandler) HandleRebuild(c echo.Context) (err error) {
+	if err := lh.leaderboardUseCase.Rebuild(c.Request().Context()); err != nil {
+		if errors.Is(err, driver.ErrLockNotAcquired) {
+			return c.JSON(http.StatusConflict, NewRESTStandardError(http.StatusConflict, err.Error()))
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
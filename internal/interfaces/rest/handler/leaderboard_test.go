@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const leaderboardPath = resttest.APIPrefix + "/leaderboards"
+
+func TestLeaderboard(t *testing.T) {
+	kit := resttest.New(t)
+	today := time.Now().UTC().Format("2006-01-02")
+	kit.LoginAs("learner-one")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 30), http.StatusOK)
+	kit.LoginAs("learner-two")
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", today, 10), http.StatusOK)
+
+	board := new(leaderboard.LeaderboardModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricTimeSpent, nil), board)
+	if len(board.Top) != 2 || board.Top[0].Username != "learner-one" || board.Top[0].Score != 30 {
+		t.Fatalf("Unexpected top entries %+v", board.Top)
+	}
+	if board.Me == nil || board.Me.Rank != 2 || board.Me.Score != 10 {
+		t.Fatalf("Unexpected own entry %+v", board.Me)
+	}
+
+	board = new(leaderboard.LeaderboardModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricTimeSpent+"?period=all-time&limit=1", nil), board)
+	if len(board.Top) != 1 || board.Me == nil || board.Me.Rank != 2 {
+		t.Fatalf("Unexpected all time leaderboard %+v", board)
+	}
+}
+
+func TestLeaderboardOptOut(t *testing.T) {
+	kit := resttest.New(t)
+	today := time.Now().UTC().Format("2006-01-02")
+	kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 30), http.StatusOK)
+
+	rec := kit.Do(http.MethodPut, leaderboardPath+"/opt-out", map[string]bool{"opt_out": true})
+	kit.AssertStatus(rec, http.StatusNoContent)
+	board := new(leaderboard.LeaderboardModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricTimeSpent, nil), board)
+	if len(board.Top) != 0 || board.Me != nil || !board.OptOut {
+		t.Fatalf("Expected opted out user to be hidden, got %+v", board)
+	}
+	// time spent while opted out still counts once the user opts in again
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", today, 10), http.StatusOK)
+
+	rec = kit.Do(http.MethodPut, leaderboardPath+"/opt-out", map[string]bool{"opt_out": false})
+	kit.AssertStatus(rec, http.StatusNoContent)
+	board = new(leaderboard.LeaderboardModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricTimeSpent, nil), board)
+	if board.Me == nil || board.Me.Score != 40 {
+		t.Fatalf("Expected scores to be restored, got %+v", board.Me)
+	}
+
+	rec = kit.Do(http.MethodPut, leaderboardPath+"/opt-out", map[string]interface{}{})
+	kit.AssertValidationError(rec, "opt_out")
+}
+
+func TestLeaderboardValidation(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodGet, leaderboardPath+"/streaks", nil)
+	kit.AssertError(rec, http.StatusNotFound, leaderboard.ErrUnknownMetric.Error())
+	rec = kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricLessons+"?period=daily", nil)
+	kit.AssertValidationError(rec, "period")
+	rec = kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricLessons+"?limit=1000", nil)
+	kit.AssertValidationError(rec, "limit")
+}
+
+func TestLeaderboardRebuild(t *testing.T) {
+	kit := resttest.New(t)
+	today := time.Now().UTC().Format("2006-01-02")
+	kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 30), http.StatusOK)
+
+	// lost scores are recomputed from the database
+	for _, key := range kit.KV.Keys() {
+		kit.KV.Del(kit.Context(), key)
+	}
+	kit.LoginAs("administrator", user.RoleAdmin)
+	kit.AssertStatus(kit.Do(http.MethodPost, resttest.APIPrefix+"/admin/leaderboards/rebuild", nil), http.StatusNoContent)
+
+	board := new(leaderboard.LeaderboardModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, leaderboardPath+"/"+leaderboard.MetricTimeSpent, nil), board)
+	if len(board.Top) != 1 || board.Top[0].Username != "learner" || board.Top[0].Score != 30 {
+		t.Fatalf("Expected the leaderboard to be rebuilt, got %+v", board.Top)
+	}
+}
@@ -1,21 +1,33 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/auth"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
 	"github.com/pot-code/go-boilerplate/internal/lesson"
 	"github.com/pot-code/go-boilerplate/internal/user"
 )
 
 type LessonHandler struct {
 	lessonUseCase lesson.LessonUseCase
+	validator     validate.Validator
 	jwtUtil       *auth.JWTUtil
 }
 
-func NewLessonHandler(LessonUseCase lesson.LessonUseCase, JWTUtil *auth.JWTUtil) *LessonHandler {
-	handler := &LessonHandler{LessonUseCase, JWTUtil}
+type LessonProgressFormModel struct {
+	Progress *float32 `json:"progress" validate:"required,min=0,max=1"`
+	Reset    bool     `json:"reset"`
+}
+
+func NewLessonHandler(
+	LessonUseCase lesson.LessonUseCase,
+	JWTUtil *auth.JWTUtil,
+	Validator validate.Validator,
+) *LessonHandler {
+	handler := &LessonHandler{LessonUseCase, Validator, JWTUtil}
 	return handler
 }
 
@@ -33,3 +45,103 @@ func (lh *LessonHandler) HandleGetLessonProgress(c echo.Context) (err error) {
 	}
 	return c.JSON(http.StatusOK, progress)
 }
+
+// HandleGetCatalog list published courses with their units and lessons
+func (lh *LessonHandler) HandleGetCatalog(c echo.Context) (err error) {
+	catalog, err := lh.lessonUseCase.GetCatalog(c.Request().Context(), false)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, catalog)
+}
+
+// HandleUpdateLessonProgress record learning progress of a lesson
+func (lh *LessonHandler) HandleUpdateLessonProgress(c echo.Context) (err error) {
+	LessonUseCase := lh.lessonUseCase
+	ju := lh.jwtUtil
+
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	post := new(LessonProgressFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind progress entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	progress, err := LessonUseCase.RecordProgress(c.Request().Context(), user, id, *post.Progress, post.Reset)
+	if err != nil {
+		if errors.Is(err, lesson.ErrProgressRegression) {
+			return c.JSON(http.StatusConflict, NewRESTStandardError(http.StatusConflict, err.Error()))
+		}
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusOK, progress)
+}
+
+// HandleGetLessonProgressHistory list progress snapshots of a lesson
+func (lh *LessonHandler) HandleGetLessonProgressHistory(c echo.Context) (err error) {
+	LessonUseCase := lh.lessonUseCase
+	ju := lh.jwtUtil
+
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+
+	history, err := LessonUseCase.GetProgressHistory(c.Request().Context(), user, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+// HandleGetLessonStates list published lessons with progress and lock state
+func (lh *LessonHandler) HandleGetLessonStates(c echo.Context) (err error) {
+	LessonUseCase := lh.lessonUseCase
+	ju := lh.jwtUtil
+
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	states, err := LessonUseCase.GetLessonStates(c.Request().Context(), user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, states)
+}
+
+// HandleGetNextLesson recommend the lesson to study next, 204 is returned if everything is completed
+func (lh *LessonHandler) HandleGetNextLesson(c echo.Context) (err error) {
+	LessonUseCase := lh.lessonUseCase
+	ju := lh.jwtUtil
+
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	next, err := LessonUseCase.RecommendNext(c.Request().Context(), user)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, next)
+}
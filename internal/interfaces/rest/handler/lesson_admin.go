@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+)
+
+type CourseFormModel struct {
+	Index       int    `json:"index" validate:"min=0,max=32767"`
+	Title       string `json:"title" validate:"required,max=128"`
+	Description string `json:"description" validate:"max=1024"`
+	Status      string `json:"status" validate:"required,oneof=draft published"`
+}
+
+func (cfm *CourseFormModel) ToDomain() *lesson.CourseModel {
+	return &lesson.CourseModel{
+		Index:       cfm.Index,
+		Title:       cfm.Title,
+		Description: cfm.Description,
+		Status:      cfm.Status,
+	}
+}
+
+type UnitFormModel struct {
+	CourseID int64  `json:"course_id" validate:"required,min=1"`
+	Index    int    `json:"index" validate:"min=0,max=32767"`
+	Title    string `json:"title" validate:"required,max=128"`
+	Status   string `json:"status" validate:"required,oneof=draft published"`
+}
+
+func (ufm *UnitFormModel) ToDomain() *lesson.UnitModel {
+	return &lesson.UnitModel{
+		CourseID: ufm.CourseID,
+		Index:    ufm.Index,
+		Title:    ufm.Title,
+		Status:   ufm.Status,
+	}
+}
+
+type LessonFormModel struct {
+	UnitID int64  `json:"unit_id" validate:"required,min=1"`
+	Index  int    `json:"index" validate:"min=0,max=32767"`
+	Title  string `json:"title" validate:"required,max=128"`
+	Status string `json:"status" validate:"required,oneof=draft published"`
+}
+
+func (lfm *LessonFormModel) ToDomain() *lesson.LessonModel {
+	return &lesson.LessonModel{
+		UnitID: lfm.UnitID,
+		Index:  lfm.Index,
+		Title:  lfm.Title,
+		Status: lfm.Status,
+	}
+}
+
+type PrerequisiteFormModel struct {
+	Prerequisites []int64 `json:"prerequisites" validate:"dive,min=1"`
+}
+
+// HandleGetFullCatalog list all courses including drafts
+func (lh *LessonHandler) HandleGetFullCatalog(c echo.Context) (err error) {
+	catalog, err := lh.lessonUseCase.GetCatalog(c.Request().Context(), true)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, catalog)
+}
+
+// HandleCreateCourse .
+func (lh *LessonHandler) HandleCreateCourse(c echo.Context) (err error) {
+	post := new(CourseFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind course entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	if err := lh.lessonUseCase.CreateCourse(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusCreated, entity)
+}
+
+// HandleUpdateCourse .
+func (lh *LessonHandler) HandleUpdateCourse(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	post := new(CourseFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind course entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	entity.ID = id
+	if err := lh.lessonUseCase.UpdateCourse(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusOK, entity)
+}
+
+// HandleDeleteCourse .
+func (lh *LessonHandler) HandleDeleteCourse(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	if err := lh.lessonUseCase.DeleteCourse(c.Request().Context(), id); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleCreateUnit .
+func (lh *LessonHandler) HandleCreateUnit(c echo.Context) (err error) {
+	post := new(UnitFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind unit entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	if err := lh.lessonUseCase.CreateUnit(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusCreated, entity)
+}
+
+// HandleUpdateUnit .
+func (lh *LessonHandler) HandleUpdateUnit(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	post := new(UnitFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind unit entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	entity.ID = id
+	if err := lh.lessonUseCase.UpdateUnit(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusOK, entity)
+}
+
+// HandleDeleteUnit .
+func (lh *LessonHandler) HandleDeleteUnit(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	if err := lh.lessonUseCase.DeleteUnit(c.Request().Context(), id); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleCreateLesson .
+func (lh *LessonHandler) HandleCreateLesson(c echo.Context) (err error) {
+	post := new(LessonFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind lesson entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	if err := lh.lessonUseCase.CreateLesson(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusCreated, entity)
+}
+
+// HandleUpdateLesson .
+func (lh *LessonHandler) HandleUpdateLesson(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	post := new(LessonFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind lesson entity"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := post.ToDomain()
+	entity.ID = id
+	if err := lh.lessonUseCase.UpdateLesson(c.Request().Context(), entity); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.JSON(http.StatusOK, entity)
+}
+
+// HandleDeleteLesson .
+func (lh *LessonHandler) HandleDeleteLesson(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	if err := lh.lessonUseCase.DeleteLesson(c.Request().Context(), id); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleSetPrerequisites replace prerequisites of a lesson
+func (lh *LessonHandler) HandleSetPrerequisites(c echo.Context) (err error) {
+	id, ferr := parseIDParam(c, "id")
+	if ferr != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{ferr}))
+	}
+	post := new(PrerequisiteFormModel)
+	if err = c.Bind(post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind prerequisites"))
+	}
+	if err := lh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	if err := lh.lessonUseCase.SetPrerequisites(c.Request().Context(), id, post.Prerequisites); err != nil {
+		return handleContentError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func handleContentError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, lesson.ErrCourseNotFound),
+		errors.Is(err, lesson.ErrUnitNotFound),
+		errors.Is(err, lesson.ErrLessonNotFound):
+		return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+	case errors.Is(err, lesson.ErrNotEmpty),
+		errors.Is(err, lesson.ErrLessonInUse),
+		errors.Is(err, lesson.ErrPrerequisiteCycle):
+		return c.JSON(http.StatusConflict, NewRESTStandardError(http.StatusConflict, err.Error()))
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const contentPrefix = resttest.APIPrefix + "/admin/content"
+
+// createLesson create a published course -> unit -> lesson chain as admin
+func createLesson(t *testing.T, kit *resttest.Kit, title string) *lesson.LessonModel {
+	t.Helper()
+	course := new(lesson.CourseModel)
+	rec := kit.Do(http.MethodPost, contentPrefix+"/courses", map[string]interface{}{
+		"title":  title + " course",
+		"status": lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusCreated)
+	kit.DecodeJSON(rec, course)
+
+	unit := new(lesson.UnitModel)
+	rec = kit.Do(http.MethodPost, contentPrefix+"/units", map[string]interface{}{
+		"course_id": course.ID,
+		"title":     title + " unit",
+		"status":    lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusCreated)
+	kit.DecodeJSON(rec, unit)
+
+	entity := new(lesson.LessonModel)
+	rec = kit.Do(http.MethodPost, contentPrefix+"/lessons", map[string]interface{}{
+		"unit_id": unit.ID,
+		"title":   title,
+		"status":  lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusCreated)
+	kit.DecodeJSON(rec, entity)
+	if entity.ID == 0 {
+		t.Fatalf("Expected lesson %s to have an ID", title)
+	}
+	return entity
+}
+
+func TestContentUpdate(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+
+	rec := kit.Do(http.MethodPut, fmt.Sprintf("%s/units/%d", contentPrefix, entity.UnitID), map[string]interface{}{
+		"course_id": 1,
+		"index":     2,
+		"title":     "renamed unit",
+		"status":    lesson.StatusDraft,
+	})
+	kit.AssertStatus(rec, http.StatusOK)
+	rec = kit.Do(http.MethodPut, fmt.Sprintf("%s/lessons/%d", contentPrefix, entity.ID), map[string]interface{}{
+		"unit_id": entity.UnitID,
+		"title":   "renamed lesson",
+		"status":  lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusOK)
+	rec = kit.Do(http.MethodPut, contentPrefix+"/courses/1", map[string]interface{}{
+		"title":       "renamed course",
+		"description": "updated",
+		"status":      lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusOK)
+
+	var catalog []*lesson.CourseModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, contentPrefix+"/catalog", nil), &catalog)
+	if len(catalog) != 1 || catalog[0].Title != "renamed course" || catalog[0].Description != "updated" {
+		t.Fatalf("Expected course to be renamed, got %+v", catalog)
+	}
+	if len(catalog[0].Units) != 1 || catalog[0].Units[0].Title != "renamed unit" || catalog[0].Units[0].Status != lesson.StatusDraft {
+		t.Fatalf("Expected unit to be renamed and unpublished, got %+v", catalog[0].Units)
+	}
+	if lessons := catalog[0].Units[0].Lessons; len(lessons) != 1 || lessons[0].Title != "renamed lesson" {
+		t.Fatalf("Expected lesson to be renamed, got %+v", lessons)
+	}
+}
+
+func TestContentUpdateNotFound(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+
+	rec := kit.Do(http.MethodPut, contentPrefix+"/courses/42", map[string]interface{}{
+		"title":  "missing",
+		"status": lesson.StatusDraft,
+	})
+	kit.AssertError(rec, http.StatusNotFound, lesson.ErrCourseNotFound.Error())
+}
+
+func TestContentDeleteNotEmpty(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+
+	rec := kit.Do(http.MethodDelete, fmt.Sprintf("%s/units/%d", contentPrefix, entity.UnitID), nil)
+	kit.AssertError(rec, http.StatusConflict, lesson.ErrNotEmpty.Error())
+	rec = kit.Do(http.MethodDelete, fmt.Sprintf("%s/lessons/%d", contentPrefix, entity.ID), nil)
+	kit.AssertStatus(rec, http.StatusNoContent)
+	rec = kit.Do(http.MethodDelete, fmt.Sprintf("%s/units/%d", contentPrefix, entity.UnitID), nil)
+	kit.AssertStatus(rec, http.StatusNoContent)
+}
+
+func TestContentUpdateInvalidatesProgress(t *testing.T) {
+	cfg := resttest.DefaultConfig()
+	cfg.Cache.LessonProgress.TTL = time.Hour
+	kit := resttest.NewWithConfig(t, cfg)
+	kit.CreateUser("administrator", "password", user.RoleAdmin)
+	kit.CreateUser("learner", "password")
+	kit.Login("administrator", "password")
+	entity := createLesson(t, kit, "greetings")
+	kit.Login("learner", "password")
+	kit.AssertStatus(kit.Do(http.MethodPut, fmt.Sprintf("%s/lesson/%d/progress", resttest.APIPrefix, entity.ID),
+		map[string]interface{}{"progress": 0.5}), http.StatusOK)
+	// cached with the current title
+	kit.AssertStatus(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/progress", nil), http.StatusOK)
+
+	kit.Login("administrator", "password")
+	rec := kit.Do(http.MethodPut, fmt.Sprintf("%s/lessons/%d", contentPrefix, entity.ID), map[string]interface{}{
+		"unit_id": entity.UnitID,
+		"title":   "renamed lesson",
+		"status":  lesson.StatusPublished,
+	})
+	kit.AssertStatus(rec, http.StatusOK)
+
+	kit.Login("learner", "password")
+	var progress []*lesson.LessonProgressModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/progress", nil), &progress)
+	if len(progress) != 1 || progress[0].Title != "renamed lesson" {
+		t.Fatalf("Expected progress with the renamed lesson, got %+v", progress)
+	}
+}
@@ -0,0 +1,138 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+func TestLessonProgress(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	entity := createLesson(t, kit, "greetings")
+	kit.LoginAs("learner")
+
+	path := fmt.Sprintf("%s/lesson/%d/progress", resttest.APIPrefix, entity.ID)
+	rec := kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 0.5})
+	kit.AssertStatus(rec, http.StatusOK)
+	rec = kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 1})
+	kit.AssertStatus(rec, http.StatusOK)
+	progress := new(lesson.LessonProgressModel)
+	kit.DecodeJSON(rec, progress)
+	if progress.Progress != 1 || progress.CompletedTimestamp == 0 {
+		t.Fatalf("Expected lesson to be completed, got %+v", progress)
+	}
+
+	rec = kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 0.2})
+	kit.AssertError(rec, http.StatusConflict, lesson.ErrProgressRegression.Error())
+	rec = kit.Do(http.MethodPut, path, map[string]interface{}{"progress": 0, "reset": true})
+	kit.AssertStatus(rec, http.StatusOK)
+
+	var history []*lesson.ProgressHistoryModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, path+"/history", nil), &history)
+	if len(history) != 3 || !history[2].Reset {
+		t.Fatalf("Expected 3 snapshots ending with a reset, got %+v", history)
+	}
+}
+
+func TestLessonProgressValidation(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodPut, resttest.APIPrefix+"/lesson/1/progress", map[string]interface{}{"progress": 2})
+	kit.AssertValidationError(rec, "progress")
+	rec = kit.Do(http.MethodPut, resttest.APIPrefix+"/lesson/1/progress", map[string]interface{}{"progress": 0.5})
+	kit.AssertError(rec, http.StatusNotFound, lesson.ErrLessonNotFound.Error())
+}
+
+func TestLessonPrerequisites(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	first := createLesson(t, kit, "greetings")
+	second := createLesson(t, kit, "numbers")
+
+	path := fmt.Sprintf("%s/lessons/%d/prerequisites", contentPrefix, second.ID)
+	rec := kit.Do(http.MethodPut, path, map[string][]int64{"prerequisites": {first.ID}})
+	kit.AssertStatus(rec, http.StatusNoContent)
+	rec = kit.Do(http.MethodPut, fmt.Sprintf("%s/lessons/%d/prerequisites", contentPrefix, first.ID),
+		map[string][]int64{"prerequisites": {second.ID}})
+	kit.AssertError(rec, http.StatusConflict, lesson.ErrPrerequisiteCycle.Error())
+
+	kit.LoginAs("learner")
+	var states []*lesson.LessonStateModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/states", nil), &states)
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 lesson states, got %d", len(states))
+	}
+	for _, s := range states {
+		if s.LessonID == second.ID && !s.Locked {
+			t.Fatalf("Expected lesson %d to be locked by its prerequisite", second.ID)
+		}
+	}
+
+	next := new(lesson.RecommendationModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, resttest.APIPrefix+"/lesson/next", nil), next)
+	if next.LessonStateModel == nil || next.LessonID != first.ID || next.Reason != lesson.ReasonNext {
+		t.Fatalf("Expected lesson %d to be recommended, got %+v", first.ID, next)
+	}
+}
+
+// TestLessonPrerequisitesConcurrentCycle both writes pass the check on their own, only one of them may be saved
+func TestLessonPrerequisitesConcurrentCycle(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("administrator", user.RoleAdmin)
+	first := createLesson(t, kit, "greetings")
+	second := createLesson(t, kit, "numbers")
+	lu := lesson.NewLessonUseCase(lesson.NewLessonRepository(kit.DB), nil)
+	ctx := kit.Context()
+
+	for i := 0; i < 20; i++ {
+		errs := make(chan error, 2)
+		var wg sync.WaitGroup
+		for _, pair := range [][2]int64{{first.ID, second.ID}, {second.ID, first.ID}} {
+			wg.Add(1)
+			go func(lessonID, prerequisite int64) {
+				defer wg.Done()
+				errs <- lu.SetPrerequisites(ctx, lessonID, []int64{prerequisite})
+			}(pair[0], pair[1])
+		}
+		wg.Wait()
+		close(errs)
+
+		saved := 0
+		for err := range errs {
+			if err == nil {
+				saved++
+			} else if err != lesson.ErrPrerequisiteCycle {
+				t.Fatalf("SetPrerequisites() error = %v", err)
+			}
+		}
+		if saved != 1 {
+			t.Fatalf("Expected one of the prerequisites to be saved, %d were", saved)
+		}
+		for _, id := range []int64{first.ID, second.ID} {
+			if err := lu.SetPrerequisites(ctx, id, nil); err != nil {
+				t.Fatalf("Failed to clear prerequisites: %s", err)
+			}
+		}
+	}
+}
+
+func TestDeleteLessonWithProgress(t *testing.T) {
+	kit := resttest.New(t)
+	kit.CreateUser("administrator", "administrator-password", user.RoleAdmin)
+	kit.Login("administrator", "administrator-password")
+	entity := createLesson(t, kit, "greetings")
+	kit.LoginAs("learner")
+	rec := kit.Do(http.MethodPut, fmt.Sprintf("%s/lesson/%d/progress", resttest.APIPrefix, entity.ID), map[string]interface{}{"progress": 0.5})
+	kit.AssertStatus(rec, http.StatusOK)
+
+	kit.Login("administrator", "administrator-password")
+	rec = kit.Do(http.MethodDelete, fmt.Sprintf("%s/lessons/%d", contentPrefix, entity.ID), nil)
+	kit.AssertError(rec, http.StatusConflict, lesson.ErrLessonInUse.Error())
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+)
+
+// parseTimeParam parse optional RFC3339 query param, nil is returned if it's absent
+func parseTimeParam(c echo.Context, name string) (*time.Time, *validate.FieldError) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, validate.NewFieldError(name, fmt.Sprintf("%s must be in RFC3339 layout, %s", name, err.Error()))
+	}
+	return &t, nil
+}
+
+// parseBoolParam parse optional boolean query param, nil is returned if it's absent
+func parseBoolParam(c echo.Context, name string) (*bool, *validate.FieldError) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, validate.NewFieldError(name, fmt.Sprintf("%s must be a boolean", name))
+	}
+	return &b, nil
+}
+
+// parseIDParam parse numeric path param
+func parseIDParam(c echo.Context, name string) (int64, *validate.FieldError) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, validate.NewFieldError(name, fmt.Sprintf("%s must be a positive integer", name))
+	}
+	return id, nil
+}
+
+// parseDateParam parse optional query param in YYYY-MM-DD or RFC3339 layout, nil is returned if it's absent
+func parseDateParam(c echo.Context, name string) (*time.Time, *validate.FieldError) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, validate.NewFieldError(name, fmt.Sprintf("%s must be in YYYY-MM-DD or RFC3339 layout", name))
+	}
+	return &t, nil
+}
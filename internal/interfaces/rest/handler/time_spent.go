@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -18,6 +19,22 @@ type TimeSpentHandler struct {
 	jwtUtil          *auth.JWTUtil
 }
 
+type TimeSpentRecordModel struct {
+	SessionID  string `json:"session_id" validate:"required,max=64"`
+	Date       string `json:"date" validate:"required"` // YYYY-MM-DD
+	Vocabulary int    `json:"vocabulary" validate:"min=0,max=1440"`
+	Grammar    int    `json:"grammar" validate:"min=0,max=1440"`
+	Listening  int    `json:"listening" validate:"min=0,max=1440"`
+	Writing    int    `json:"writing" validate:"min=0,max=1440"`
+}
+
+type TimeSpentGoalModel struct {
+	Vocabulary int `json:"vocabulary" validate:"min=0,max=1440"`
+	Grammar    int `json:"grammar" validate:"min=0,max=1440"`
+	Listening  int `json:"listening" validate:"min=0,max=1440"`
+	Writing    int `json:"writing" validate:"min=0,max=1440"`
+}
+
 func NewTimeSpentHandler(
 	TimeSpentUseCase timespent.TimeSpentUseCase,
 	JWTUtil *auth.JWTUtil,
@@ -27,13 +44,21 @@ func NewTimeSpentHandler(
 	return handler
 }
 
+// HandleGetTimeSpent get time spent report between from and to, or the week containing ts if the range is absent
 func (tsh *TimeSpentHandler) HandleGetTimeSpent(c echo.Context) (err error) {
+	if c.QueryParam("from") != "" || c.QueryParam("to") != "" {
+		return tsh.handleGetTimeSpentReport(c)
+	}
+
 	tsu := tsh.timeSpentUseCase
 	ju := tsh.jwtUtil
 	ts := c.QueryParam("ts")
 	claims := ju.GetContextToken(c)
 	user := new(user.UserModel)
 	user.ID = claims.UID
+	if err := bindLocale(c, user); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	}
 
 	// validation
 	if err := tsh.validator.Empty("ts", ts); err != nil {
@@ -49,7 +74,221 @@ func (tsh *TimeSpentHandler) HandleGetTimeSpent(c echo.Context) (err error) {
 
 	timeSpent, err := tsu.GetUserTimeSpent(c.Request().Context(), user, &at)
 	if err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, timeSpent)
+}
+
+func (tsh *TimeSpentHandler) handleGetTimeSpentReport(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+	if err := bindLocale(c, user); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	}
+
+	var errs []*validate.FieldError
+	from, ferr := parseDateParam(c, "from")
+	if ferr != nil {
+		errs = append(errs, ferr)
+	} else if from == nil {
+		errs = append(errs, validate.NewFieldError("from", "from is required"))
+	}
+	to, ferr := parseDateParam(c, "to")
+	if ferr != nil {
+		errs = append(errs, ferr)
+	} else if to == nil {
+		errs = append(errs, validate.NewFieldError("to", "to is required"))
+	}
+	granularity := c.QueryParam("granularity")
+	switch granularity {
+	case "":
+		granularity = timespent.GranularityDay
+	case timespent.GranularityDay, timespent.GranularityWeek, timespent.GranularityMonth:
+	default:
+		errs = append(errs, validate.NewFieldError("granularity", "granularity must be one of (day week month)"))
+	}
+	if len(errs) > 0 {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", errs))
+	}
+
+	report, err := tsu.GetTimeSpentReport(c.Request().Context(), user, *from, *to, granularity)
+	if err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// HandleRecordTimeSpent record minutes spent on each skill in a day
+func (tsh *TimeSpentHandler) HandleRecordTimeSpent(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+	if err := bindLocale(c, user); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	}
+
+	post := new(TimeSpentRecordModel)
+	if err = c.Bind(&post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind time spent entity"))
+	}
+	if err := tsh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+	day, err := time.Parse("2006-01-02", post.Date)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", []*validate.FieldError{{
+			Domain: "date",
+			Reason: fmt.Sprintf("date must be in YYYY-MM-DD layout, %s", err.Error()),
+		}}))
+	}
+
+	timeSpent, err := tsu.RecordTimeSpent(c.Request().Context(), user, post.SessionID, &timespent.TimeSpentModel{
+		Vocabulary: post.Vocabulary,
+		Grammar:    post.Grammar,
+		Listening:  post.Listening,
+		Writing:    post.Writing,
+		TS:         &day,
+	})
+	if err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		if errors.Is(err, timespent.ErrSessionConflict) {
+			return c.JSON(http.StatusConflict, NewRESTStandardError(http.StatusConflict, err.Error()))
+		}
 		return err
 	}
 	return c.JSON(http.StatusOK, timeSpent)
 }
+
+// HandleGetStreak get current and longest learning streak
+func (tsh *TimeSpentHandler) HandleGetStreak(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+	if err := bindLocale(c, user); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	}
+
+	streak, err := tsu.GetStreak(c.Request().Context(), user)
+	if err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, streak)
+}
+
+// HandleGetGoal get daily goals
+func (tsh *TimeSpentHandler) HandleGetGoal(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	goal, err := tsu.GetGoal(c.Request().Context(), user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, goal)
+}
+
+// HandleSetGoal set daily goals in minutes for each skill
+func (tsh *TimeSpentHandler) HandleSetGoal(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+
+	post := new(TimeSpentGoalModel)
+	if err = c.Bind(&post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind goal entity"))
+	}
+	if err := tsh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	goal := &timespent.GoalModel{
+		Vocabulary: post.Vocabulary,
+		Grammar:    post.Grammar,
+		Listening:  post.Listening,
+		Writing:    post.Writing,
+	}
+	if err := tsu.SetGoal(c.Request().Context(), user, goal); err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, goal)
+}
+
+// HandleGetGoalProgress get progress of daily goals in the day containing ts, defaults to today
+func (tsh *TimeSpentHandler) HandleGetGoalProgress(c echo.Context) (err error) {
+	tsu := tsh.timeSpentUseCase
+	ju := tsh.jwtUtil
+	claims := ju.GetContextToken(c)
+	user := new(user.UserModel)
+	user.ID = claims.UID
+	if err := bindLocale(c, user); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	}
+	at := time.Now()
+	if ts, err := parseTimeParam(c, "ts"); err != nil {
+		return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate params", []*validate.FieldError{err}))
+	} else if ts != nil {
+		at = *ts
+	}
+
+	progress, err := tsu.GetGoalProgress(c.Request().Context(), user, at)
+	if err != nil {
+		if isTimeSpentInputError(err) {
+			return c.JSON(http.StatusBadRequest, NewRESTStandardError(http.StatusBadRequest, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, progress)
+}
+
+// bindLocale override time zone and first day of week of u with tz and week_start query params
+func bindLocale(c echo.Context, u *user.UserModel) *validate.FieldError {
+	u.Timezone = c.QueryParam("tz")
+	if _, err := u.Location(); err != nil {
+		return validate.NewFieldError("tz", "tz must be an IANA time zone name")
+	}
+	switch ws := c.QueryParam("week_start"); ws {
+	case "", user.WeekStartMonday, user.WeekStartSunday:
+		u.WeekStart = ws
+	default:
+		return validate.NewFieldError("week_start", "week_start must be one of (monday sunday)")
+	}
+	return nil
+}
+
+func isTimeSpentInputError(err error) bool {
+	return errors.Is(err, timespent.ErrImplausibleTimeSpent) ||
+		errors.Is(err, timespent.ErrFutureDate) ||
+		errors.Is(err, timespent.ErrInvalidRange) ||
+		errors.Is(err, timespent.ErrRangeTooLarge) ||
+		errors.Is(err, user.ErrInvalidTimezone)
+}
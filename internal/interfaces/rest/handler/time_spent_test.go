@@ -0,0 +1,238 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	timespent "github.com/pot-code/go-boilerplate/internal/time_spent"
+)
+
+const timeSpentPath = resttest.APIPrefix + "/time-spent"
+
+func recordTimeSpent(kit *resttest.Kit, sessionID, date string, vocabulary int) *httptest.ResponseRecorder {
+	return kit.Do(http.MethodPost, timeSpentPath, map[string]interface{}{
+		"session_id": sessionID,
+		"date":       date,
+		"vocabulary": vocabulary,
+	})
+}
+
+func TestRecordTimeSpentAccumulates(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 10), http.StatusOK)
+	rec := recordTimeSpent(kit, "session-2", today, 15)
+	kit.AssertStatus(rec, http.StatusOK)
+	result := new(timespent.TimeSpentModel)
+	kit.DecodeJSON(rec, result)
+	if result.Vocabulary != 25 {
+		t.Fatalf("Expected 25 minutes, got %d", result.Vocabulary)
+	}
+}
+
+func TestRecordTimeSpentReplay(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 10), http.StatusOK)
+	rec := recordTimeSpent(kit, "session-1", today, 10)
+	kit.AssertStatus(rec, http.StatusOK)
+	result := new(timespent.TimeSpentModel)
+	kit.DecodeJSON(rec, result)
+	if result.Vocabulary != 10 {
+		t.Fatalf("Expected the replay to have no effect, got %d minutes", result.Vocabulary)
+	}
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	rec = recordTimeSpent(kit, "session-1", yesterday, 10)
+	kit.AssertError(rec, http.StatusConflict, timespent.ErrSessionConflict.Error())
+}
+
+func TestRecordTimeSpentConcurrentReplay(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	const n = 8
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = recordTimeSpent(kit, "session-1", today, 10)
+		}(i)
+	}
+	wg.Wait()
+	for _, rec := range recs {
+		kit.AssertStatus(rec, http.StatusOK)
+	}
+
+	rec := recordTimeSpent(kit, "session-2", today, 0)
+	result := new(timespent.TimeSpentModel)
+	kit.DecodeJSON(rec, result)
+	if result.Vocabulary != 10 {
+		t.Fatalf("Expected the session to be recorded once, got %d minutes", result.Vocabulary)
+	}
+}
+
+func TestRecordTimeSpentImplausible(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 1000), http.StatusOK)
+	rec := recordTimeSpent(kit, "session-2", today, 1000)
+	kit.AssertError(rec, http.StatusBadRequest, timespent.ErrImplausibleTimeSpent.Error())
+	// the rejected session can be retried with a plausible record
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", today, 10), http.StatusOK)
+}
+
+func TestSetGoal(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	kit.AssertStatus(kit.Do(http.MethodPut, timeSpentPath+"/goals", map[string]int{"vocabulary": 10}), http.StatusOK)
+	kit.AssertStatus(kit.Do(http.MethodPut, timeSpentPath+"/goals", map[string]int{"grammar": 20}), http.StatusOK)
+
+	goal := new(timespent.GoalModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"/goals", nil), goal)
+	if goal.Vocabulary != 0 || goal.Grammar != 20 {
+		t.Fatalf("Expected the goal to be replaced, got %+v", goal)
+	}
+}
+
+func TestStreak(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	now := time.Now().UTC()
+
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", now.AddDate(0, 0, -1).Format("2006-01-02"), 10), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", now.Format("2006-01-02"), 10), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-3", now.Format("2006-01-02"), 10), http.StatusOK)
+
+	streak := new(timespent.StreakModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"/streak", nil), streak)
+	if streak.Current != 2 || streak.Longest != 2 {
+		t.Fatalf("Expected a 2 day streak, got %+v", streak)
+	}
+}
+
+func TestTimeSpentReport(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	// monday, tuesday and monday of the following week
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", "2020-01-06", 10), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-2", "2020-01-07", 20), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-3", "2020-01-13", 5), http.StatusOK)
+
+	rec := kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06&to=2020-01-19&granularity=week", nil)
+	kit.AssertStatus(rec, http.StatusOK)
+	report := new(timespent.TimeSpentReportModel)
+	kit.DecodeJSON(rec, report)
+	if len(report.Buckets) != 2 || report.Buckets[0].Total != 30 || report.Buckets[1].Total != 5 || report.Totals.Total != 35 {
+		t.Fatalf("Unexpected weekly report %+v", report)
+	}
+	if want := time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC).Unix() * 1e3; report.Buckets[0].Timestamp != want {
+		t.Fatalf("Expected the first week to start on monday, got %d", report.Buckets[0].Timestamp)
+	}
+
+	// the week of the caller's locale
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06&to=2020-01-19&granularity=week&week_start=sunday", nil)
+	report = new(timespent.TimeSpentReportModel)
+	kit.DecodeJSON(rec, report)
+	if len(report.Buckets) != 3 || report.Buckets[0].Total != 30 || report.Buckets[1].Total != 5 {
+		t.Fatalf("Unexpected sunday based weekly report %+v", report)
+	}
+
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06&to=2020-01-07", nil)
+	report = new(timespent.TimeSpentReportModel)
+	kit.DecodeJSON(rec, report)
+	if report.Granularity != timespent.GranularityDay || len(report.Buckets) != 2 || report.Buckets[1].Vocabulary != 20 {
+		t.Fatalf("Unexpected daily report %+v", report)
+	}
+}
+
+func TestTimeSpentReportValidation(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+
+	rec := kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06", nil)
+	kit.AssertValidationError(rec, "to")
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06&to=2020-01-07&granularity=year", nil)
+	kit.AssertValidationError(rec, "granularity")
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-06&to=2020-01-07&tz=Mars/Olympus", nil)
+	kit.AssertValidationError(rec, "tz")
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2020-01-07&to=2020-01-06", nil)
+	kit.AssertError(rec, http.StatusBadRequest, timespent.ErrInvalidRange.Error())
+	rec = kit.Do(http.MethodGet, timeSpentPath+"?from=2000-01-01&to=2020-01-01", nil)
+	kit.AssertError(rec, http.StatusBadRequest, timespent.ErrRangeTooLarge.Error())
+}
+
+func TestTimeSpentWeekInTimezone(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", "2020-01-05", 10), http.StatusOK)
+
+	// monday 01:00 in UTC is still sunday in New York, the week before is returned
+	const ts = "2020-01-06T01:00:00Z"
+	var days []*timespent.TimeSpentModel
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"?ts="+ts, nil), &days)
+	if len(days) != 0 {
+		t.Fatalf("Expected no time spent in the UTC week, got %+v", days)
+	}
+	days = nil
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"?tz=America/New_York&ts="+ts, nil), &days)
+	if len(days) != 1 || days[0].Vocabulary != 10 {
+		t.Fatalf("Expected the sunday record in the New York week, got %+v", days)
+	}
+
+	// the saved preferences apply when the query doesn't override them
+	rec := kit.Do(http.MethodPut, resttest.APIPrefix+"/user/preferences", map[string]string{
+		"timezone":   "America/New_York",
+		"week_start": "monday",
+	})
+	kit.AssertStatus(rec, http.StatusOK)
+	days = nil
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"?ts="+ts, nil), &days)
+	if len(days) != 1 {
+		t.Fatalf("Expected the saved time zone to be used, got %+v", days)
+	}
+}
+
+func TestGoalProgress(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	kit.AssertStatus(kit.Do(http.MethodPut, timeSpentPath+"/goals", map[string]int{"vocabulary": 20, "grammar": 10}), http.StatusOK)
+	kit.AssertStatus(recordTimeSpent(kit, "session-1", today, 25), http.StatusOK)
+
+	progress := new(timespent.GoalProgressModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, timeSpentPath+"/goals/progress", nil), progress)
+	if len(progress.Skills) != 2 || progress.Met {
+		t.Fatalf("Expected 2 goals, not all met, got %+v", progress)
+	}
+	for _, s := range progress.Skills {
+		if s.Skill == "vocabulary" && (!s.Met || s.Spent != 25) || s.Skill == "grammar" && (s.Met || s.Spent != 0) {
+			t.Fatalf("Unexpected progress of %s %+v", s.Skill, s)
+		}
+	}
+
+	// days without time spent have no progress
+	rec := kit.Do(http.MethodGet, timeSpentPath+"/goals/progress?ts=2020-01-06T12:00:00Z", nil)
+	kit.AssertStatus(rec, http.StatusOK)
+	progress = new(timespent.GoalProgressModel)
+	kit.DecodeJSON(rec, progress)
+	if progress.Met || progress.Skills[0].Spent != 0 {
+		t.Fatalf("Expected no progress on a past day, got %+v", progress)
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
@@ -19,12 +20,16 @@ var (
 	ErrNoSuchUser = errors.New("No such user or password is incorrect")
 	// ErrUserTooManyRetry excess maximum retry count
 	ErrUserTooManyRetry = errors.New("Excess maximum retry count")
+	// ErrUserLocked user is locked by administrator
+	ErrUserLocked = errors.New("User is locked")
+	// ErrPasswordResetRequired user must reset password before signing in
+	ErrPasswordResetRequired = errors.New("Password reset is required")
 )
 
 // UserHandler user related operations
 type UserHandler struct {
 	jwtUtil        *auth.JWTUtil
-	conn           driver.ITransactionalDB
+	txRunner       *driver.TxRunner
 	userRepository user.UserRepository
 	kvStore        driver.KeyValueDB
 	userUseCase    user.UserUseCase
@@ -71,10 +76,21 @@ func (usm *UserSignUpModel) ToDomain() *user.UserModel {
 	}
 }
 
+type UserResetPasswordModel struct {
+	Username    string `json:"username" validate:"required,min=6,max=64"`
+	Password    string `json:"password" validate:"required,min=6"`
+	NewPassword string `json:"new_password" validate:"required,min=6,nefield=Password"`
+}
+
+type UserPreferencesModel struct {
+	Timezone  string `json:"timezone" validate:"required,max=64"`
+	WeekStart string `json:"week_start" validate:"required,oneof=monday sunday"`
+}
+
 // NewUserHandler create an user controller instance
 func NewUserHandler(
 	JWTUtil *auth.JWTUtil,
-	conn driver.ITransactionalDB,
+	TxRunner *driver.TxRunner,
 	UserRepository user.UserRepository,
 	KVStore driver.KeyValueDB,
 	UserUseCase user.UserUseCase,
@@ -82,15 +98,13 @@ func NewUserHandler(
 	RetryTimeout time.Duration,
 	Validator validate.Validator,
 ) *UserHandler {
-	handler := &UserHandler{JWTUtil, conn, UserRepository, KVStore, UserUseCase, Validator, MaximumRetry, RetryTimeout}
+	handler := &UserHandler{JWTUtil, TxRunner, UserRepository, KVStore, UserUseCase, Validator, MaximumRetry, RetryTimeout}
 	return handler
 }
 
 // HandleSignIn ...
 func (uh *UserHandler) HandleSignIn(c echo.Context) (err error) {
 	ju := uh.jwtUtil
-	repo := uh.userRepository
-	conn := uh.conn
 	ctx := c.Request().Context()
 
 	// parse body
@@ -105,57 +119,134 @@ func (uh *UserHandler) HandleSignIn(c echo.Context) (err error) {
 			NewRESTValidationError(http.StatusBadRequest, "Failed to validate credentials", err))
 	}
 
-	tx, err := conn.BeginTx(ctx, &driver.TxOptions{
-		Isolation: sql.LevelRepeatableRead,
+	var (
+		entity *user.UserModel
+		roles  []string
+		denied error // sign in is rejected, the login state is still committed
+	)
+	err = uh.txRunner.RunInTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelRepeatableRead,
+		AccessMode: driver.AccessReadWrite,
+	}, func(tx driver.ITransactionalDB) (err error) {
+		repo := uh.userRepository.WithTx(tx)
+		roles = nil
+
+		entity, denied, err = uh.checkCredential(ctx, repo, post.Username, post.Password)
+		if err != nil || denied != nil {
+			return err
+		}
+		if entity.PasswordReset {
+			denied = ErrPasswordResetRequired
+			return nil
+		}
+
+		// reset retry number
+		entity.LoginRetry = 0
+		entity.LastLogin = time.Now().Unix()
+		if err := repo.UpdateLogin(ctx, entity); err != nil {
+			return err
+		}
+		roles, err = repo.GetRoles(ctx, entity.ID)
+		return err
 	})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError,
-			NewRESTStandardError(http.StatusInternalServerError, err.Error()))
+		return err
+	}
+	switch denied {
+	case nil:
+	case ErrNoSuchUser:
+		return c.JSON(http.StatusUnauthorized, NewRESTStandardError(http.StatusUnauthorized, denied.Error()))
+	default:
+		return c.JSON(http.StatusForbidden, NewRESTStandardError(http.StatusForbidden, denied.Error()))
 	}
-	defer tx.Commit(ctx)
 
-	// find user
-	entity, err := repo.FindByCredential(ctx, post.ToDomain())
+	// issue JWT
+	tokenStr, err := ju.GenerateTokenStr(entity.ID, entity.Email, entity.Username, roles)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError,
-			NewRESTStandardError(http.StatusInternalServerError, err.Error()))
+		return err
 	}
-	if entity == nil {
-		return c.JSON(http.StatusUnauthorized, NewRESTStandardError(http.StatusUnauthorized, ErrNoSuchUser.Error()))
+	ju.SetClientToken(c, tokenStr)
+	return nil
+}
+
+// HandleResetPassword change password with the current credential, it also clears the forced reset flag
+func (uh *UserHandler) HandleResetPassword(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+
+	post := new(UserResetPasswordModel)
+	if err = c.Bind(&post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind user entity"))
 	}
-	now := time.Now().Unix() // seconds
-	if entity.LoginRetry >= uh.maximumRetry && now-entity.LastLogin < int64(uh.retryTimeout.Seconds()) {
-		return c.JSON(http.StatusForbidden, NewRESTStandardError(http.StatusForbidden, ErrUserTooManyRetry.Error()))
-	}
-
-	// check credentials
-	if err := bcrypt.CompareHashAndPassword([]byte(entity.Password), []byte(post.Password)); err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			if entity.LoginRetry == uh.maximumRetry {
-				entity.LoginRetry = 1
-			} else {
-				entity.LoginRetry++
-			}
-			entity.LastLogin = now
-			repo.UpdateLogin(ctx, entity)
-			return c.JSON(http.StatusUnauthorized, NewRESTStandardError(http.StatusUnauthorized, ErrNoSuchUser.Error()))
-		}
+	if err := uh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	password, err := bcrypt.GenerateFromPassword([]byte(post.NewPassword), bcrypt.MinCost)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError,
 			NewRESTStandardError(http.StatusInternalServerError, "Failed to process user credential"))
 	}
 
-	// reset retry number
-	entity.LoginRetry = 0
-	entity.LastLogin = now
-	repo.UpdateLogin(ctx, entity)
+	var denied error // reset is rejected, the login state is still committed
+	err = uh.txRunner.RunInTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelRepeatableRead,
+		AccessMode: driver.AccessReadWrite,
+	}, func(tx driver.ITransactionalDB) error {
+		repo := uh.userRepository.WithTx(tx)
 
-	// issue JWT
-	tokenStr, err := ju.GenerateTokenStr(entity.ID, entity.Email, entity.Username)
+		entity, rejected, err := uh.checkCredential(ctx, repo, post.Username, post.Password)
+		denied = rejected
+		if err != nil || denied != nil {
+			return err
+		}
+		return repo.UpdatePassword(ctx, entity.ID, string(password))
+	})
 	if err != nil {
 		return err
 	}
-	ju.SetClientToken(c, tokenStr)
-	return nil
+	switch denied {
+	case nil:
+	case ErrNoSuchUser:
+		return c.JSON(http.StatusUnauthorized, NewRESTStandardError(http.StatusUnauthorized, denied.Error()))
+	default:
+		return c.JSON(http.StatusForbidden, NewRESTStandardError(http.StatusForbidden, denied.Error()))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkCredential find the user of username and verify password, a rejected credential is returned as denied.
+// A wrong password counts as a failed login, the retry state is updated through repo
+func (uh *UserHandler) checkCredential(ctx context.Context, repo user.UserRepository, username, password string) (entity *user.UserModel, denied error, err error) {
+	entity, err = repo.FindByCredential(ctx, &user.UserModel{Username: username})
+	if err != nil {
+		return nil, nil, err
+	}
+	if entity == nil {
+		return nil, ErrNoSuchUser, nil
+	}
+	if entity.Locked {
+		return nil, ErrUserLocked, nil
+	}
+	now := time.Now().Unix() // seconds
+	if entity.LoginRetry >= uh.maximumRetry && now-entity.LastLogin < int64(uh.retryTimeout.Seconds()) {
+		return nil, ErrUserTooManyRetry, nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(entity.Password), []byte(password)); err != nil {
+		if err != bcrypt.ErrMismatchedHashAndPassword {
+			return nil, nil, err
+		}
+		if entity.LoginRetry == uh.maximumRetry {
+			entity.LoginRetry = 1
+		} else {
+			entity.LoginRetry++
+		}
+		entity.LastLogin = now
+		return nil, ErrNoSuchUser, repo.UpdateLogin(ctx, entity)
+	}
+	return entity, nil, nil
 }
 
 // HandleSignUp ...
@@ -201,11 +292,12 @@ func (uh *UserHandler) HandleSignUp(c echo.Context) (err error) {
 func (uh *UserHandler) HandleSignOut(c echo.Context) (err error) {
 	ju := uh.jwtUtil
 	kv := uh.kvStore
+	ctx := c.Request().Context()
 
 	if tokenStr, err := ju.ExtractToken(c); err == nil {
 		if token, err := ju.Validate(tokenStr); err == nil {
 			ju.ClearClientToken(c)
-			return kv.SetEX(tokenStr, "", token.TimeRemaining())
+			return kv.SetEX(ctx, tokenStr, "", token.TimeRemaining())
 		}
 		return c.NoContent(http.StatusForbidden)
 	}
@@ -234,3 +326,43 @@ func (uh *UserHandler) HandleUserExists(c echo.Context) (err error) {
 	}
 	return c.JSON(http.StatusOK, existing)
 }
+
+// HandleGetPreferences get time zone and first day of week
+func (uh *UserHandler) HandleGetPreferences(c echo.Context) (err error) {
+	claims := uh.jwtUtil.GetContextToken(c)
+	entity := &user.UserModel{ID: claims.UID}
+	if err := uh.userUseCase.GetPreferences(c.Request().Context(), entity); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, &UserPreferencesModel{entity.Timezone, entity.WeekStart})
+}
+
+// HandleUpdatePreferences update time zone and first day of week
+func (uh *UserHandler) HandleUpdatePreferences(c echo.Context) (err error) {
+	claims := uh.jwtUtil.GetContextToken(c)
+	post := new(UserPreferencesModel)
+	if err = c.Bind(&post); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity,
+			NewRESTStandardError(http.StatusUnprocessableEntity, "Failed to bind preferences"))
+	}
+	if err := uh.validator.Struct(post); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields", err))
+	}
+
+	entity := &user.UserModel{ID: claims.UID, Timezone: post.Timezone, WeekStart: post.WeekStart}
+	if err := uh.userUseCase.UpdatePreferences(c.Request().Context(), entity); err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidTimezone):
+			return c.JSON(http.StatusBadRequest, NewRESTValidationError(http.StatusBadRequest, "Failed to validate fields",
+				[]*validate.FieldError{validate.NewFieldError("timezone", err.Error())}))
+		case errors.Is(err, user.ErrUserNotFound):
+			return c.JSON(http.StatusNotFound, NewRESTStandardError(http.StatusNotFound, err.Error()))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, post)
+}
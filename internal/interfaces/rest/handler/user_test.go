@@ -0,0 +1,93 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/handler"
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/resttest"
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+const passwordPath = resttest.APIPrefix + "/user/password"
+
+func TestResetPassword(t *testing.T) {
+	kit := resttest.New(t)
+	kit.CreateUser("learner", "old-password")
+
+	rec := kit.Do(http.MethodPut, passwordPath, map[string]string{
+		"username":     "learner",
+		"password":     "old-password",
+		"new_password": "new-password",
+	})
+	kit.AssertStatus(rec, http.StatusNoContent)
+
+	rec = kit.Do(http.MethodPost, resttest.APIPrefix+"/user/login", map[string]string{
+		"username": "learner",
+		"password": "old-password",
+	})
+	kit.AssertStatus(rec, http.StatusUnauthorized)
+	kit.Login("learner", "new-password")
+}
+
+func TestResetPasswordWrongCredential(t *testing.T) {
+	kit := resttest.New(t)
+	kit.CreateUser("learner", "old-password")
+
+	rec := kit.Do(http.MethodPut, passwordPath, map[string]string{
+		"username":     "learner",
+		"password":     "wrong-password",
+		"new_password": "new-password",
+	})
+	kit.AssertError(rec, http.StatusUnauthorized, handler.ErrNoSuchUser.Error())
+
+	// the failed attempt is committed even though the reset is rejected
+	stored, err := kit.UserRepo.FindByCredential(kit.Context(), &user.UserModel{Username: "learner"})
+	if err != nil {
+		t.Fatalf("Failed to find user: %s", err)
+	}
+	if stored.LoginRetry != 1 {
+		t.Fatalf("Expected login retry 1, got %d", stored.LoginRetry)
+	}
+	kit.Login("learner", "old-password")
+}
+
+func TestResetPasswordLockedUser(t *testing.T) {
+	kit := resttest.New(t)
+	entity := kit.CreateUser("learner", "old-password")
+	if err := kit.UserRepo.SetLocked(kit.Context(), entity.ID, true); err != nil {
+		t.Fatalf("Failed to lock user: %s", err)
+	}
+
+	rec := kit.Do(http.MethodPut, passwordPath, map[string]string{
+		"username":     "learner",
+		"password":     "old-password",
+		"new_password": "new-password",
+	})
+	kit.AssertError(rec, http.StatusForbidden, handler.ErrUserLocked.Error())
+}
+
+func TestPreferences(t *testing.T) {
+	kit := resttest.New(t)
+	kit.LoginAs("learner")
+	path := resttest.APIPrefix + "/user/preferences"
+
+	preferences := new(handler.UserPreferencesModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, path, nil), preferences)
+	if preferences.Timezone != "UTC" || preferences.WeekStart != user.WeekStartMonday {
+		t.Fatalf("Unexpected default preferences %+v", preferences)
+	}
+
+	rec := kit.Do(http.MethodPut, path, map[string]string{"timezone": "Asia/Tokyo", "week_start": user.WeekStartSunday})
+	kit.AssertStatus(rec, http.StatusOK)
+	preferences = new(handler.UserPreferencesModel)
+	kit.DecodeJSON(kit.Do(http.MethodGet, path, nil), preferences)
+	if preferences.Timezone != "Asia/Tokyo" || preferences.WeekStart != user.WeekStartSunday {
+		t.Fatalf("Preferences were not saved, got %+v", preferences)
+	}
+
+	rec = kit.Do(http.MethodPut, path, map[string]string{"timezone": "Mars/Olympus", "week_start": user.WeekStartMonday})
+	kit.AssertValidationError(rec, "timezone")
+	rec = kit.Do(http.MethodPut, path, map[string]string{"timezone": "UTC", "week_start": "friday"})
+	kit.AssertValidationError(rec, "week_start")
+}
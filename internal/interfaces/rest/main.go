@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"context"
+	"errors"
 	"expvar"
 	"fmt"
 	"log"
@@ -10,12 +12,14 @@ import (
 
 	"github.com/labstack/echo/v4"
 	echo_middleware "github.com/labstack/echo/v4/middleware"
+	"github.com/pot-code/go-boilerplate/internal/importer"
 	infra "github.com/pot-code/go-boilerplate/internal/infrastructure"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/auth"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
 	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/handler"
 	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/middleware"
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
 	"github.com/pot-code/go-boilerplate/internal/lesson"
 	timespent "github.com/pot-code/go-boilerplate/internal/time_spent"
 	"github.com/pot-code/go-boilerplate/internal/user"
@@ -23,7 +27,7 @@ import (
 	"go.uber.org/zap"
 )
 
-// Serve create http transport server
+// Serve create http transport server and listen on the configured address
 func Serve(
 	conn driver.ITransactionalDB,
 	rdb driver.KeyValueDB,
@@ -32,8 +36,31 @@ func Serve(
 	UserRepo user.UserRepository,
 	LessonUseCase lesson.LessonUseCase,
 	TimeSpentUseCase timespent.TimeSpentUseCase,
+	LeaderboardUseCase leaderboard.LeaderboardUseCase,
+	ImporterUseCase importer.ImporterUseCase,
 	logger *zap.Logger,
 ) {
+	server := NewServer(conn, rdb, option, UserUserCase, UserRepo, LessonUseCase, TimeSpentUseCase, LeaderboardUseCase, ImporterUseCase, logger)
+	addr := fmt.Sprintf("%s:%d", option.Host, option.Port)
+	logger.Info("Start http server", zap.String("address", addr))
+	if err := http.ListenAndServe(addr, server); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewServer create the http handler of all endpoints, it can be served by Serve or tested with httptest
+func NewServer(
+	conn driver.ITransactionalDB,
+	rdb driver.KeyValueDB,
+	option *infra.AppConfig,
+	UserUserCase user.UserUseCase,
+	UserRepo user.UserRepository,
+	LessonUseCase lesson.LessonUseCase,
+	TimeSpentUseCase timespent.TimeSpentUseCase,
+	LeaderboardUseCase leaderboard.LeaderboardUseCase,
+	ImporterUseCase importer.ImporterUseCase,
+	logger *zap.Logger,
+) http.Handler {
 	var (
 		app       = echo.New()
 		validator = validate.NewValidator()
@@ -43,11 +70,27 @@ func Serve(
 			option.Security.TokenName,
 			option.SessionTimeout)
 		jwtMiddleware = middleware.VerifyToken(jwtUtil, &middleware.ValidateTokenOption{
-			InBlackList: func(token string) (bool, error) {
-				return rdb.Exists(token)
+			InBlackList: func(ctx context.Context, token string) (bool, error) {
+				return rdb.Exists(ctx, token)
 			},
 		})
-		refreshMiddleware = middleware.RefreshToken(jwtUtil)
+		loadAccount = func(ctx context.Context, uid string) ([]string, bool, error) {
+			entity, err := UserUserCase.GetUser(ctx, uid)
+			if errors.Is(err, user.ErrUserNotFound) {
+				return nil, true, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			return entity.Roles, entity.Locked, nil
+		}
+		refreshMiddleware = middleware.RefreshToken(jwtUtil, &middleware.RefreshTokenOption{LoadAccount: loadAccount})
+		adminMiddleware   = middleware.RequireRole(jwtUtil, user.RoleAdmin, &middleware.RequireRoleOption{LoadAccount: loadAccount})
+		txRunner          = driver.NewTxRunner(conn, &driver.TxRetryConfig{
+			MaxAttempts: option.Database.TxMaxAttempts,
+			BaseDelay:   option.Database.TxRetryDelay,
+			MaxDelay:    option.Database.TxMaxRetryDelay,
+		})
 	)
 
 	registerLivenessProbe(app, conn, rdb)
@@ -82,16 +125,27 @@ func Serve(
 	app.Use(middleware.AbortRequest(&middleware.AbortRequestOption{
 		Timeout: option.RequestTimeout,
 	}))
+	app.Use(middleware.ReadYourWrites(&middleware.ReadYourWritesOption{
+		Window: option.Database.ReplicaStickyWindow,
+	}))
 
 	var (
 		UserHandler = handler.NewUserHandler(
-			jwtUtil, conn, UserRepo, rdb, UserUserCase,
+			jwtUtil, txRunner, UserRepo, rdb, UserUserCase,
 			option.Security.MaxLoginAttempts,
 			option.Security.RetryTimeout,
 			validator,
 		)
-		LessonHandler    = handler.NewLessonHandler(LessonUseCase, jwtUtil)
-		TimeSpentHandler = handler.NewTimeSpentHandler(TimeSpentUseCase, jwtUtil, validator)
+		AdminHandler = handler.NewAdminHandler(UserUserCase,
+			option.Security.MaxLoginAttempts,
+			option.Security.RetryTimeout,
+			validator,
+		)
+		LessonHandler      = handler.NewLessonHandler(LessonUseCase, jwtUtil, validator)
+		TimeSpentHandler   = handler.NewTimeSpentHandler(TimeSpentUseCase, jwtUtil, validator)
+		LeaderboardHandler = handler.NewLeaderboardHandler(LeaderboardUseCase, jwtUtil, validator)
+		ExportHandler      = handler.NewExportHandler(TimeSpentUseCase, LessonUseCase, UserUserCase, jwtUtil)
+		ImportHandler      = handler.NewImportHandler(ImporterUseCase)
 	)
 
 	createEndpoint(app,
@@ -106,6 +160,61 @@ func Serve(
 						{"PUT", "/sign-out", UserHandler.HandleSignOut, nil},
 						{"POST", "/sign-up", UserHandler.HandleSignUp, nil},
 						{"GET", "/exists", UserHandler.HandleUserExists, nil},
+						{"PUT", "/password", UserHandler.HandleResetPassword, nil},
+						{"GET", "/preferences", UserHandler.HandleGetPreferences, []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware}},
+						{"PUT", "/preferences", UserHandler.HandleUpdatePreferences, []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware}},
+					},
+				},
+				{
+					prefix:      "/admin/users",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware, adminMiddleware},
+					routes: []*route{
+						{"GET", "", AdminHandler.HandleListUsers, nil},
+						{"GET", "/:id", AdminHandler.HandleGetUser, nil},
+						{"PUT", "/:id/lock", AdminHandler.HandleLockUser, nil},
+						{"PUT", "/:id/unlock", AdminHandler.HandleUnlockUser, nil},
+						{"PUT", "/:id/password-reset", AdminHandler.HandleForcePasswordReset, nil},
+						{"PUT", "/:id/roles", AdminHandler.HandleAssignRoles, nil},
+						{"GET", "/:id/export/time-spent", ExportHandler.HandleExportTimeSpent, nil},
+						{"GET", "/:id/export/lesson-progress", ExportHandler.HandleExportLessonProgress, nil},
+					},
+				},
+				{
+					prefix:      "/admin/content",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware, adminMiddleware},
+					routes: []*route{
+						{"GET", "/catalog", LessonHandler.HandleGetFullCatalog, nil},
+						{"POST", "/courses", LessonHandler.HandleCreateCourse, nil},
+						{"PUT", "/courses/:id", LessonHandler.HandleUpdateCourse, nil},
+						{"DELETE", "/courses/:id", LessonHandler.HandleDeleteCourse, nil},
+						{"POST", "/units", LessonHandler.HandleCreateUnit, nil},
+						{"PUT", "/units/:id", LessonHandler.HandleUpdateUnit, nil},
+						{"DELETE", "/units/:id", LessonHandler.HandleDeleteUnit, nil},
+						{"POST", "/lessons", LessonHandler.HandleCreateLesson, nil},
+						{"PUT", "/lessons/:id", LessonHandler.HandleUpdateLesson, nil},
+						{"DELETE", "/lessons/:id", LessonHandler.HandleDeleteLesson, nil},
+						{"PUT", "/lessons/:id/prerequisites", LessonHandler.HandleSetPrerequisites, nil},
+					},
+				},
+				{
+					prefix:      "/admin/import",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware, adminMiddleware},
+					routes: []*route{
+						{"POST", "/lessons", ImportHandler.HandleImportLessons, nil},
+						{"POST", "/progress", ImportHandler.HandleImportProgress, nil},
+					},
+				},
+				{
+					prefix:      "/admin/leaderboards",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware, adminMiddleware},
+					routes: []*route{
+						{"POST", "/rebuild", LeaderboardHandler.HandleRebuild, nil},
+					},
+				},
+				{
+					prefix: "/catalog",
+					routes: []*route{
+						{"GET", "", LessonHandler.HandleGetCatalog, nil},
 					},
 				},
 				{
@@ -113,13 +222,39 @@ func Serve(
 					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware},
 					routes: []*route{
 						{"GET", "/progress", LessonHandler.HandleGetLessonProgress, nil},
+						{"GET", "/states", LessonHandler.HandleGetLessonStates, nil},
+						{"GET", "/next", LessonHandler.HandleGetNextLesson, nil},
+						{"PUT", "/:id/progress", LessonHandler.HandleUpdateLessonProgress, nil},
+						{"GET", "/:id/progress/history", LessonHandler.HandleGetLessonProgressHistory, nil},
 					},
 				},
 				{
 					prefix:      "/time-spent",
 					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware},
 					routes: []*route{
+						{"GET", "", TimeSpentHandler.HandleGetTimeSpent, nil},
 						{"GET", "/", TimeSpentHandler.HandleGetTimeSpent, nil},
+						{"POST", "", TimeSpentHandler.HandleRecordTimeSpent, nil},
+						{"GET", "/streak", TimeSpentHandler.HandleGetStreak, nil},
+						{"GET", "/goals", TimeSpentHandler.HandleGetGoal, nil},
+						{"PUT", "/goals", TimeSpentHandler.HandleSetGoal, nil},
+						{"GET", "/goals/progress", TimeSpentHandler.HandleGetGoalProgress, nil},
+					},
+				},
+				{
+					prefix:      "/leaderboards",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware},
+					routes: []*route{
+						{"PUT", "/opt-out", LeaderboardHandler.HandleSetOptOut, nil},
+						{"GET", "/:metric", LeaderboardHandler.HandleGetLeaderboard, nil},
+					},
+				},
+				{
+					prefix:      "/export",
+					middlewares: []echo.MiddlewareFunc{jwtMiddleware, refreshMiddleware},
+					routes: []*route{
+						{"GET", "/time-spent", ExportHandler.HandleExportTimeSpent, nil},
+						{"GET", "/lesson-progress", ExportHandler.HandleExportLessonProgress, nil},
 					},
 				},
 				{
@@ -132,9 +267,7 @@ func Serve(
 		})
 
 	printRoutes(app, logger)
-	if err := app.Start(fmt.Sprintf("%s:%d", option.Host, option.Port)); err != nil {
-		log.Fatal(err)
-	}
+	return app
 }
 
 func printRoutes(app *echo.Echo, logger *zap.Logger) {
@@ -145,14 +278,46 @@ func printRoutes(app *echo.Echo, logger *zap.Logger) {
 	}
 }
 
+// healthModel body of the liveness probe
+type healthModel struct {
+	Database struct {
+		Healthy bool   `json:"healthy"`
+		Error   string `json:"error,omitempty"`
+	} `json:"database"`
+	KV []*driver.KVNodeStatusModel `json:"kv"`
+}
+
+// registerLivenessProbe the app is healthy if the database and all masters of the KV store are
 func registerLivenessProbe(app *echo.Echo, db driver.ITransactionalDB, rdb driver.KeyValueDB) {
 	app.GET("/healthz", func(c echo.Context) error {
-		if db.Ping() == nil && rdb.Ping() == nil {
-			c.NoContent(http.StatusOK)
+		ctx := c.Request().Context()
+		health := new(healthModel)
+		if err := db.Ping(); err != nil {
+			health.Database.Error = err.Error()
 		} else {
-			c.NoContent(http.StatusServiceUnavailable)
+			health.Database.Healthy = true
 		}
-		return nil
+		if reporter, ok := rdb.(driver.KVNodeReporter); ok {
+			health.KV = reporter.NodeStatus(ctx)
+		} else {
+			status := &driver.KVNodeStatusModel{Role: driver.KVRoleMaster, Healthy: true}
+			if err := rdb.Ping(ctx); err != nil {
+				status.Healthy = false
+				status.Error = err.Error()
+			}
+			health.KV = []*driver.KVNodeStatusModel{status}
+		}
+
+		healthy := health.Database.Healthy
+		for _, node := range health.KV {
+			if node.Role == driver.KVRoleMaster && !node.Healthy {
+				healthy = false
+			}
+		}
+		if healthy {
+			return c.JSON(http.StatusOK, health)
+		}
+		return c.JSON(http.StatusServiceUnavailable, health)
 	})
 }
 
@@ -162,6 +327,17 @@ func registerProfileEndpoints(app *echo.Echo) {
 		expvarHandler.ServeHTTP(c.Response().Writer, c.Request())
 		return nil
 	})
+	app.GET("/debug/queries", func(c echo.Context) error {
+		stats, overflow := driver.QueryStatistics().Snapshot()
+		return c.JSON(http.StatusOK, &struct {
+			Queries  []*driver.QueryStatModel `json:"queries"`
+			Overflow int64                    `json:"overflow"` // statements not collected
+		}{stats, overflow})
+	})
+	app.DELETE("/debug/queries", func(c echo.Context) error {
+		driver.QueryStatistics().Reset()
+		return c.NoContent(http.StatusNoContent)
+	})
 	app.GET("/debug/pprof/", func(c echo.Context) error {
 		pprof.Index(c.Response().Writer, c.Request())
 		return nil
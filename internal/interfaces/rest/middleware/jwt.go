@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -10,17 +11,28 @@ import (
 
 // ValidateTokenOption ...
 type ValidateTokenOption struct {
-	InBlackList func(token string) (bool, error)
+	InBlackList func(ctx context.Context, token string) (bool, error)
 }
 
+// LoadAccountFunc load the current roles of the token owner, locked is true if the account is locked or removed
+type LoadAccountFunc func(ctx context.Context, uid string) (roles []string, locked bool, err error)
+
 // RefreshTokenOption ...
 type RefreshTokenOption struct {
 	Threshold time.Duration
+	// LoadAccount if set, roles of the refreshed token are reloaded and sessions of locked accounts are terminated
+	LoadAccount LoadAccountFunc
+}
+
+// RequireRoleOption ...
+type RequireRoleOption struct {
+	// LoadAccount if set, roles are checked against it instead of the token claims, so revocation takes effect immediately
+	LoadAccount LoadAccountFunc
 }
 
 // VerifyToken validate JWT
 func VerifyToken(ju *auth.JWTUtil, options ...*ValidateTokenOption) echo.MiddlewareFunc {
-	inBlacklist := func(string) (bool, error) { return true, nil }
+	inBlacklist := func(context.Context, string) (bool, error) { return true, nil }
 	if len(options) > 0 {
 		option := options[0]
 		inBlacklist = option.InBlackList
@@ -32,7 +44,7 @@ func VerifyToken(ju *auth.JWTUtil, options ...*ValidateTokenOption) echo.Middlew
 				return c.NoContent(http.StatusUnauthorized)
 			}
 
-			if ok, err := inBlacklist(tokenStr); err != nil {
+			if ok, err := inBlacklist(c.Request().Context(), tokenStr); err != nil {
 				return err
 			} else if ok {
 				return c.NoContent(http.StatusUnauthorized)
@@ -51,10 +63,13 @@ func VerifyToken(ju *auth.JWTUtil, options ...*ValidateTokenOption) echo.Middlew
 // RefreshToken refresh jwt if necessary, must be chained after ValidateMiddleware
 func RefreshToken(ju *auth.JWTUtil, options ...*RefreshTokenOption) echo.MiddlewareFunc {
 	threshold := 5 * time.Minute
+	var loadAccount LoadAccountFunc
 	if len(options) > 0 {
-		if option := options[0]; option.Threshold > 0 {
+		option := options[0]
+		if option.Threshold > 0 {
 			threshold = option.Threshold
 		}
+		loadAccount = option.LoadAccount
 	}
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -64,6 +79,17 @@ func RefreshToken(ju *auth.JWTUtil, options ...*RefreshTokenOption) echo.Middlew
 			}
 			exp := claims.ExpiresAt
 			if time.Unix(exp, 0).Sub(time.Now()) < threshold {
+				if loadAccount != nil {
+					roles, locked, err := loadAccount(c.Request().Context(), claims.UID)
+					if err != nil {
+						return err
+					}
+					if locked {
+						ju.ClearClientToken(c)
+						return c.NoContent(http.StatusUnauthorized)
+					}
+					claims.Roles = roles
+				}
 				ju.RefreshToken(claims)
 				if tokenStr, err := ju.Sign(claims); err == nil {
 					ju.SetClientToken(c, tokenStr)
@@ -75,3 +101,34 @@ func RefreshToken(ju *auth.JWTUtil, options ...*RefreshTokenOption) echo.Middlew
 		}
 	}
 }
+
+// RequireRole reject request if the token owner is not granted with role, must be chained after VerifyToken
+func RequireRole(ju *auth.JWTUtil, role string, options ...*RequireRoleOption) echo.MiddlewareFunc {
+	var loadAccount LoadAccountFunc
+	if len(options) > 0 {
+		loadAccount = options[0].LoadAccount
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := ju.GetContextToken(c)
+			if claims == nil {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			if loadAccount != nil {
+				roles, locked, err := loadAccount(c.Request().Context(), claims.UID)
+				if err != nil {
+					return err
+				}
+				if locked {
+					ju.ClearClientToken(c)
+					return c.NoContent(http.StatusUnauthorized)
+				}
+				claims.Roles = roles
+			}
+			if !claims.HasRole(role) {
+				return c.NoContent(http.StatusForbidden)
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+// ReadYourWritesOption option for ReadYourWrites
+type ReadYourWritesOption struct {
+	Window     time.Duration // reads are sent to the primary for this long after a write of the client, negative value to disable
+	CookieName string        // cookie carrying the time of the last write(unix milliseconds)
+}
+
+// ReadYourWrites route reads of requests that may write to the primary database,
+// so they don't miss their own writes because of replication lag.
+//
+// The time of the write is set in a cookie, reads of the same client within the window
+// are sent to the primary too, since the replicas may not have caught up yet
+func ReadYourWrites(options ...*ReadYourWritesOption) echo.MiddlewareFunc {
+	custom := &ReadYourWritesOption{
+		Window:     5 * time.Second,
+		CookieName: "last_write",
+	}
+	if len(options) > 0 {
+		option := options[0]
+		if option.Window != 0 {
+			custom.Window = option.Window
+		}
+		if option.CookieName != "" {
+			custom.CookieName = option.CookieName
+		}
+	}
+	window, name := custom.Window, custom.CookieName
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				if window > 0 && wroteWithin(req, name, window) {
+					c.SetRequest(req.WithContext(driver.WithPrimary(req.Context())))
+				}
+			default:
+				c.SetRequest(req.WithContext(driver.WithPrimary(req.Context())))
+				if window > 0 {
+					res := c.Response()
+					// the write is committed by the time the response is written
+					res.Before(func() {
+						http.SetCookie(res, &http.Cookie{
+							Name:     name,
+							Value:    strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+							Path:     "/",
+							MaxAge:   int((window + time.Second - 1) / time.Second),
+							HttpOnly: true,
+						})
+					})
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// wroteWithin whether the write time in cookie name of req is within window. Times ahead of now are
+// accepted within the window too, in case the clocks of the instances differ
+func wroteWithin(req *http.Request, name string, window time.Duration) bool {
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return false
+	}
+	ms, err := strconv.ParseInt(cookie.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(0, ms*int64(time.Millisecond)))
+	return age < window && age > -window
+}
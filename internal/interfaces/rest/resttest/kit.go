@@ -0,0 +1,304 @@
+// Package resttest boot the REST server against SQLite and an in-memory KV store, so endpoints can be tested with httptest
+package resttest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pot-code/go-boilerplate/internal/importer"
+	infra "github.com/pot-code/go-boilerplate/internal/infrastructure"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/cache"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/uuid"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/validate"
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest"
+	"github.com/pot-code/go-boilerplate/internal/interfaces/rest/handler"
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
+	"github.com/pot-code/go-boilerplate/internal/lesson"
+	timespent "github.com/pot-code/go-boilerplate/internal/time_spent"
+	"github.com/pot-code/go-boilerplate/internal/user"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIPrefix prefix of versioned endpoints
+const APIPrefix = "/api/v1"
+
+// Kit server under test with its stores, requests are sent as the logged in user if there is one.
+// Each kit has its own database, which is removed when the test finishes
+type Kit struct {
+	T       testing.TB
+	DB      driver.ITransactionalDB
+	KV      *drivertest.MemoryKV
+	Clock   *drivertest.FakeClock // clock of KV, expiration of keys is controlled by it
+	Config  *infra.AppConfig
+	Logger  *zap.Logger
+	Handler http.Handler
+
+	UserRepo user.UserRepository
+	session  []*http.Cookie
+}
+
+// DefaultConfig config of New
+func DefaultConfig() *infra.AppConfig {
+	cfg := new(infra.AppConfig)
+	cfg.AppID = "resttest"
+	cfg.Env = infra.EnvProduction
+	cfg.SessionTimeout = 30 * time.Minute
+	cfg.SessionRefresh = 5 * time.Minute
+	cfg.RequestTimeout = 30 * time.Second
+	cfg.Database.Driver = driver.DialectSQLite.String()
+	cfg.Database.TxMaxAttempts = 3
+	cfg.Database.TxRetryDelay = time.Millisecond
+	cfg.Database.TxMaxRetryDelay = 10 * time.Millisecond
+	cfg.Security.IDLength = 24
+	cfg.Security.JWTMethod = "HS256"
+	cfg.Security.JWTSecret = "resttest"
+	cfg.Security.TokenName = "token"
+	cfg.Security.MaxLoginAttempts = 3
+	cfg.Security.RetryTimeout = time.Hour
+	return cfg
+}
+
+// New boot a server with DefaultConfig
+func New(t testing.TB) *Kit {
+	return NewWithConfig(t, DefaultConfig())
+}
+
+// NewWithConfig boot a server with cfg, database and KV options are ignored. Caching is disabled by DefaultConfig,
+// set cfg.Cache to test it, values are kept in the KV of the kit
+func NewWithConfig(t testing.TB, cfg *infra.AppConfig) *Kit {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "resttest")
+	if err != nil {
+		t.Fatalf("Failed to create database directory: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	// WAL and busy timeout let concurrent requests wait for the write lock instead of failing
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, "test.db")+"?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("Failed to open database: %s", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("Failed to create schema: %s", err)
+	}
+
+	var (
+		logger = zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+		conn   = driver.NewSQLWrapper(db, driver.DialectSQLite, &driver.DBConfig{})
+		clock  = drivertest.NewFakeClock(time.Now())
+		kv     = drivertest.NewMemoryKV(clock)
+		store  = cache.NewCache(kv, cfg.Cache.LocalSize)
+
+		UserRepo           = user.NewUserRepository(conn, uuid.NewNanoIDGenerator(cfg.Security.IDLength))
+		UserUserCase       = user.NewUserUseCase(UserRepo)
+		LeaderboardUseCase = leaderboard.NewLeaderboardUseCase(leaderboard.NewLeaderboardRepository(conn), kv, driver.NewLocker(kv))
+		LessonRepo         = lesson.NewCachedLessonRepository(lesson.NewLessonRepository(conn), store, cache.Policy{
+			TTL:      cfg.Cache.LessonProgress.TTL,
+			LocalTTL: cfg.Cache.LessonProgress.LocalTTL,
+		})
+		TimeSpentRepo = timespent.NewCachedTimeSpentRepository(timespent.NewTimeSpentRepository(conn), store, cache.Policy{
+			TTL:      cfg.Cache.TimeSpent.TTL,
+			LocalTTL: cfg.Cache.TimeSpent.LocalTTL,
+		})
+		LessonUseCase    = lesson.NewLessonUseCase(LessonRepo, LeaderboardUseCase)
+		TimeSpentUseCase = timespent.NewTimeSpentUseCase(TimeSpentRepo, UserUserCase, LeaderboardUseCase)
+		ImporterUseCase  = importer.NewImporterUseCase(
+			importer.NewCachedImporterRepository(importer.NewImporterRepository(conn), LessonRepo.Progress), validate.NewValidator())
+	)
+	return &Kit{
+		T:      t,
+		DB:     conn,
+		KV:     kv,
+		Clock:  clock,
+		Config: cfg,
+		Logger: logger,
+		Handler: rest.NewServer(conn, kv, cfg, UserUserCase, UserRepo, LessonUseCase, TimeSpentUseCase,
+			LeaderboardUseCase, ImporterUseCase, logger),
+		UserRepo: UserRepo,
+	}
+}
+
+// Context context carrying the logger of the kit, required by the driver
+func (k *Kit) Context() context.Context {
+	return logging.SetLoggerInContext(context.Background(), k.Logger)
+}
+
+// Exec run a portable statement to seed fixtures, the test fails if it fails
+func (k *Kit) Exec(query string, args ...interface{}) sql.Result {
+	k.T.Helper()
+	res, err := k.DB.ExecContext(k.Context(), query, args...)
+	if err != nil {
+		k.T.Fatalf("Failed to seed fixture: %s", err)
+	}
+	return res
+}
+
+// CreateUser save a user with roles, the email is derived from username
+func (k *Kit) CreateUser(username, password string, roles ...string) *user.UserModel {
+	k.T.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		k.T.Fatalf("Failed to hash password: %s", err)
+	}
+	entity := &user.UserModel{
+		Username:  username,
+		Email:     username + "@example.com",
+		Password:  string(hash),
+		LastLogin: time.Now().Unix(),
+		Roles:     roles,
+	}
+	ctx := k.Context()
+	if err := k.UserRepo.SaveUser(ctx, entity); err != nil {
+		k.T.Fatalf("Failed to create user %s: %s", username, err)
+	}
+	if len(roles) > 0 {
+		if err := k.UserRepo.SetRoles(ctx, entity.ID, roles); err != nil {
+			k.T.Fatalf("Failed to assign roles to %s: %s", username, err)
+		}
+	}
+	return entity
+}
+
+// Login sign in as username, the following requests carry the session
+func (k *Kit) Login(username, password string) {
+	k.T.Helper()
+	k.session = nil
+	rec := k.Do(http.MethodPost, APIPrefix+"/user/login", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	k.AssertStatus(rec, http.StatusOK)
+	if len(k.session) == 0 {
+		k.T.Fatalf("Login of %s didn't set a session cookie", username)
+	}
+}
+
+// LoginAs create a user with roles and sign in as it
+func (k *Kit) LoginAs(username string, roles ...string) *user.UserModel {
+	k.T.Helper()
+	const password = "resttest-password"
+	entity := k.CreateUser(username, password, roles...)
+	k.Login(username, password)
+	return entity
+}
+
+// Logout drop the session, the following requests are anonymous
+func (k *Kit) Logout() {
+	k.session = nil
+}
+
+// Do send a request with body encoded as JSON(nil for no body), cookies set by the response update the session
+func (k *Kit) Do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	k.T.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			k.T.Fatalf("Failed to encode request body: %s", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return k.DoRequest(req)
+}
+
+// DoRequest send req with the session
+func (k *Kit) DoRequest(req *http.Request) *httptest.ResponseRecorder {
+	for _, c := range k.session {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	k.Handler.ServeHTTP(rec, req)
+	k.updateSession(rec.Result().Cookies())
+	return rec
+}
+
+func (k *Kit) updateSession(cookies []*http.Cookie) {
+	for _, c := range cookies {
+		if c.Name != k.Config.Security.TokenName {
+			continue
+		}
+		if c.Value == "" {
+			k.session = nil
+		} else {
+			k.session = []*http.Cookie{{Name: c.Name, Value: c.Value}}
+		}
+	}
+}
+
+// DecodeJSON decode the response body into v
+func (k *Kit) DecodeJSON(rec *httptest.ResponseRecorder, v interface{}) {
+	k.T.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		k.T.Fatalf("Failed to decode response body %q: %s", rec.Body.String(), err)
+	}
+}
+
+// AssertStatus fail the test if the response status isn't code
+func (k *Kit) AssertStatus(rec *httptest.ResponseRecorder, code int) {
+	k.T.Helper()
+	if rec.Code != code {
+		k.T.Fatalf("Expected status %d, got %d: %s", code, rec.Code, rec.Body.String())
+	}
+}
+
+// AssertError fail the test if the response isn't a RESTStandardError of code, detail is checked if it's not empty
+func (k *Kit) AssertError(rec *httptest.ResponseRecorder, code int, detail string) *handler.RESTStandardError {
+	k.T.Helper()
+	k.AssertStatus(rec, code)
+	body := new(handler.RESTStandardError)
+	k.DecodeJSON(rec, body)
+	if body.Code != code || body.Title != http.StatusText(code) {
+		k.T.Fatalf("Expected error %d %s, got %d %s", code, http.StatusText(code), body.Code, body.Title)
+	}
+	if detail != "" && body.Detail != detail {
+		k.T.Fatalf("Expected error detail %q, got %q", detail, body.Detail)
+	}
+	return body
+}
+
+// AssertValidationError fail the test if the response isn't a 400 RESTValidationError rejecting all of fields
+func (k *Kit) AssertValidationError(rec *httptest.ResponseRecorder, fields ...string) *handler.RESTValidationError {
+	k.T.Helper()
+	k.AssertStatus(rec, http.StatusBadRequest)
+	body := new(handler.RESTValidationError)
+	k.DecodeJSON(rec, body)
+	for _, field := range fields {
+		found := false
+		for _, p := range body.InvalidParams {
+			if p.Domain == field {
+				found = true
+				break
+			}
+		}
+		if !found {
+			k.T.Fatalf("Expected field %s to be rejected, got %s", field, rec.Body.String())
+		}
+	}
+	return body
+}
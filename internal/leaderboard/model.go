@@ -0,0 +1,78 @@
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// leaderboard metrics
+const (
+	MetricTimeSpent = "time-spent" // minutes spent on learning
+	MetricLessons   = "lessons"    // lessons completed
+)
+
+// leaderboard periods
+const (
+	PeriodWeekly  = "weekly" // week starting on monday in UTC
+	PeriodAllTime = "all-time"
+)
+
+// MaxTopN maximum number of entries returned in a leaderboard
+const MaxTopN = 100
+
+// EntryModel ranked user in a leaderboard
+type EntryModel struct {
+	Rank     int64  `json:"rank"` // one-based
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Score    int64  `json:"score"`
+}
+
+// LeaderboardModel top entries of a leaderboard along with the caller's own entry
+type LeaderboardModel struct {
+	Metric    string        `json:"metric"`
+	Period    string        `json:"period"`
+	Timestamp int64         `json:"timestamp,omitempty"` // start of the week in milliseconds
+	Top       []*EntryModel `json:"top"`
+	Me        *EntryModel   `json:"me,omitempty"` // nil if caller has no score or opted out
+	OptOut    bool          `json:"opt_out"`
+}
+
+// ScoreModel aggregated score of a user
+type ScoreModel struct {
+	UserID string `db:"user_id"`
+	Score  int64  `db:"score"`
+}
+
+var (
+	// ErrUnknownMetric metric is not one of the supported metrics
+	ErrUnknownMetric = errors.New("Unknown leaderboard metric")
+	// ErrUnknownPeriod period is not one of the supported periods
+	ErrUnknownPeriod = errors.New("Unknown leaderboard period")
+)
+
+type LeaderboardRepository interface {
+	// SumTimeSpent minutes spent by each user on days in [from, to), nil bounds are open.
+	// Results are limited to userID if it's not empty, opted out users are excluded
+	SumTimeSpent(ctx context.Context, from, to *time.Time, userID string) ([]*ScoreModel, error)
+	// CountCompletedLessons lessons completed by each user in [from, to), see SumTimeSpent for the other parameters
+	CountCompletedLessons(ctx context.Context, from, to *time.Time, userID string) ([]*ScoreModel, error)
+	GetUsernames(ctx context.Context, ids []string) (map[string]string, error)
+	IsOptedOut(ctx context.Context, userID string) (bool, error)
+	SetOptOut(ctx context.Context, userID string, optOut bool) error
+}
+
+type LeaderboardUseCase interface {
+	// GetLeaderboard top n entries and the entry of userID
+	GetLeaderboard(ctx context.Context, metric, period string, n int, userID string) (*LeaderboardModel, error)
+	// AddTimeSpent add minutes spent on day(a calendar date, its zone is ignored) to time spent leaderboards
+	AddTimeSpent(ctx context.Context, userID string, day time.Time, minutes int) error
+	// AddCompletedLessons add delta completed lessons at completion time at to lesson leaderboards
+	AddCompletedLessons(ctx context.Context, userID string, at time.Time, delta int) error
+	// SetOptOut remove user from leaderboards or restore the scores of user
+	SetOptOut(ctx context.Context, userID string, optOut bool) error
+	// Rebuild recompute all leaderboards of the current week and all time from the database,
+	// driver.ErrLockNotAcquired is returned if they are being rebuilt
+	Rebuild(ctx context.Context) error
+}
@@ -0,0 +1,125 @@
+package leaderboard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+)
+
+type LeaderboardMySQL struct {
+	Conn driver.ITransactionalDB `dep:""`
+}
+
+var _ LeaderboardRepository = &LeaderboardMySQL{}
+
+func NewLeaderboardRepository(Conn driver.ITransactionalDB) *LeaderboardMySQL {
+	return &LeaderboardMySQL{
+		Conn: Conn,
+	}
+}
+
+func (repo *LeaderboardMySQL) SumTimeSpent(ctx context.Context, from, to *time.Time, userID string) ([]*ScoreModel, error) {
+	where, args := scoreFilter("lts.ts", from, to, "lts.user_id", userID)
+	return repo.queryScores(ctx, `
+SELECT
+    lts.user_id,
+    SUM(COALESCE(lts.vocabulary, 0) + COALESCE(lts.grammar, 0) + COALESCE(lts.listening, 0) + COALESCE(lts.writing, 0)) score
+FROM
+    lesson_time_spent lts
+        JOIN
+    "user" u ON (u.id = lts.user_id)
+WHERE
+    `+where+`
+GROUP BY lts.user_id
+	`, args)
+}
+
+func (repo *LeaderboardMySQL) CountCompletedLessons(ctx context.Context, from, to *time.Time, userID string) ([]*ScoreModel, error) {
+	where, args := scoreFilter("lp.completed_at", from, to, "lp.user_id", userID)
+	return repo.queryScores(ctx, `
+SELECT
+    lp.user_id, COUNT(*) score
+FROM
+    lesson_progress lp
+        JOIN
+    "user" u ON (u.id = lp.user_id)
+WHERE
+    lp.completed_at IS NOT NULL
+        AND `+where+`
+GROUP BY lp.user_id
+	`, args)
+}
+
+func (repo *LeaderboardMySQL) GetUsernames(ctx context.Context, ids []string) (map[string]string, error) {
+	names := make(map[string]string)
+	if len(ids) == 0 {
+		return names, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	conn := repo.Conn
+	rows, err := conn.QueryContext(ctx, `SELECT id, username FROM "user" WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		names[id] = username
+	}
+	return names, rows.Err()
+}
+
+func (repo *LeaderboardMySQL) IsOptedOut(ctx context.Context, userID string) (bool, error) {
+	conn := repo.Conn
+	var optOut bool
+	err := driver.Get(ctx, conn, &optOut, `SELECT leaderboard_opt_out FROM "user" WHERE id = $1`, userID)
+	if err == driver.ErrNoRows {
+		return false, nil
+	}
+	return optOut, err
+}
+
+func (repo *LeaderboardMySQL) SetOptOut(ctx context.Context, userID string, optOut bool) error {
+	conn := repo.Conn
+	_, err := conn.ExecContext(ctx, `UPDATE "user" SET leaderboard_opt_out = $1 WHERE id = $2`, optOut, userID)
+	return err
+}
+
+func (repo *LeaderboardMySQL) queryScores(ctx context.Context, query string, args []interface{}) ([]*ScoreModel, error) {
+	conn := repo.Conn
+	var result []*ScoreModel
+	err := driver.SelectAll(ctx, conn, &result, query, args...)
+	return result, err
+}
+
+// scoreFilter build the WHERE conditions shared by score queries, opted out users are always excluded
+func scoreFilter(timeColumn string, from, to *time.Time, userColumn string, userID string) (string, []interface{}) {
+	where := []string{"u.leaderboard_opt_out = $1"}
+	args := []interface{}{false}
+	if from != nil {
+		args = append(args, *from)
+		where = append(where, fmt.Sprintf("%s >= $%d", timeColumn, len(args)))
+	}
+	if to != nil {
+		args = append(args, *to)
+		where = append(where, fmt.Sprintf("%s < $%d", timeColumn, len(args)))
+	}
+	if userID != "" {
+		args = append(args, userID)
+		where = append(where, fmt.Sprintf("%s = $%d", userColumn, len(args)))
+	}
+	return strings.Join(where, " AND "), args
+}
@@ -0,0 +1,283 @@
+package leaderboard
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"go.elastic.co/apm"
+)
+
+const (
+	keyPrefix = "leaderboard"
+	// weeklyTTL weekly leaderboards are kept for a while after the week ends
+	weeklyTTL = 14 * 24 * time.Hour
+	// rebuildBatchSize number of members added to a sorted set at once during rebuild
+	rebuildBatchSize = 1000
+	// rebuildLockKey lock held while rebuilding, its fencing token guards the replacement of leaderboards
+	rebuildLockKey = "leaderboard:rebuild"
+	// rebuildLockTTL ttl of the rebuild lock, it's renewed while rebuilding
+	rebuildLockTTL = time.Minute
+)
+
+var (
+	metrics = []string{MetricTimeSpent, MetricLessons}
+	periods = []string{PeriodWeekly, PeriodAllTime}
+)
+
+// LeaderboardUseCaseImpl leaderboards are kept in sorted sets of the KV storage,
+// scores are incremented as users learn and recomputed from the database by Rebuild
+type LeaderboardUseCaseImpl struct {
+	LeaderboardRepository LeaderboardRepository
+	KeyValueDB            driver.KeyValueDB
+	Locker                driver.Locker
+}
+
+var _ LeaderboardUseCase = &LeaderboardUseCaseImpl{}
+
+// NewLeaderboardUseCase ...
+func NewLeaderboardUseCase(
+	LeaderboardRepository LeaderboardRepository,
+	KeyValueDB driver.KeyValueDB,
+	Locker driver.Locker,
+) *LeaderboardUseCaseImpl {
+	return &LeaderboardUseCaseImpl{LeaderboardRepository, KeyValueDB, Locker}
+}
+
+// GetLeaderboard get top n entries, ties are broken by user ID
+func (lu *LeaderboardUseCaseImpl) GetLeaderboard(ctx context.Context, metric, period string, n int, userID string) (*LeaderboardModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LeaderboardUseCaseImpl.GetLeaderboard", "service")
+	defer apmSpan.End()
+
+	if err := validateBoard(metric, period); err != nil {
+		return nil, err
+	}
+	kv := lu.KeyValueDB
+	week := weekStart(time.Now().UTC())
+	key := boardKey(metric, period, week)
+	board := &LeaderboardModel{
+		Metric: metric,
+		Period: period,
+		Top:    []*EntryModel{},
+	}
+	if period == PeriodWeekly {
+		board.Timestamp = week.Unix() * 1e3 // milliseconds
+	}
+
+	members, err := kv.ZRevRangeWithScores(ctx, key, 0, int64(n-1))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(members)+1)
+	for i, m := range members {
+		board.Top = append(board.Top, &EntryModel{Rank: int64(i + 1), UserID: m.Member, Score: int64(m.Score)})
+		ids = append(ids, m.Member)
+	}
+
+	if board.OptOut, err = lu.LeaderboardRepository.IsOptedOut(ctx, userID); err != nil {
+		return nil, err
+	}
+	if !board.OptOut {
+		rank, err := kv.ZRevRank(ctx, key, userID)
+		if err != nil {
+			return nil, err
+		}
+		if rank >= 0 {
+			score, err := kv.ZScore(ctx, key, userID)
+			if err != nil {
+				return nil, err
+			}
+			board.Me = &EntryModel{Rank: rank + 1, UserID: userID, Score: int64(score)}
+			ids = append(ids, userID)
+		}
+	}
+
+	names, err := lu.LeaderboardRepository.GetUsernames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range board.Top {
+		e.Username = names[e.UserID]
+	}
+	if board.Me != nil {
+		board.Me.Username = names[userID]
+	}
+	return board, nil
+}
+
+// AddTimeSpent only the leaderboard of the current week is updated, days in past weeks count towards all time only
+func (lu *LeaderboardUseCaseImpl) AddTimeSpent(ctx context.Context, userID string, day time.Time, minutes int) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LeaderboardUseCaseImpl.AddTimeSpent", "service")
+	defer apmSpan.End()
+
+	return lu.add(ctx, MetricTimeSpent, userID, weekStart(day), minutes)
+}
+
+// AddCompletedLessons only the leaderboard of the current week is updated, see AddTimeSpent
+func (lu *LeaderboardUseCaseImpl) AddCompletedLessons(ctx context.Context, userID string, at time.Time, delta int) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LeaderboardUseCaseImpl.AddCompletedLessons", "service")
+	defer apmSpan.End()
+
+	return lu.add(ctx, MetricLessons, userID, weekStart(at.UTC()), delta)
+}
+
+// SetOptOut save the privacy setting, scores of an opting in user are recomputed from the database
+func (lu *LeaderboardUseCaseImpl) SetOptOut(ctx context.Context, userID string, optOut bool) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LeaderboardUseCaseImpl.SetOptOut", "service")
+	defer apmSpan.End()
+
+	if err := lu.LeaderboardRepository.SetOptOut(ctx, userID, optOut); err != nil {
+		return err
+	}
+	kv := lu.KeyValueDB
+	week := weekStart(time.Now().UTC())
+	for _, metric := range metrics {
+		for _, period := range periods {
+			key := boardKey(metric, period, week)
+			if optOut {
+				if err := kv.ZRem(ctx, key, userID); err != nil {
+					return err
+				}
+				continue
+			}
+			scores, err := lu.scores(ctx, metric, period, week, userID)
+			if err != nil {
+				return err
+			}
+			for _, s := range scores {
+				if err := kv.ZAdd(ctx, key, &driver.ZMember{Member: s.UserID, Score: float64(s.Score)}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Rebuild run by one process at a time, driver.ErrLockNotAcquired is returned if another one is rebuilding
+func (lu *LeaderboardUseCaseImpl) Rebuild(ctx context.Context) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LeaderboardUseCaseImpl.Rebuild", "service")
+	defer apmSpan.End()
+
+	return lu.Locker.WithLock(ctx, rebuildLockKey, rebuildLockTTL, lu.rebuild)
+}
+
+// rebuild each leaderboard is computed into a temporary key which then replaces the live one, unless a holder of
+// a greater fencing token replaced it meanwhile, so a holder whose lock expired can't overwrite newer scores.
+// Increments made while a leaderboard is being computed may be lost until the next rebuild
+func (lu *LeaderboardUseCaseImpl) rebuild(ctx context.Context, token int64) error {
+	kv := lu.KeyValueDB
+	week := weekStart(time.Now().UTC())
+	for _, metric := range metrics {
+		for _, period := range periods {
+			scores, err := lu.scores(ctx, metric, period, week, "")
+			if err != nil {
+				return err
+			}
+			key := boardKey(metric, period, week)
+			// same hash slot as key, so it can be renamed to key in cluster mode, and apart from other holders
+			tmp := driver.RedisHashTag(key, fmt.Sprintf(":rebuild:%d", token))
+			var ttl time.Duration
+			if period == PeriodWeekly {
+				ttl = weeklyTTL
+			}
+			replaced, err := lu.replace(ctx, key, tmp, scores, token, ttl)
+			if err != nil || !replaced {
+				kv.Del(ctx, tmp)
+			}
+			if err != nil {
+				return err
+			}
+			if !replaced {
+				return driver.ErrLockLost
+			}
+		}
+	}
+	return nil
+}
+
+// replace fill tmp with scores and rename it to key as the holder of token, key is removed if there is no score
+func (lu *LeaderboardUseCaseImpl) replace(ctx context.Context, key, tmp string, scores []*ScoreModel, token int64, ttl time.Duration) (bool, error) {
+	kv := lu.KeyValueDB
+	batch := make([]*driver.ZMember, 0, rebuildBatchSize)
+	for i, s := range scores {
+		batch = append(batch, &driver.ZMember{Member: s.UserID, Score: float64(s.Score)})
+		if len(batch) == rebuildBatchSize || i == len(scores)-1 {
+			if err := kv.ZAdd(ctx, tmp, batch...); err != nil {
+				return false, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return kv.RenameFenced(ctx, tmp, key, token, ttl)
+}
+
+func (lu *LeaderboardUseCaseImpl) add(ctx context.Context, metric string, userID string, week time.Time, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	optOut, err := lu.LeaderboardRepository.IsOptedOut(ctx, userID)
+	if err != nil || optOut {
+		return err
+	}
+
+	kv := lu.KeyValueDB
+	keys := []string{boardKey(metric, PeriodAllTime, week)}
+	if week.Equal(weekStart(time.Now().UTC())) {
+		keys = append(keys, boardKey(metric, PeriodWeekly, week))
+	}
+	for _, key := range keys {
+		score, err := kv.ZIncrBy(ctx, key, userID, float64(delta))
+		if err != nil {
+			return err
+		}
+		if score <= 0 {
+			if err := kv.ZRem(ctx, key, userID); err != nil {
+				return err
+			}
+		}
+	}
+	if len(keys) > 1 {
+		return kv.Expire(ctx, keys[1], weeklyTTL)
+	}
+	return nil
+}
+
+// scores compute scores of a leaderboard from the database
+func (lu *LeaderboardUseCaseImpl) scores(ctx context.Context, metric, period string, week time.Time, userID string) ([]*ScoreModel, error) {
+	var from, to *time.Time
+	if period == PeriodWeekly {
+		end := week.AddDate(0, 0, 7)
+		from, to = &week, &end
+	}
+	if metric == MetricTimeSpent {
+		return lu.LeaderboardRepository.SumTimeSpent(ctx, from, to, userID)
+	}
+	return lu.LeaderboardRepository.CountCompletedLessons(ctx, from, to, userID)
+}
+
+func validateBoard(metric, period string) error {
+	if metric != MetricTimeSpent && metric != MetricLessons {
+		return ErrUnknownMetric
+	}
+	if period != PeriodWeekly && period != PeriodAllTime {
+		return ErrUnknownPeriod
+	}
+	return nil
+}
+
+// boardKey the week is only part of the key of weekly leaderboards
+func boardKey(metric, period string, week time.Time) string {
+	if period == PeriodWeekly {
+		return fmt.Sprintf("%s:%s:%s:%s", keyPrefix, metric, period, week.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("%s:%s:%s", keyPrefix, metric, period)
+}
+
+// weekStart monday of the week containing the calendar date of t, in UTC
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
@@ -0,0 +1,177 @@
+package leaderboard
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.uber.org/zap/zaptest"
+)
+
+func testContext(t *testing.T) context.Context {
+	return logging.SetLoggerInContext(context.Background(), zaptest.NewLogger(t))
+}
+
+func expectOptOut(db *drivertest.FakeDB, userID string, optOut bool) {
+	db.ExpectQuery(`SELECT leaderboard_opt_out FROM "user"`).WithArgs(userID).
+		WillReturnRows(drivertest.NewRows("leaderboard_opt_out").AddRow(optOut))
+}
+
+func TestAddTimeSpent(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	clock := drivertest.NewFakeClock(time.Now())
+	kv := drivertest.NewMemoryKV(clock)
+	lu := NewLeaderboardUseCase(NewLeaderboardRepository(db), kv, driver.NewLocker(kv))
+
+	now := time.Now().UTC()
+	week := weekStart(now)
+	expectOptOut(db, "alice", false)
+	expectOptOut(db, "alice", false)
+	expectOptOut(db, "bob", true)
+	if err := lu.AddTimeSpent(ctx, "alice", now, 30); err != nil {
+		t.Fatalf("AddTimeSpent() error = %v", err)
+	}
+	// days of past weeks count towards all time only
+	if err := lu.AddTimeSpent(ctx, "alice", week.AddDate(0, 0, -7), 15); err != nil {
+		t.Fatalf("AddTimeSpent() error = %v", err)
+	}
+	if err := lu.AddTimeSpent(ctx, "bob", now, 60); err != nil {
+		t.Fatalf("AddTimeSpent() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	weekly := boardKey(MetricTimeSpent, PeriodWeekly, week)
+	allTime := boardKey(MetricTimeSpent, PeriodAllTime, week)
+	if score, _ := kv.ZScore(ctx, weekly, "alice"); score != 30 {
+		t.Fatalf("Weekly score = %v, want 30", score)
+	}
+	if score, _ := kv.ZScore(ctx, allTime, "alice"); score != 45 {
+		t.Fatalf("All time score = %v, want 45", score)
+	}
+	if rank, _ := kv.ZRevRank(ctx, allTime, "bob"); rank != -1 {
+		t.Fatal("Opted out user is on the leaderboard")
+	}
+
+	// weekly leaderboards expire after a while, all time ones are kept
+	clock.Advance(weeklyTTL)
+	if ok, _ := kv.Exists(ctx, weekly); ok {
+		t.Fatal("Weekly leaderboard didn't expire")
+	}
+	if ok, _ := kv.Exists(ctx, allTime); !ok {
+		t.Fatal("All time leaderboard expired")
+	}
+}
+
+func TestAddCompletedLessonsRemovesNonPositiveScores(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	kv := drivertest.NewMemoryKV(nil)
+	lu := NewLeaderboardUseCase(NewLeaderboardRepository(db), kv, driver.NewLocker(kv))
+
+	now := time.Now().UTC()
+	expectOptOut(db, "alice", false)
+	expectOptOut(db, "alice", false)
+	if err := lu.AddCompletedLessons(ctx, "alice", now, 1); err != nil {
+		t.Fatalf("AddCompletedLessons() error = %v", err)
+	}
+	// a lesson is reset to incomplete
+	if err := lu.AddCompletedLessons(ctx, "alice", now, -1); err != nil {
+		t.Fatalf("AddCompletedLessons() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := kv.Keys(); len(keys) != 0 {
+		t.Fatalf("Expected empty leaderboards to be removed, got %v", keys)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	kv := drivertest.NewMemoryKV(nil)
+	lu := NewLeaderboardUseCase(NewLeaderboardRepository(db), kv, driver.NewLocker(kv))
+
+	week := weekStart(time.Now().UTC())
+	stale := boardKey(MetricLessons, PeriodAllTime, week)
+	kv.ZIncrBy(ctx, stale, "mallory", 99)
+
+	scores := func() *drivertest.Rows {
+		return drivertest.NewRows("user_id", "score").AddRow("alice", 40).AddRow("bob", 20)
+	}
+	// time spent: weekly, all time, lessons: weekly, all time
+	db.ExpectQuery(`FROM lesson_time_spent`).WithArgs(false, week, week.AddDate(0, 0, 7)).WillReturnRows(scores())
+	db.ExpectQuery(`FROM lesson_time_spent`).WithArgs(false).WillReturnRows(scores())
+	db.ExpectQuery(`FROM lesson_progress`).WithArgs(false, week, week.AddDate(0, 0, 7))
+	db.ExpectQuery(`FROM lesson_progress`).WithArgs(false)
+
+	if err := lu.Rebuild(ctx); err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.ExpectQuery(`SELECT leaderboard_opt_out`).WithArgs("bob").
+		WillReturnRows(drivertest.NewRows("leaderboard_opt_out").AddRow(false))
+	db.ExpectQuery(`SELECT id, username FROM "user"`).
+		WillReturnRows(drivertest.NewRows("id", "username").AddRow("alice", "Alice").AddRow("bob", "Bob"))
+	board, err := lu.GetLeaderboard(ctx, MetricTimeSpent, PeriodWeekly, 10, "bob")
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	if len(board.Top) != 2 || board.Top[0].Username != "Alice" || board.Top[0].Score != 40 {
+		t.Fatalf("Unexpected top entries %+v", board.Top)
+	}
+	if board.Me == nil || board.Me.Rank != 2 || board.Me.Username != "Bob" {
+		t.Fatalf("Unexpected own entry %+v", board.Me)
+	}
+	// leaderboards without scores are removed instead of keeping stale entries
+	if ok, _ := kv.Exists(ctx, stale); ok {
+		t.Fatal("Stale leaderboard was kept")
+	}
+}
+
+func TestRebuildStaleHolder(t *testing.T) {
+	ctx := testContext(t)
+	db := drivertest.NewFakeDB()
+	kv := drivertest.NewMemoryKV(nil)
+	locker := driver.NewLocker(kv)
+	lu := NewLeaderboardUseCase(NewLeaderboardRepository(db), kv, locker)
+
+	// another rebuild is running
+	lock, err := locker.TryLock(ctx, rebuildLockKey, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lu.Rebuild(ctx); err != driver.ErrLockNotAcquired {
+		t.Fatalf("Rebuild() error = %v, want %v", err, driver.ErrLockNotAcquired)
+	}
+
+	// the first leaderboard was replaced by the holder of a greater token
+	week := weekStart(time.Now().UTC())
+	key := boardKey(MetricTimeSpent, PeriodWeekly, week)
+	kv.ZIncrBy(ctx, key, "alice", 40)
+	kv.SetEX(ctx, driver.RedisFenceKey(key), strconv.FormatInt(lock.Token()+1, 10), weeklyTTL)
+	db.ExpectQuery(`FROM lesson_time_spent`).WithArgs(false, week, week.AddDate(0, 0, 7)).
+		WillReturnRows(drivertest.NewRows("user_id", "score").AddRow("mallory", 99))
+	if err := lu.rebuild(ctx, lock.Token()); err != driver.ErrLockLost {
+		t.Fatalf("rebuild() error = %v, want %v", err, driver.ErrLockLost)
+	}
+	if score, _ := kv.ZScore(ctx, key, "alice"); score != 40 {
+		t.Fatal("Stale holder replaced the leaderboard")
+	}
+	for _, k := range kv.Keys() {
+		if k != key && k != driver.RedisFenceKey(key) && !strings.HasPrefix(k, "{lock:") {
+			t.Fatalf("Temporary key %s was left", k)
+		}
+	}
+}
@@ -2,24 +2,177 @@ package lesson
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/pot-code/go-boilerplate/internal/user"
 )
 
 type LessonProgressModel struct {
-	ID        int        `json:"id"`
-	Index     int        `json:"index"`
-	Title     string     `json:"title"`
-	Progress  float32    `json:"progress"`
-	CreatedAt *time.Time `json:"-"`
-	Timestamp int64      `json:"timestamp"`
+	ID                 int        `json:"id" db:"id"`
+	LessonID           int64      `json:"lesson_id" db:"lesson_id"`
+	Index              int        `json:"index" db:"index"`
+	Title              string     `json:"title" db:"title"`
+	Progress           float32    `json:"progress" db:"progress"`
+	CreatedAt          *time.Time `json:"-" db:"created_at"`
+	UpdatedAt          *time.Time `json:"-" db:"updated_at"`
+	CompletedAt        *time.Time `json:"-" db:"completed_at"`
+	Timestamp          int64      `json:"timestamp" db:"-"`
+	CompletedTimestamp int64      `json:"completed_timestamp,omitempty" db:"-"`
 }
 
+// ProgressHistoryModel a snapshot of lesson progress
+type ProgressHistoryModel struct {
+	LessonID  int64      `json:"lesson_id,omitempty" db:"lesson_id"`
+	Title     string     `json:"title,omitempty" db:"title"`
+	Progress  float32    `json:"progress" db:"progress"`
+	Reset     bool       `json:"reset" db:"reset"`
+	CreatedAt *time.Time `json:"-" db:"created_at"`
+	Timestamp int64      `json:"timestamp" db:"-"`
+}
+
+// ProgressUpdater computes the next progress from the current one, which is nil if there is no record yet
+type ProgressUpdater func(current *LessonProgressModel) (next *LessonProgressModel, reset bool, err error)
+
+// PrerequisiteValidator checks the prerequisites about to be saved against all current relations
+type PrerequisiteValidator func(edges []*PrerequisiteModel) error
+
+// content status
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+)
+
+// CourseModel top level of the content hierarchy: course -> unit -> lesson
+type CourseModel struct {
+	ID          int64        `json:"id" db:"id"`
+	Index       int          `json:"index" db:"index"`
+	Title       string       `json:"title" db:"title"`
+	Description string       `json:"description" db:"description"`
+	Status      string       `json:"status" db:"status"`
+	Units       []*UnitModel `json:"units,omitempty" db:"-"`
+}
+
+type UnitModel struct {
+	ID       int64          `json:"id" db:"id"`
+	CourseID int64          `json:"course_id" db:"course_id"`
+	Index    int            `json:"index" db:"index"`
+	Title    string         `json:"title" db:"title"`
+	Status   string         `json:"status" db:"status"`
+	Lessons  []*LessonModel `json:"lessons,omitempty" db:"-"`
+}
+
+type LessonModel struct {
+	ID     int64  `json:"id" db:"id"`
+	UnitID int64  `json:"unit_id" db:"unit_id"`
+	Index  int    `json:"index" db:"index"`
+	Title  string `json:"title" db:"title"`
+	Status string `json:"status" db:"status"`
+}
+
+// PrerequisiteModel lesson can be studied only after prerequisite is completed
+type PrerequisiteModel struct {
+	LessonID       int64 `db:"lesson_id"`
+	PrerequisiteID int64 `db:"prerequisite_id"`
+}
+
+// LessonStateModel lesson with progress and lock state of a user
+type LessonStateModel struct {
+	LessonID      int64   `json:"lesson_id"`
+	Index         int     `json:"index"`
+	Title         string  `json:"title"`
+	Progress      float32 `json:"progress"`
+	Locked        bool    `json:"locked"`
+	Prerequisites []int64 `json:"prerequisites"`
+}
+
+// recommendation reasons
+const (
+	ReasonContinue = "continue" // lesson is in progress
+	ReasonNext     = "next"     // next unlocked lesson in catalog order
+)
+
+type RecommendationModel struct {
+	*LessonStateModel
+	Reason string `json:"reason"`
+}
+
+var (
+	// ErrCourseNotFound no course matches the given ID
+	ErrCourseNotFound = errors.New("Course not found")
+	// ErrUnitNotFound no unit matches the given ID
+	ErrUnitNotFound = errors.New("Unit not found")
+	// ErrLessonNotFound no lesson matches the given ID
+	ErrLessonNotFound = errors.New("Lesson not found")
+	// ErrProgressRegression progress can't go backwards unless it's a reset
+	ErrProgressRegression = errors.New("Progress can not be lower than the current one")
+	// ErrPrerequisiteCycle prerequisites must form a DAG
+	ErrPrerequisiteCycle = errors.New("Prerequisites would form a cycle")
+	// ErrNotEmpty entity still has children
+	ErrNotEmpty = errors.New("Content still has children, remove them first")
+	// ErrLessonInUse lesson has progress records of learners
+	ErrLessonInUse = errors.New("Lesson has learner progress, unpublish it instead")
+)
+
 type LessonRepository interface {
 	GetLessonProgressByUser(ctx context.Context, user *user.UserModel) ([]*LessonProgressModel, error)
+	// UpdateProgress locks the progress record and saves the result of updater along with a history entry
+	UpdateProgress(ctx context.Context, userID string, lessonID int64, updater ProgressUpdater) (*LessonProgressModel, error)
+	GetProgressHistory(ctx context.Context, userID string, lessonID int64) ([]*ProgressHistoryModel, error)
+	// IterateProgressHistory stream history of all lessons created in [from, to), nil bounds are open.
+	// The model passed to fn is reused between calls
+	IterateProgressHistory(ctx context.Context, userID string, from, to *time.Time, fn func(*ProgressHistoryModel) error) error
+	ListPrerequisites(ctx context.Context) ([]*PrerequisiteModel, error)
+	// SetPrerequisites replace prerequisites of a lesson if validate accepts them, concurrent calls are serialized
+	// so validate always sees the relations saved by others
+	SetPrerequisites(ctx context.Context, lessonID int64, prerequisites []int64, validate PrerequisiteValidator) error
+
+	// status filters the result, empty string means all
+	ListCourses(ctx context.Context, status string) ([]*CourseModel, error)
+	ListUnits(ctx context.Context, status string) ([]*UnitModel, error)
+	ListLessons(ctx context.Context, status string) ([]*LessonModel, error)
+
+	GetCourse(ctx context.Context, id int64) (*CourseModel, error)
+	GetUnit(ctx context.Context, id int64) (*UnitModel, error)
+	GetLesson(ctx context.Context, id int64) (*LessonModel, error)
+	CountUnits(ctx context.Context, courseID int64) (int, error)
+	CountLessons(ctx context.Context, unitID int64) (int, error)
+
+	SaveCourse(ctx context.Context, course *CourseModel) error
+	UpdateCourse(ctx context.Context, course *CourseModel) error
+	DeleteCourse(ctx context.Context, id int64) error
+	SaveUnit(ctx context.Context, unit *UnitModel) error
+	UpdateUnit(ctx context.Context, unit *UnitModel) error
+	DeleteUnit(ctx context.Context, id int64) error
+	SaveLesson(ctx context.Context, lesson *LessonModel) error
+	UpdateLesson(ctx context.Context, lesson *LessonModel) error
+	DeleteLesson(ctx context.Context, id int64) error
 }
 
 type LessonUseCase interface {
 	GetUserLessonProgress(ctx context.Context, user *user.UserModel) ([]*LessonProgressModel, error)
+	// RecordProgress progress must be within [0, 1] and monotonic unless reset is set
+	RecordProgress(ctx context.Context, user *user.UserModel, lessonID int64, progress float32, reset bool) (*LessonProgressModel, error)
+	GetProgressHistory(ctx context.Context, user *user.UserModel, lessonID int64) ([]*ProgressHistoryModel, error)
+	// ExportProgressHistory stream history of all lessons created in [from, to) to fn, nil bounds are open.
+	// The model passed to fn is reused between calls
+	ExportProgressHistory(ctx context.Context, user *user.UserModel, from, to *time.Time, fn func(*ProgressHistoryModel) error) error
+	// GetLessonStates list published lessons in catalog order with lock state
+	GetLessonStates(ctx context.Context, user *user.UserModel) ([]*LessonStateModel, error)
+	// RecommendNext returns nil if there is nothing left to study
+	RecommendNext(ctx context.Context, user *user.UserModel) (*RecommendationModel, error)
+	SetPrerequisites(ctx context.Context, lessonID int64, prerequisites []int64) error
+
+	// GetCatalog returns the content tree, drafts are excluded unless includeDraft is set
+	GetCatalog(ctx context.Context, includeDraft bool) ([]*CourseModel, error)
+
+	CreateCourse(ctx context.Context, course *CourseModel) error
+	UpdateCourse(ctx context.Context, course *CourseModel) error
+	DeleteCourse(ctx context.Context, id int64) error
+	CreateUnit(ctx context.Context, unit *UnitModel) error
+	UpdateUnit(ctx context.Context, unit *UnitModel) error
+	DeleteUnit(ctx context.Context, id int64) error
+	CreateLesson(ctx context.Context, lesson *LessonModel) error
+	UpdateLesson(ctx context.Context, lesson *LessonModel) error
+	DeleteLesson(ctx context.Context, id int64) error
 }
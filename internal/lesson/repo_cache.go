@@ -0,0 +1,57 @@
+package lesson
+
+import (
+	"context"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/cache"
+	"github.com/pot-code/go-boilerplate/internal/user"
+	"go.elastic.co/apm"
+)
+
+// LessonCached cache progress of users in front of a LessonRepository
+type LessonCached struct {
+	LessonRepository
+	Progress *cache.Method
+}
+
+var _ LessonRepository = &LessonCached{}
+
+func NewCachedLessonRepository(repo LessonRepository, c *cache.Cache, policy cache.Policy) *LessonCached {
+	return &LessonCached{repo, c.Method("lesson_progress", policy)}
+}
+
+func (repo *LessonCached) GetLessonProgressByUser(ctx context.Context, user *user.UserModel) ([]*LessonProgressModel, error) {
+	var result []*LessonProgressModel
+	err := repo.Progress.Get(ctx, user.ID, "", &result, func(ctx context.Context) (interface{}, error) {
+		return repo.LessonRepository.GetLessonProgressByUser(ctx, user)
+	})
+	return result, err
+}
+
+func (repo *LessonCached) UpdateProgress(
+	ctx context.Context,
+	userID string,
+	lessonID int64,
+	updater ProgressUpdater,
+) (*LessonProgressModel, error) {
+	result, err := repo.LessonRepository.UpdateProgress(ctx, userID, lessonID, updater)
+	if err != nil {
+		return nil, err
+	}
+	// the progress is already saved, stale values expire with the policy
+	if err := repo.Progress.Invalidate(ctx, userID); err != nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	return result, nil
+}
+
+func (repo *LessonCached) UpdateLesson(ctx context.Context, lesson *LessonModel) error {
+	if err := repo.LessonRepository.UpdateLesson(ctx, lesson); err != nil {
+		return err
+	}
+	// titles and indexes of lessons are part of the progress of every user
+	if err := repo.Progress.InvalidateAll(ctx); err != nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	return nil
+}
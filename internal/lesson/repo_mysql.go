@@ -2,28 +2,34 @@ package lesson
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
 	"github.com/pot-code/go-boilerplate/internal/user"
 )
 
 type LessonMySQL struct {
-	Conn driver.ITransactionalDB `dep:""`
+	Conn     driver.ITransactionalDB `dep:""`
+	txRunner *driver.TxRunner
 }
 
 var _ LessonRepository = &LessonMySQL{}
 
 func NewLessonRepository(Conn driver.ITransactionalDB) *LessonMySQL {
 	return &LessonMySQL{
-		Conn: Conn,
+		Conn:     Conn,
+		txRunner: driver.NewTxRunner(Conn, nil),
 	}
 }
 
 func (repo *LessonMySQL) GetLessonProgressByUser(ctx context.Context, user *user.UserModel) ([]*LessonProgressModel, error) {
-	conn := repo.Conn
-	rows, err := conn.QueryContext(ctx, `
+	var result []*LessonProgressModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, `
 SELECT 
-    lp.id, l."index", l."name" title, lp.progress, lp.created_at
+    lp.id, lp.lesson_id, l."index", l."name" title, lp.progress, lp.created_at, lp.updated_at, lp.completed_at
 FROM
     lesson_progress lp
         LEFT JOIN
@@ -31,19 +37,335 @@ FROM
 WHERE
     lp.user_id = $1
 	`, user.ID)
+	return result, err
+}
+
+func (repo *LessonMySQL) UpdateProgress(
+	ctx context.Context,
+	userID string,
+	lessonID int64,
+	updater ProgressUpdater,
+) (*LessonProgressModel, error) {
+	result, err := repo.updateProgress(ctx, userID, lessonID, updater)
+	// a concurrent first update inserted the record, the retry locks and updates it
+	if errors.Is(err, driver.ErrUniqueViolation) {
+		return repo.updateProgress(ctx, userID, lessonID, updater)
+	}
+	return result, err
+}
+
+func (repo *LessonMySQL) updateProgress(
+	ctx context.Context,
+	userID string,
+	lessonID int64,
+	updater ProgressUpdater,
+) (result *LessonProgressModel, err error) {
+	tx, err := repo.Conn.BeginTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelReadCommitted,
+		AccessMode: driver.AccessReadWrite,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	current := new(LessonProgressModel)
+	err = driver.Get(ctx, tx, current, `SELECT id, lesson_id, progress, created_at, completed_at
+	FROM lesson_progress WHERE user_id = $1 AND lesson_id = $2 FOR UPDATE`, userID, lessonID)
+	if err == driver.ErrNoRows {
+		current, err = nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	next, reset, err := updater(current)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	next.LessonID = lessonID
+	next.UpdatedAt = &now
+	if current == nil {
+		next.CreatedAt = &now
+		_, err = tx.ExecContext(ctx, `INSERT INTO lesson_progress(user_id, lesson_id, progress, completed_at, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6)`, userID, lessonID, next.Progress, next.CompletedAt, now, now)
+	} else {
+		next.ID = current.ID
+		next.CreatedAt = current.CreatedAt
+		_, err = tx.ExecContext(ctx, `UPDATE lesson_progress SET progress = $1, completed_at = $2, updated_at = $3 WHERE id = $4`,
+			next.Progress, next.CompletedAt, now, current.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO lesson_progress_history(user_id, lesson_id, progress, reset, created_at)
+	VALUES($1, $2, $3, $4, $5)`, userID, lessonID, next.Progress, reset, now)
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (repo *LessonMySQL) GetProgressHistory(ctx context.Context, userID string, lessonID int64) ([]*ProgressHistoryModel, error) {
+	result := []*ProgressHistoryModel{}
+	err := driver.SelectAll(ctx, repo.Conn, &result, `SELECT progress, reset, created_at
+	FROM lesson_progress_history WHERE user_id = $1 AND lesson_id = $2 ORDER BY created_at, id`, userID, lessonID)
+	return result, err
+}
+
+// IterateProgressHistory call fn with each progress snapshot of all lessons created in [from, to) in chronological order,
+// rows are streamed and the iteration stops at the first error
+func (repo *LessonMySQL) IterateProgressHistory(
+	ctx context.Context,
+	userID string,
+	from, to *time.Time,
+	fn func(*ProgressHistoryModel) error,
+) error {
+	query := `
+SELECT
+    h.lesson_id, COALESCE(l."name", ''), h.progress, h.reset, h.created_at
+FROM
+    lesson_progress_history h
+        LEFT JOIN
+    lesson l ON (l.id = h.lesson_id)
+WHERE
+    h.user_id = $1`
+	args := []interface{}{userID}
+	if from != nil {
+		args = append(args, *from)
+		query += fmt.Sprintf(" AND h.created_at >= $%d", len(args))
+	}
+	if to != nil {
+		args = append(args, *to)
+		query += fmt.Sprintf(" AND h.created_at < $%d", len(args))
+	}
+	rows, err := repo.Conn.QueryContext(ctx, query+" ORDER BY h.created_at, h.id", args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var result []*LessonProgressModel
+	item := new(ProgressHistoryModel)
 	for rows.Next() {
-		item := new(LessonProgressModel)
-		err := rows.Scan(&item.ID, &item.Index, &item.Title, &item.Progress, &item.CreatedAt)
+		if err := rows.Scan(&item.LessonID, &item.Title, &item.Progress, &item.Reset, &item.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (repo *LessonMySQL) ListCourses(ctx context.Context, status string) ([]*CourseModel, error) {
+	query, args := withStatus(`SELECT id, "index", title, description, status FROM course`, status)
+	var result []*CourseModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, query+` ORDER BY "index", id`, args...)
+	return result, err
+}
+
+func (repo *LessonMySQL) ListUnits(ctx context.Context, status string) ([]*UnitModel, error) {
+	query, args := withStatus(`SELECT id, course_id, "index", title, status FROM unit`, status)
+	var result []*UnitModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, query+` ORDER BY "index", id`, args...)
+	return result, err
+}
+
+func (repo *LessonMySQL) ListLessons(ctx context.Context, status string) ([]*LessonModel, error) {
+	query, args := withStatus(`SELECT id, COALESCE(unit_id, 0) unit_id, "index", "name" title, status FROM lesson`, status)
+	var result []*LessonModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, query+` ORDER BY "index", id`, args...)
+	return result, err
+}
+
+func (repo *LessonMySQL) GetCourse(ctx context.Context, id int64) (*CourseModel, error) {
+	item := new(CourseModel)
+	err := driver.Get(ctx, repo.Conn, item, `SELECT id, "index", title, description, status FROM course WHERE id = $1`, id)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (repo *LessonMySQL) GetUnit(ctx context.Context, id int64) (*UnitModel, error) {
+	item := new(UnitModel)
+	err := driver.Get(ctx, repo.Conn, item, `SELECT id, course_id, "index", title, status FROM unit WHERE id = $1`, id)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (repo *LessonMySQL) GetLesson(ctx context.Context, id int64) (*LessonModel, error) {
+	item := new(LessonModel)
+	err := driver.Get(ctx, repo.Conn, item, `SELECT id, COALESCE(unit_id, 0) unit_id, "index", "name" title, status FROM lesson WHERE id = $1`, id)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (repo *LessonMySQL) CountUnits(ctx context.Context, courseID int64) (int, error) {
+	return repo.count(ctx, `SELECT COUNT(*) FROM unit WHERE course_id = $1`, courseID)
+}
+
+func (repo *LessonMySQL) CountLessons(ctx context.Context, unitID int64) (int, error) {
+	return repo.count(ctx, `SELECT COUNT(*) FROM lesson WHERE unit_id = $1`, unitID)
+}
+
+func (repo *LessonMySQL) SaveCourse(ctx context.Context, course *CourseModel) (err error) {
+	now := time.Now()
+	course.ID, err = driver.InsertID(ctx, repo.Conn, `INSERT INTO course("index", title, description, status, created_at, updated_at)
+	VALUES($1, $2, $3, $4, $5, $6)`, course.Index, course.Title, course.Description, course.Status, now, now)
+	return err
+}
+
+func (repo *LessonMySQL) UpdateCourse(ctx context.Context, course *CourseModel) error {
+	_, err := repo.Conn.ExecContext(ctx, `UPDATE course
+	SET "index" = $1, title = $2, description = $3, status = $4, updated_at = $5
+	WHERE id = $6`, course.Index, course.Title, course.Description, course.Status, time.Now(), course.ID)
+	return err
+}
+
+func (repo *LessonMySQL) DeleteCourse(ctx context.Context, id int64) error {
+	_, err := repo.Conn.ExecContext(ctx, `DELETE FROM course WHERE id = $1`, id)
+	// children may be added after the emptiness check
+	if errors.Is(err, driver.ErrForeignKeyViolation) {
+		return ErrNotEmpty
+	}
+	return err
+}
+
+func (repo *LessonMySQL) SaveUnit(ctx context.Context, unit *UnitModel) (err error) {
+	now := time.Now()
+	unit.ID, err = driver.InsertID(ctx, repo.Conn, `INSERT INTO unit(course_id, "index", title, status, created_at, updated_at)
+	VALUES($1, $2, $3, $4, $5, $6)`, unit.CourseID, unit.Index, unit.Title, unit.Status, now, now)
+	return err
+}
+
+func (repo *LessonMySQL) UpdateUnit(ctx context.Context, unit *UnitModel) error {
+	_, err := repo.Conn.ExecContext(ctx, `UPDATE unit
+	SET course_id = $1, "index" = $2, title = $3, status = $4, updated_at = $5
+	WHERE id = $6`, unit.CourseID, unit.Index, unit.Title, unit.Status, time.Now(), unit.ID)
+	return err
+}
+
+func (repo *LessonMySQL) DeleteUnit(ctx context.Context, id int64) error {
+	_, err := repo.Conn.ExecContext(ctx, `DELETE FROM unit WHERE id = $1`, id)
+	// children may be added after the emptiness check
+	if errors.Is(err, driver.ErrForeignKeyViolation) {
+		return ErrNotEmpty
+	}
+	return err
+}
+
+func (repo *LessonMySQL) SaveLesson(ctx context.Context, lesson *LessonModel) (err error) {
+	now := time.Now()
+	lesson.ID, err = driver.InsertID(ctx, repo.Conn, `INSERT INTO lesson(unit_id, "index", "name", status, created_at, updated_at)
+	VALUES($1, $2, $3, $4, $5, $6)`, lesson.UnitID, lesson.Index, lesson.Title, lesson.Status, now, now)
+	return err
+}
+
+func (repo *LessonMySQL) UpdateLesson(ctx context.Context, lesson *LessonModel) error {
+	_, err := repo.Conn.ExecContext(ctx, `UPDATE lesson
+	SET unit_id = $1, "index" = $2, "name" = $3, status = $4, updated_at = $5
+	WHERE id = $6`, lesson.UnitID, lesson.Index, lesson.Title, lesson.Status, time.Now(), lesson.ID)
+	return err
+}
+
+// DeleteLesson delete lesson along with its prerequisite relations, lessons with progress records are kept
+func (repo *LessonMySQL) DeleteLesson(ctx context.Context, id int64) (err error) {
+	tx, err := repo.Conn.BeginTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelReadCommitted,
+		AccessMode: driver.AccessReadWrite,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
 		if err != nil {
-			return nil, err
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM lesson_prerequisite WHERE lesson_id = $1 OR prerequisite_id = $2`, id, id); err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM lesson WHERE id = $1`, id)
+	// progress of learners references the lesson
+	if errors.Is(err, driver.ErrForeignKeyViolation) {
+		err = ErrLessonInUse
+	}
+	return
+}
+
+func (repo *LessonMySQL) ListPrerequisites(ctx context.Context) ([]*PrerequisiteModel, error) {
+	var result []*PrerequisiteModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, `SELECT lesson_id, prerequisite_id FROM lesson_prerequisite`)
+	return result, err
+}
+
+// SetPrerequisites the relations are read and written in a serializable transaction, concurrent writes
+// which together would introduce a cycle fail with a deadlock or serialization failure and are retried
+func (repo *LessonMySQL) SetPrerequisites(
+	ctx context.Context,
+	lessonID int64,
+	prerequisites []int64,
+	validate PrerequisiteValidator,
+) error {
+	return repo.txRunner.RunInTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelSerializable,
+		AccessMode: driver.AccessReadWrite,
+	}, func(tx driver.ITransactionalDB) error {
+		var edges []*PrerequisiteModel
+		if err := driver.SelectAll(ctx, tx, &edges, `SELECT lesson_id, prerequisite_id FROM lesson_prerequisite`); err != nil {
+			return err
+		}
+		if err := validate(edges); err != nil {
+			return err
 		}
-		result = append(result, item)
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM lesson_prerequisite WHERE lesson_id = $1`, lessonID); err != nil {
+			return err
+		}
+		for _, p := range prerequisites {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO lesson_prerequisite(lesson_id, prerequisite_id) VALUES($1, $2)`, lessonID, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (repo *LessonMySQL) count(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var n int
+	err := driver.Get(ctx, repo.Conn, &n, query, args...)
+	return n, err
+}
+
+// withStatus append status condition to query if status is not empty
+func withStatus(query string, status string) (string, []interface{}) {
+	if status == "" {
+		return query, nil
 	}
-	return result, nil
+	return query + ` WHERE status = $1`, []interface{}{status}
 }
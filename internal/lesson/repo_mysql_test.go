@@ -0,0 +1,52 @@
+package lesson
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver/drivertest"
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/logging"
+	"go.uber.org/zap/zaptest"
+)
+
+func testContext(t *testing.T) context.Context {
+	return logging.SetLoggerInContext(context.Background(), zaptest.NewLogger(t))
+}
+
+func TestUpdateProgressRetriesLostInsert(t *testing.T) {
+	db := drivertest.NewFakeDB()
+	// the first attempt finds no record, but a concurrent update inserts it first
+	db.ExpectBegin()
+	db.ExpectQuery(`FROM lesson_progress WHERE .* FOR UPDATE`).WithArgs("user", int64(1))
+	db.ExpectExec(`INSERT INTO lesson_progress\(`).WillReturnError(&driver.Error{Kind: driver.ErrUniqueViolation, Err: driver.ErrUniqueViolation})
+	db.ExpectRollback()
+	// the retry locks the inserted record and updates it
+	db.ExpectBegin()
+	db.ExpectQuery(`FROM lesson_progress WHERE .* FOR UPDATE`).WithArgs("user", int64(1)).
+		WillReturnRows(drivertest.NewRows("id", "lesson_id", "progress", "created_at", "completed_at").
+			AddRow(7, 1, 0.5, time.Now(), nil))
+	db.ExpectExec(`UPDATE lesson_progress SET`).WithArgs(float32(0.8), nil, drivertest.AnyArg(), 7)
+	db.ExpectExec(`INSERT INTO lesson_progress_history`)
+	db.ExpectCommit()
+
+	var seen []*LessonProgressModel
+	repo := NewLessonRepository(db)
+	result, err := repo.UpdateProgress(testContext(t), "user", 1, func(current *LessonProgressModel) (*LessonProgressModel, bool, error) {
+		seen = append(seen, current)
+		return &LessonProgressModel{Progress: 0.8}, false, nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateProgress() error = %v", err)
+	}
+	if err := db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != nil || seen[1] == nil || seen[1].Progress != 0.5 {
+		t.Fatalf("Expected updater to see no record, then the inserted one, got %+v", seen)
+	}
+	if result.ID != 7 || result.Progress != 0.8 {
+		t.Fatalf("Expected record 7 to be updated, got %+v", result)
+	}
+}
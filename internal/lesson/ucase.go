@@ -2,14 +2,17 @@ package lesson
 
 import (
 	"context"
+	"time"
 
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
 	"github.com/pot-code/go-boilerplate/internal/user"
 	"go.elastic.co/apm"
 )
 
 // LessonUseCaseImpl ...
 type LessonUseCaseImpl struct {
-	LessonRepository LessonRepository
+	LessonRepository   LessonRepository
+	LeaderboardUseCase leaderboard.LeaderboardUseCase
 }
 
 var _ LessonUseCase = &LessonUseCaseImpl{}
@@ -17,8 +20,9 @@ var _ LessonUseCase = &LessonUseCaseImpl{}
 // NewLessonUseCase ...
 func NewLessonUseCase(
 	LessonRepository LessonRepository,
+	LeaderboardUseCase leaderboard.LeaderboardUseCase,
 ) *LessonUseCaseImpl {
-	return &LessonUseCaseImpl{LessonRepository}
+	return &LessonUseCaseImpl{LessonRepository, LeaderboardUseCase}
 }
 
 // GetUserLessonProgress get learning progress for each lesson
@@ -31,7 +35,487 @@ func (lu *LessonUseCaseImpl) GetUserLessonProgress(ctx context.Context, user *us
 		return nil, err
 	}
 	for _, e := range progress {
-		e.Timestamp = e.CreatedAt.Unix() * 1e3 // milliseconds
+		setProgressTimestamp(e)
 	}
 	return progress, nil
 }
+
+// RecordProgress save learning progress of a lesson
+//
+// the completion time is recorded the first time progress reaches 1, a reset below 1 clears it
+func (lu *LessonUseCaseImpl) RecordProgress(
+	ctx context.Context,
+	user *user.UserModel,
+	lessonID int64,
+	progress float32,
+	reset bool,
+) (*LessonProgressModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.RecordProgress", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if l, err := lr.GetLesson(ctx, lessonID); err != nil {
+		return nil, err
+	} else if l == nil || l.Status != StatusPublished {
+		return nil, ErrLessonNotFound
+	}
+
+	var completedBefore *time.Time
+	result, err := lr.UpdateProgress(ctx, user.ID, lessonID, func(current *LessonProgressModel) (*LessonProgressModel, bool, error) {
+		next := &LessonProgressModel{Progress: progress}
+		if current != nil {
+			completedBefore = current.CompletedAt
+			if progress < current.Progress && !reset {
+				return nil, false, ErrProgressRegression
+			}
+			next.CompletedAt = current.CompletedAt
+		}
+		if progress >= 1 {
+			if next.CompletedAt == nil {
+				now := time.Now()
+				next.CompletedAt = &now
+			}
+		} else {
+			next.CompletedAt = nil
+		}
+		return next, reset, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the progress is already saved, leaderboards are repaired by the rebuild job
+	if err := lu.updateLeaderboard(ctx, user.ID, completedBefore, result.CompletedAt); err != nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	setProgressTimestamp(result)
+	return result, nil
+}
+
+// updateLeaderboard count a newly completed lesson, or take back the completion cleared by a reset
+func (lu *LessonUseCaseImpl) updateLeaderboard(ctx context.Context, userID string, before, after *time.Time) error {
+	switch {
+	case before == nil && after != nil:
+		return lu.LeaderboardUseCase.AddCompletedLessons(ctx, userID, *after, 1)
+	case before != nil && after == nil:
+		return lu.LeaderboardUseCase.AddCompletedLessons(ctx, userID, *before, -1)
+	}
+	return nil
+}
+
+// GetProgressHistory get progress snapshots of a lesson in chronological order
+func (lu *LessonUseCaseImpl) GetProgressHistory(ctx context.Context, user *user.UserModel, lessonID int64) ([]*ProgressHistoryModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.GetProgressHistory", "service")
+	defer apmSpan.End()
+
+	history, err := lu.LessonRepository.GetProgressHistory(ctx, user.ID, lessonID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range history {
+		e.Timestamp = e.CreatedAt.Unix() * 1e3 // milliseconds
+	}
+	return history, nil
+}
+
+// ExportProgressHistory export progress snapshots of all lessons in chronological order
+func (lu *LessonUseCaseImpl) ExportProgressHistory(
+	ctx context.Context,
+	user *user.UserModel,
+	from, to *time.Time,
+	fn func(*ProgressHistoryModel) error,
+) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.ExportProgressHistory", "service")
+	defer apmSpan.End()
+
+	return lu.LessonRepository.IterateProgressHistory(ctx, user.ID, from, to, func(e *ProgressHistoryModel) error {
+		e.Timestamp = e.CreatedAt.Unix() * 1e3 // milliseconds
+		return fn(e)
+	})
+}
+
+func setProgressTimestamp(e *LessonProgressModel) {
+	e.Timestamp = e.CreatedAt.Unix() * 1e3 // milliseconds
+	if e.CompletedAt != nil {
+		e.CompletedTimestamp = e.CompletedAt.Unix() * 1e3
+	}
+}
+
+// GetCatalog assemble the course -> unit -> lesson tree
+//
+// children of an invisible parent are dropped, so a published lesson under a draft unit won't show up
+func (lu *LessonUseCaseImpl) GetCatalog(ctx context.Context, includeDraft bool) ([]*CourseModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.GetCatalog", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	status := StatusPublished
+	if includeDraft {
+		status = ""
+	}
+
+	courses, err := lr.ListCourses(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	units, err := lr.ListUnits(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	lessons, err := lr.ListLessons(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+
+	unitMap := make(map[int64]*UnitModel, len(units))
+	for _, u := range units {
+		unitMap[u.ID] = u
+	}
+	for _, l := range lessons {
+		if u, ok := unitMap[l.UnitID]; ok {
+			u.Lessons = append(u.Lessons, l)
+		}
+	}
+	courseMap := make(map[int64]*CourseModel, len(courses))
+	for _, c := range courses {
+		courseMap[c.ID] = c
+	}
+	for _, u := range units {
+		if c, ok := courseMap[u.CourseID]; ok {
+			c.Units = append(c.Units, u)
+		}
+	}
+	if courses == nil {
+		courses = []*CourseModel{}
+	}
+	return courses, nil
+}
+
+// CreateCourse .
+func (lu *LessonUseCaseImpl) CreateCourse(ctx context.Context, course *CourseModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.CreateCourse", "service")
+	defer apmSpan.End()
+
+	return lu.LessonRepository.SaveCourse(ctx, course)
+}
+
+// UpdateCourse .
+func (lu *LessonUseCaseImpl) UpdateCourse(ctx context.Context, course *CourseModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.UpdateCourse", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetCourse(ctx, course.ID); err != nil {
+		return err
+	} else if old == nil {
+		return ErrCourseNotFound
+	}
+	return lr.UpdateCourse(ctx, course)
+}
+
+// DeleteCourse delete an empty course
+func (lu *LessonUseCaseImpl) DeleteCourse(ctx context.Context, id int64) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.DeleteCourse", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetCourse(ctx, id); err != nil {
+		return err
+	} else if old == nil {
+		return ErrCourseNotFound
+	}
+	if n, err := lr.CountUnits(ctx, id); err != nil {
+		return err
+	} else if n > 0 {
+		return ErrNotEmpty
+	}
+	return lr.DeleteCourse(ctx, id)
+}
+
+// CreateUnit .
+func (lu *LessonUseCaseImpl) CreateUnit(ctx context.Context, unit *UnitModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.CreateUnit", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if course, err := lr.GetCourse(ctx, unit.CourseID); err != nil {
+		return err
+	} else if course == nil {
+		return ErrCourseNotFound
+	}
+	return lr.SaveUnit(ctx, unit)
+}
+
+// UpdateUnit .
+func (lu *LessonUseCaseImpl) UpdateUnit(ctx context.Context, unit *UnitModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.UpdateUnit", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetUnit(ctx, unit.ID); err != nil {
+		return err
+	} else if old == nil {
+		return ErrUnitNotFound
+	}
+	if course, err := lr.GetCourse(ctx, unit.CourseID); err != nil {
+		return err
+	} else if course == nil {
+		return ErrCourseNotFound
+	}
+	return lr.UpdateUnit(ctx, unit)
+}
+
+// DeleteUnit delete an empty unit
+func (lu *LessonUseCaseImpl) DeleteUnit(ctx context.Context, id int64) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.DeleteUnit", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetUnit(ctx, id); err != nil {
+		return err
+	} else if old == nil {
+		return ErrUnitNotFound
+	}
+	if n, err := lr.CountLessons(ctx, id); err != nil {
+		return err
+	} else if n > 0 {
+		return ErrNotEmpty
+	}
+	return lr.DeleteUnit(ctx, id)
+}
+
+// CreateLesson .
+func (lu *LessonUseCaseImpl) CreateLesson(ctx context.Context, lesson *LessonModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.CreateLesson", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if unit, err := lr.GetUnit(ctx, lesson.UnitID); err != nil {
+		return err
+	} else if unit == nil {
+		return ErrUnitNotFound
+	}
+	return lr.SaveLesson(ctx, lesson)
+}
+
+// UpdateLesson .
+func (lu *LessonUseCaseImpl) UpdateLesson(ctx context.Context, lesson *LessonModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.UpdateLesson", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetLesson(ctx, lesson.ID); err != nil {
+		return err
+	} else if old == nil {
+		return ErrLessonNotFound
+	}
+	if unit, err := lr.GetUnit(ctx, lesson.UnitID); err != nil {
+		return err
+	} else if unit == nil {
+		return ErrUnitNotFound
+	}
+	return lr.UpdateLesson(ctx, lesson)
+}
+
+// DeleteLesson .
+func (lu *LessonUseCaseImpl) DeleteLesson(ctx context.Context, id int64) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.DeleteLesson", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if old, err := lr.GetLesson(ctx, id); err != nil {
+		return err
+	} else if old == nil {
+		return ErrLessonNotFound
+	}
+	return lr.DeleteLesson(ctx, id)
+}
+
+// SetPrerequisites replace prerequisites of a lesson, the write is rejected if it introduces a cycle
+func (lu *LessonUseCaseImpl) SetPrerequisites(ctx context.Context, lessonID int64, prerequisites []int64) error {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.SetPrerequisites", "service")
+	defer apmSpan.End()
+
+	lr := lu.LessonRepository
+	if l, err := lr.GetLesson(ctx, lessonID); err != nil {
+		return err
+	} else if l == nil {
+		return ErrLessonNotFound
+	}
+
+	seen := make(map[int64]bool, len(prerequisites))
+	unique := make([]int64, 0, len(prerequisites))
+	for _, p := range prerequisites {
+		if p == lessonID {
+			return ErrPrerequisiteCycle
+		}
+		if seen[p] {
+			continue
+		}
+		if l, err := lr.GetLesson(ctx, p); err != nil {
+			return err
+		} else if l == nil {
+			return ErrLessonNotFound
+		}
+		seen[p] = true
+		unique = append(unique, p)
+	}
+
+	return lr.SetPrerequisites(ctx, lessonID, unique, func(edges []*PrerequisiteModel) error {
+		graph := buildPrerequisiteGraph(edges)
+		graph[lessonID] = unique
+		for _, p := range unique {
+			if reachable(graph, p, lessonID) {
+				return ErrPrerequisiteCycle
+			}
+		}
+		return nil
+	})
+}
+
+// GetLessonStates a lesson is locked until all of its prerequisites are completed
+func (lu *LessonUseCaseImpl) GetLessonStates(ctx context.Context, user *user.UserModel) ([]*LessonStateModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.GetLessonStates", "service")
+	defer apmSpan.End()
+
+	states, _, err := lu.getLessonStates(ctx, user)
+	return states, err
+}
+
+// RecommendNext recommend what to study next
+//
+// the most recently studied unlocked lesson in progress comes first, otherwise the first unlocked
+// lesson not yet started in catalog order
+func (lu *LessonUseCaseImpl) RecommendNext(ctx context.Context, user *user.UserModel) (*RecommendationModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "LessonUseCaseImpl.RecommendNext", "service")
+	defer apmSpan.End()
+
+	states, progress, err := lu.getLessonStates(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		inProgress *LessonStateModel
+		latest     time.Time
+		next       *LessonStateModel
+	)
+	for _, s := range states {
+		if s.Locked || s.Progress >= 1 {
+			continue
+		}
+		p, ok := progress[s.LessonID]
+		if !ok {
+			if next == nil {
+				next = s
+			}
+			continue
+		}
+		at := lastStudied(p)
+		if inProgress == nil || at.After(latest) {
+			inProgress = s
+			latest = at
+		}
+	}
+	if inProgress != nil {
+		return &RecommendationModel{inProgress, ReasonContinue}, nil
+	}
+	if next != nil {
+		return &RecommendationModel{next, ReasonNext}, nil
+	}
+	return nil, nil
+}
+
+func (lu *LessonUseCaseImpl) getLessonStates(
+	ctx context.Context,
+	user *user.UserModel,
+) ([]*LessonStateModel, map[int64]*LessonProgressModel, error) {
+	lr := lu.LessonRepository
+	catalog, err := lu.GetCatalog(ctx, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	edges, err := lr.ListPrerequisites(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := lr.GetLessonProgressByUser(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	graph := buildPrerequisiteGraph(edges)
+	progress := make(map[int64]*LessonProgressModel, len(records))
+	for _, r := range records {
+		progress[r.LessonID] = r
+	}
+	completed := func(id int64) bool {
+		p, ok := progress[id]
+		return ok && p.Progress >= 1
+	}
+
+	states := []*LessonStateModel{}
+	for _, c := range catalog {
+		for _, u := range c.Units {
+			for _, l := range u.Lessons {
+				state := &LessonStateModel{
+					LessonID:      l.ID,
+					Index:         l.Index,
+					Title:         l.Title,
+					Prerequisites: graph[l.ID],
+				}
+				if state.Prerequisites == nil {
+					state.Prerequisites = []int64{}
+				}
+				if p, ok := progress[l.ID]; ok {
+					state.Progress = p.Progress
+				}
+				for _, pre := range state.Prerequisites {
+					if !completed(pre) {
+						state.Locked = true
+						break
+					}
+				}
+				states = append(states, state)
+			}
+		}
+	}
+	return states, progress, nil
+}
+
+func lastStudied(p *LessonProgressModel) time.Time {
+	if p.UpdatedAt != nil {
+		return *p.UpdatedAt
+	}
+	if p.CreatedAt != nil {
+		return *p.CreatedAt
+	}
+	return time.Time{}
+}
+
+// buildPrerequisiteGraph map lesson to its prerequisites
+func buildPrerequisiteGraph(edges []*PrerequisiteModel) map[int64][]int64 {
+	graph := make(map[int64][]int64)
+	for _, e := range edges {
+		graph[e.LessonID] = append(graph[e.LessonID], e.PrerequisiteID)
+	}
+	return graph
+}
+
+// reachable check if target can be reached from src following prerequisite edges
+func reachable(graph map[int64][]int64, src, target int64) bool {
+	visited := make(map[int64]bool)
+	stack := []int64{src}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == target {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		stack = append(stack, graph[n]...)
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package timespent
+
+import (
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/user"
+)
+
+// calendar computes day and week boundaries in the time zone of a user
+//
+// days are stored as DATE, which carries no zone, so a stored day is the calendar day of the user
+type calendar struct {
+	loc       *time.Location
+	weekStart time.Weekday
+}
+
+func newCalendar(user *user.UserModel) (*calendar, error) {
+	loc, err := user.Location()
+	if err != nil {
+		return nil, err
+	}
+	return &calendar{loc, user.FirstWeekday()}, nil
+}
+
+// day local midnight of the calendar day of t in the user's zone
+func (c *calendar) day(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
+
+// date local midnight of a stored date, the zone of stored is ignored
+func (c *calendar) date(stored time.Time) time.Time {
+	y, m, d := stored.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
+
+// storage date value to pass to the database for a local day
+func (c *calendar) storage(day time.Time) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// weekday index of day relative to the first day of week
+func (c *calendar) weekday(day time.Time) int {
+	return (int(day.Weekday()) - int(c.weekStart) + 7) % 7
+}
+
+func (c *calendar) bucketStart(day time.Time, granularity string) time.Time {
+	y, m, d := day.Date()
+	switch granularity {
+	case GranularityWeek:
+		return time.Date(y, m, d-c.weekday(day), 0, 0, 0, 0, c.loc)
+	case GranularityMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, c.loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+	}
+}
+
+func (c *calendar) nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
@@ -2,27 +2,176 @@ package timespent
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/pot-code/go-boilerplate/internal/user"
 )
 
 type TimeSpentModel struct {
-	ID         int        `json:"-"`
-	UserID     string     `json:"-"`
-	Vocabulary int        `json:"vocabulary"`
-	Grammar    int        `json:"grammar"`
-	Listening  int        `json:"listening"`
-	Writing    int        `json:"writing"`
-	TS         *time.Time `json:"-"`
-	Weekday    int        `json:"weekday"`
-	Timestamp  int64      `json:"timestamp"`
+	ID         int        `json:"-" db:"id"`
+	UserID     string     `json:"-" db:"user_id"`
+	Vocabulary int        `json:"vocabulary" db:"vocabulary"`
+	Grammar    int        `json:"grammar" db:"grammar"`
+	Listening  int        `json:"listening" db:"listening"`
+	Writing    int        `json:"writing" db:"writing"`
+	TS         *time.Time `json:"-" db:"ts"`
+	Weekday    int        `json:"weekday" db:"-"`
+	Timestamp  int64      `json:"timestamp" db:"-"`
 }
 
+// Total total minutes of all skills
+func (tsm *TimeSpentModel) Total() int {
+	return tsm.Vocabulary + tsm.Grammar + tsm.Listening + tsm.Writing
+}
+
+// granularity of time spent report
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// MaxReportBuckets maximum number of buckets in a report
+const MaxReportBuckets = 400
+
+// TimeSpentBucketModel minutes spent on each skill in a period
+type TimeSpentBucketModel struct {
+	Start      time.Time `json:"-"`
+	Timestamp  int64     `json:"timestamp"` // start of the period in milliseconds
+	Vocabulary int       `json:"vocabulary"`
+	Grammar    int       `json:"grammar"`
+	Listening  int       `json:"listening"`
+	Writing    int       `json:"writing"`
+	Total      int       `json:"total"`
+}
+
+func (tbm *TimeSpentBucketModel) add(tsm *TimeSpentModel) {
+	tbm.Vocabulary += tsm.Vocabulary
+	tbm.Grammar += tsm.Grammar
+	tbm.Listening += tsm.Listening
+	tbm.Writing += tsm.Writing
+	tbm.Total += tsm.Total()
+}
+
+// TimeSpentReportModel zero-filled buckets between two days
+type TimeSpentReportModel struct {
+	Granularity string                  `json:"granularity"`
+	Buckets     []*TimeSpentBucketModel `json:"buckets"`
+	Totals      *TimeSpentBucketModel   `json:"totals"`
+}
+
+// StreakModel consecutive days with activity, maintained on every write
+type StreakModel struct {
+	UserID              string     `json:"-" db:"user_id"`
+	Current             int        `json:"current" db:"current_streak"`
+	Longest             int        `json:"longest" db:"longest_streak"`
+	LastActive          *time.Time `json:"-" db:"last_active"`
+	LastActiveTimestamp int64      `json:"last_active,omitempty" db:"-"` // milliseconds
+}
+
+// Advance count day as an active day, day must be a stored date
+//
+// days before the last active day can't bridge a past gap, they are ignored
+func (sm *StreakModel) Advance(day time.Time) {
+	if sm.LastActive == nil {
+		sm.Current = 1
+	} else {
+		switch gap := int(day.Sub(*sm.LastActive).Hours() / 24); {
+		case gap <= 0:
+			return
+		case gap == 1:
+			sm.Current++
+		default:
+			sm.Current = 1
+		}
+	}
+	sm.LastActive = &day
+	if sm.Current > sm.Longest {
+		sm.Longest = sm.Current
+	}
+}
+
+// GoalModel daily goal in minutes for each skill, zero means no goal
+type GoalModel struct {
+	UserID     string `json:"-" db:"user_id"`
+	Vocabulary int    `json:"vocabulary" db:"vocabulary"`
+	Grammar    int    `json:"grammar" db:"grammar"`
+	Listening  int    `json:"listening" db:"listening"`
+	Writing    int    `json:"writing" db:"writing"`
+}
+
+// SkillGoalProgressModel time spent on a skill against its goal
+type SkillGoalProgressModel struct {
+	Skill string `json:"skill"`
+	Goal  int    `json:"goal"`
+	Spent int    `json:"spent"`
+	Met   bool   `json:"met"`
+}
+
+// GoalProgressModel progress of daily goals in a day
+type GoalProgressModel struct {
+	Timestamp int64                     `json:"timestamp"` // start of the day in milliseconds
+	Skills    []*SkillGoalProgressModel `json:"skills"`
+	Met       bool                      `json:"met"` // all goals are met
+}
+
+// MaxMinutesPerDay upper bound of the time that can be spent in one day
+const MaxMinutesPerDay = 24 * 60
+
+var (
+	// ErrImplausibleTimeSpent time spent exceeds the length of a day
+	ErrImplausibleTimeSpent = errors.New("Time spent exceeds 24 hours in a day")
+	// ErrRangeTooLarge report has too many buckets
+	ErrRangeTooLarge = errors.New("Time range is too large for the granularity")
+	// ErrInvalidRange from is after to
+	ErrInvalidRange = errors.New("From must not be after to")
+	// ErrFutureDate time can't be spent in the future
+	ErrFutureDate = errors.New("Date can not be in the future")
+	// ErrSessionConflict session ID is used by another user or day
+	ErrSessionConflict = errors.New("Session ID is already used")
+)
+
+// TimeSpentValidator checks the accumulated day record before it's committed, an error discards the record
+type TimeSpentValidator func(result *TimeSpentModel) error
+
 type TimeSpentRepository interface {
-	GetTimeSpentInWeekByUser(ctx context.Context, user *user.UserModel, at *time.Time) ([]*TimeSpentModel, error)
+	// GetDailyTimeSpent sums time spent per day in [from, to)
+	GetDailyTimeSpent(ctx context.Context, userID string, from, to time.Time) ([]*TimeSpentModel, error)
+	// IterateDailyTimeSpent stream time spent per day in [from, to), nil bounds are open.
+	// The model passed to fn is reused between calls
+	IterateDailyTimeSpent(ctx context.Context, userID string, from, to *time.Time, fn func(*TimeSpentModel) error) error
+	// RecordTimeSpent adds minutes of delta to the day record unless the session is already recorded,
+	// in which case the current day record is returned with replayed set. The streak is advanced in
+	// the same transaction
+	RecordTimeSpent(
+		ctx context.Context,
+		sessionID string,
+		userID string,
+		day time.Time,
+		delta *TimeSpentModel,
+		validate TimeSpentValidator,
+	) (result *TimeSpentModel, replayed bool, err error)
+	// GetStreak returns a zero streak if user has no activity
+	GetStreak(ctx context.Context, userID string) (*StreakModel, error)
+	// GetGoal returns a zero goal if user hasn't set one
+	GetGoal(ctx context.Context, userID string) (*GoalModel, error)
+	SaveGoal(ctx context.Context, goal *GoalModel) error
 }
 
 type TimeSpentUseCase interface {
 	GetUserTimeSpent(ctx context.Context, user *user.UserModel, until *time.Time) ([]*TimeSpentModel, error)
+	// GetTimeSpentReport aggregates time spent between the days of from and to(both inclusive)
+	GetTimeSpentReport(ctx context.Context, user *user.UserModel, from, to time.Time, granularity string) (*TimeSpentReportModel, error)
+	// ExportTimeSpent streams time spent per day between the days of from and to(both inclusive, nil is open) to fn.
+	// The model passed to fn is reused between calls
+	ExportTimeSpent(ctx context.Context, user *user.UserModel, from, to *time.Time, fn func(*TimeSpentModel) error) error
+	// RecordTimeSpent accumulates minutes of record into the day of record.TS, it's idempotent on sessionID
+	RecordTimeSpent(ctx context.Context, user *user.UserModel, sessionID string, record *TimeSpentModel) (*TimeSpentModel, error)
+	// GetStreak current streak is reset if user missed yesterday in the user's time zone
+	GetStreak(ctx context.Context, user *user.UserModel) (*StreakModel, error)
+	GetGoal(ctx context.Context, user *user.UserModel) (*GoalModel, error)
+	SetGoal(ctx context.Context, user *user.UserModel, goal *GoalModel) error
+	// GetGoalProgress progress of daily goals in the day containing at
+	GetGoalProgress(ctx context.Context, user *user.UserModel, at time.Time) (*GoalProgressModel, error)
 }
@@ -0,0 +1,49 @@
+package timespent
+
+import (
+	"context"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/cache"
+	"go.elastic.co/apm"
+)
+
+// TimeSpentCached cache daily time spent of users in front of a TimeSpentRepository
+type TimeSpentCached struct {
+	TimeSpentRepository
+	Daily *cache.Method
+}
+
+var _ TimeSpentRepository = &TimeSpentCached{}
+
+func NewCachedTimeSpentRepository(repo TimeSpentRepository, c *cache.Cache, policy cache.Policy) *TimeSpentCached {
+	return &TimeSpentCached{repo, c.Method("time_spent", policy)}
+}
+
+func (repo *TimeSpentCached) GetDailyTimeSpent(ctx context.Context, userID string, from, to time.Time) ([]*TimeSpentModel, error) {
+	var result []*TimeSpentModel
+	field := from.Format(time.RFC3339) + "/" + to.Format(time.RFC3339)
+	err := repo.Daily.Get(ctx, userID, field, &result, func(ctx context.Context) (interface{}, error) {
+		return repo.TimeSpentRepository.GetDailyTimeSpent(ctx, userID, from, to)
+	})
+	return result, err
+}
+
+func (repo *TimeSpentCached) RecordTimeSpent(
+	ctx context.Context,
+	sessionID string,
+	userID string,
+	day time.Time,
+	delta *TimeSpentModel,
+	validate TimeSpentValidator,
+) (*TimeSpentModel, bool, error) {
+	result, replayed, err := repo.TimeSpentRepository.RecordTimeSpent(ctx, sessionID, userID, day, delta, validate)
+	if err != nil || replayed {
+		return result, replayed, err
+	}
+	// the record is already saved, stale values expire with the policy
+	if err := repo.Daily.Invalidate(ctx, userID); err != nil {
+		apm.CaptureError(ctx, err).Send()
+	}
+	return result, replayed, nil
+}
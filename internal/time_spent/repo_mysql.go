@@ -2,10 +2,12 @@ package timespent
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
-	"github.com/pot-code/go-boilerplate/internal/user"
 )
 
 type TimeSpentMySQL struct {
@@ -20,37 +22,244 @@ func NewTimeSpentRepository(Conn driver.ITransactionalDB) *TimeSpentMySQL {
 	}
 }
 
-func (repo *TimeSpentMySQL) GetTimeSpentInWeekByUser(ctx context.Context, user *user.UserModel, at *time.Time) ([]*TimeSpentModel, error) {
-	conn := repo.Conn
-	rows, err := conn.QueryContext(ctx, `
+func (repo *TimeSpentMySQL) GetDailyTimeSpent(ctx context.Context, userID string, from, to time.Time) ([]*TimeSpentModel, error) {
+	var result []*TimeSpentModel
+	err := driver.SelectAll(ctx, repo.Conn, &result, `
 SELECT 
-    WEEKDAY(ts),
+    ts,
     SUM(vocabulary) vocabulary,
     SUM(grammar) grammar,
     SUM(listening) listening,
-    SUM(writing) writing,
-    ts
+    SUM(writing) writing
 FROM
     lesson_time_spent
 WHERE
-    YEARWEEK(ts, 1) = YEARWEEK($1, 1)
-        AND user_id = $2
+    user_id = $1
+        AND ts >= $2
+        AND ts < $3
 GROUP BY ts
 ORDER BY ts ASC;
-	`, at, user.ID)
+	`, userID, from, to)
+	return result, err
+}
+
+// IterateDailyTimeSpent call fn with the time spent of each day in [from, to) in chronological order,
+// rows are streamed and the iteration stops at the first error
+func (repo *TimeSpentMySQL) IterateDailyTimeSpent(
+	ctx context.Context,
+	userID string,
+	from, to *time.Time,
+	fn func(*TimeSpentModel) error,
+) error {
+	conn := repo.Conn
+	query := `SELECT ts, vocabulary, grammar, listening, writing FROM lesson_time_spent WHERE user_id = $1`
+	args := []interface{}{userID}
+	if from != nil {
+		args = append(args, *from)
+		query += fmt.Sprintf(" AND ts >= $%d", len(args))
+	}
+	if to != nil {
+		args = append(args, *to)
+		query += fmt.Sprintf(" AND ts < $%d", len(args))
+	}
+	rows, err := conn.QueryContext(ctx, query+" ORDER BY ts ASC", args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var result []*TimeSpentModel
+	item := new(TimeSpentModel)
 	for rows.Next() {
-		item := new(TimeSpentModel)
-		err := rows.Scan(&item.Weekday, &item.Vocabulary, &item.Grammar, &item.Listening, &item.Writing, &item.TS)
+		var vocabulary, grammar, listening, writing sql.NullInt64
+		if err := rows.Scan(&item.TS, &vocabulary, &grammar, &listening, &writing); err != nil {
+			return err
+		}
+		item.Vocabulary = int(vocabulary.Int64)
+		item.Grammar = int(grammar.Int64)
+		item.Listening = int(listening.Int64)
+		item.Writing = int(writing.Int64)
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// errSessionRecorded the session row is inserted by an earlier or concurrent request
+var errSessionRecorded = errors.New("session is already recorded")
+
+func (repo *TimeSpentMySQL) RecordTimeSpent(
+	ctx context.Context,
+	sessionID string,
+	userID string,
+	day time.Time,
+	delta *TimeSpentModel,
+	validate TimeSpentValidator,
+) (*TimeSpentModel, bool, error) {
+	result, err := repo.recordTimeSpent(ctx, sessionID, userID, day, delta, validate)
+	if err == errSessionRecorded {
+		return repo.replaySession(ctx, sessionID, userID, day)
+	}
+	return result, false, err
+}
+
+// recordTimeSpent claim the session by inserting it first, then accumulate delta into the day record
+func (repo *TimeSpentMySQL) recordTimeSpent(
+	ctx context.Context,
+	sessionID string,
+	userID string,
+	day time.Time,
+	delta *TimeSpentModel,
+	validate TimeSpentValidator,
+) (result *TimeSpentModel, err error) {
+	tx, err := repo.Conn.BeginTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelReadCommitted,
+		AccessMode: driver.AccessReadWrite,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
 		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// a concurrent insert of the same session waits for the first one to commit, then violates the key
+	_, err = tx.ExecContext(ctx, `INSERT INTO time_spent_session(session_id, user_id, ts, created_at) VALUES($1, $2, $3, $4)`,
+		sessionID, userID, day, time.Now())
+	if errors.Is(err, driver.ErrUniqueViolation) {
+		return nil, errSessionRecorded
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = driver.Upsert(ctx, tx, &driver.UpsertSpec{
+		Table:   "lesson_time_spent",
+		Columns: []string{"user_id", "ts", "vocabulary", "grammar", "listening", "writing"},
+		Key:     []string{"user_id", "ts"},
+		Add:     []string{"vocabulary", "grammar", "listening", "writing"},
+	}, userID, day, delta.Vocabulary, delta.Grammar, delta.Listening, delta.Writing); err != nil {
+		return nil, err
+	}
+	// the row is locked by the upsert until commit
+	result, err = getTimeSpentByDay(ctx, tx, userID, day, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = validate(result); err != nil {
+		return nil, err
+	}
+	if result.Total() > 0 {
+		if err = advanceStreak(ctx, tx, userID, day); err != nil {
 			return nil, err
 		}
-		result = append(result, item)
 	}
 	return result, nil
 }
+
+// replaySession return the current day record if the recorded session belongs to the same user and day
+func (repo *TimeSpentMySQL) replaySession(ctx context.Context, sessionID, userID string, day time.Time) (*TimeSpentModel, bool, error) {
+	// the session may be committed just now, replicas can lag behind
+	ctx = driver.WithPrimary(ctx)
+	var session struct {
+		UserID string    `db:"user_id"`
+		TS     time.Time `db:"ts"`
+	}
+	err := driver.Get(ctx, repo.Conn, &session, `SELECT user_id, ts FROM time_spent_session WHERE session_id = $1`, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if session.UserID != userID || !sameDay(session.TS, day) {
+		return nil, false, ErrSessionConflict
+	}
+	current, err := getTimeSpentByDay(ctx, repo.Conn, userID, day, false)
+	if err == nil && current == nil {
+		current = &TimeSpentModel{UserID: userID, TS: &day}
+	}
+	return current, true, err
+}
+
+func advanceStreak(ctx context.Context, tx driver.ITransactionalDB, userID string, day time.Time) error {
+	// make sure there is a row to lock, FOR UPDATE on a missing row locks nothing
+	if _, err := driver.Upsert(ctx, tx, &driver.UpsertSpec{
+		Table:   "time_spent_streak",
+		Columns: []string{"user_id", "current_streak", "longest_streak"},
+		Key:     []string{"user_id"},
+	}, userID, 0, 0); err != nil {
+		return err
+	}
+	streak, err := getStreak(ctx, tx, userID, true)
+	if err != nil {
+		return err
+	}
+	streak.Advance(day)
+	_, err = tx.ExecContext(ctx, `UPDATE time_spent_streak
+	SET current_streak = $1, longest_streak = $2, last_active = $3
+	WHERE user_id = $4`, streak.Current, streak.Longest, streak.LastActive, userID)
+	return err
+}
+
+func getStreak(ctx context.Context, conn driver.ITransactionalDB, userID string, lock bool) (*StreakModel, error) {
+	query := `SELECT current_streak, longest_streak, last_active FROM time_spent_streak WHERE user_id = $1`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	streak := &StreakModel{UserID: userID}
+	err := driver.Get(ctx, conn, streak, query, userID)
+	if err != nil && err != driver.ErrNoRows {
+		return nil, err
+	}
+	return streak, nil
+}
+
+func (repo *TimeSpentMySQL) GetStreak(ctx context.Context, userID string) (*StreakModel, error) {
+	return getStreak(ctx, repo.Conn, userID, false)
+}
+
+func (repo *TimeSpentMySQL) GetGoal(ctx context.Context, userID string) (*GoalModel, error) {
+	goal := &GoalModel{UserID: userID}
+	err := driver.Get(ctx, repo.Conn, goal, `SELECT vocabulary, grammar, listening, writing
+	FROM time_spent_goal WHERE user_id = $1`, userID)
+	if err != nil && err != driver.ErrNoRows {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (repo *TimeSpentMySQL) SaveGoal(ctx context.Context, goal *GoalModel) error {
+	_, err := driver.Upsert(ctx, repo.Conn, &driver.UpsertSpec{
+		Table:   "time_spent_goal",
+		Columns: []string{"user_id", "vocabulary", "grammar", "listening", "writing"},
+		Key:     []string{"user_id"},
+		Replace: []string{"vocabulary", "grammar", "listening", "writing"},
+	}, goal.UserID, goal.Vocabulary, goal.Grammar, goal.Listening, goal.Writing)
+	return err
+}
+
+// getTimeSpentByDay query the day record of user, nil is returned if it doesn't exist
+func getTimeSpentByDay(ctx context.Context, conn driver.ITransactionalDB, userID string, day time.Time, lock bool) (*TimeSpentModel, error) {
+	query := `SELECT id, user_id, vocabulary, grammar, listening, writing, ts
+	FROM lesson_time_spent WHERE user_id = $1 AND ts = $2`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	item := new(TimeSpentModel)
+	err := driver.Get(ctx, conn, item, query, userID, day)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/pot-code/go-boilerplate/internal/leaderboard"
 	"github.com/pot-code/go-boilerplate/internal/user"
 	"go.elastic.co/apm"
 )
@@ -11,6 +12,8 @@ import (
 // TimeSpentUseCaseImpl ...
 type TimeSpentUseCaseImpl struct {
 	TimeSpentRepository TimeSpentRepository
+	UserUseCase         user.UserUseCase
+	LeaderboardUseCase  leaderboard.LeaderboardUseCase
 }
 
 var _ TimeSpentUseCase = &TimeSpentUseCaseImpl{}
@@ -18,23 +21,271 @@ var _ TimeSpentUseCase = &TimeSpentUseCaseImpl{}
 // NewTimeSpentUseCase ...
 func NewTimeSpentUseCase(
 	TimeSpentRepository TimeSpentRepository,
+	UserUseCase user.UserUseCase,
+	LeaderboardUseCase leaderboard.LeaderboardUseCase,
 ) *TimeSpentUseCaseImpl {
-	return &TimeSpentUseCaseImpl{TimeSpentRepository}
+	return &TimeSpentUseCaseImpl{TimeSpentRepository, UserUseCase, LeaderboardUseCase}
 }
 
-// GetUserTimeSpent get times spent on learning
+// GetUserTimeSpent get times spent on learning in the week containing at
 //
-// ts must be in RFC3339 layout
+// the week is computed in the user's time zone and starts on the user's first day of week
 func (tsu *TimeSpentUseCaseImpl) GetUserTimeSpent(ctx context.Context, user *user.UserModel, at *time.Time) ([]*TimeSpentModel, error) {
 	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.GetUserTimeSpent", "service")
 	defer apmSpan.End()
 
-	timeSpent, err := tsu.TimeSpentRepository.GetTimeSpentInWeekByUser(ctx, user, at)
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	start := cal.bucketStart(cal.day(*at), GranularityWeek)
+	timeSpent, err := tsu.TimeSpentRepository.GetDailyTimeSpent(ctx, user.ID,
+		cal.storage(start), cal.storage(cal.nextBucket(start, GranularityWeek)))
 	if err != nil {
 		return nil, err
 	}
 	for _, e := range timeSpent {
-		e.Timestamp = e.TS.Unix() * 1e3 // milliseconds
+		day := cal.date(*e.TS)
+		e.Weekday = cal.weekday(day)
+		e.Timestamp = day.Unix() * 1e3 // milliseconds
 	}
 	return timeSpent, nil
 }
+
+// RecordTimeSpent record minutes spent on each skill in a day
+//
+// minutes are accumulated into the existing day record and added to leaderboards, replaying a recorded session has no effect
+func (tsu *TimeSpentUseCaseImpl) RecordTimeSpent(
+	ctx context.Context,
+	user *user.UserModel,
+	sessionID string,
+	record *TimeSpentModel,
+) (*TimeSpentModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.RecordTimeSpent", "service")
+	defer apmSpan.End()
+
+	if record.Total() > MaxMinutesPerDay {
+		return nil, ErrImplausibleTimeSpent
+	}
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	day := cal.date(*record.TS)
+	if day.After(cal.day(time.Now())) {
+		return nil, ErrFutureDate
+	}
+
+	result, replayed, err := tsu.TimeSpentRepository.RecordTimeSpent(ctx, sessionID, user.ID, cal.storage(day), record,
+		func(result *TimeSpentModel) error {
+			if result.Total() > MaxMinutesPerDay {
+				return ErrImplausibleTimeSpent
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if !replayed {
+		// the record is already saved, leaderboards are repaired by the rebuild job
+		if err := tsu.LeaderboardUseCase.AddTimeSpent(ctx, user.ID, cal.storage(day), record.Total()); err != nil {
+			apm.CaptureError(ctx, err).Send()
+		}
+	}
+	result.Weekday = cal.weekday(day)
+	result.Timestamp = day.Unix() * 1e3 // milliseconds
+	return result, nil
+}
+
+// GetTimeSpentReport aggregate time spent into zero-filled buckets
+//
+// from and to are calendar dates, their zones are ignored. Buckets are aligned to the start of day,
+// week or month in the user's time zone
+func (tsu *TimeSpentUseCaseImpl) GetTimeSpentReport(
+	ctx context.Context,
+	user *user.UserModel,
+	from, to time.Time,
+	granularity string,
+) (*TimeSpentReportModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.GetTimeSpentReport", "service")
+	defer apmSpan.End()
+
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	from = cal.date(from)
+	to = cal.date(to)
+	if from.After(to) {
+		return nil, ErrInvalidRange
+	}
+
+	first := cal.bucketStart(from, granularity)
+	end := cal.nextBucket(cal.bucketStart(to, granularity), granularity)
+	report := &TimeSpentReportModel{
+		Granularity: granularity,
+		Buckets:     []*TimeSpentBucketModel{},
+		Totals:      new(TimeSpentBucketModel),
+	}
+	index := make(map[time.Time]*TimeSpentBucketModel)
+	for t := first; t.Before(end); t = cal.nextBucket(t, granularity) {
+		if len(report.Buckets) == MaxReportBuckets {
+			return nil, ErrRangeTooLarge
+		}
+		bucket := &TimeSpentBucketModel{Start: t, Timestamp: t.Unix() * 1e3}
+		report.Buckets = append(report.Buckets, bucket)
+		index[t] = bucket
+	}
+	report.Totals.Start = first
+	report.Totals.Timestamp = first.Unix() * 1e3
+
+	days, err := tsu.TimeSpentRepository.GetDailyTimeSpent(ctx, user.ID, cal.storage(from), cal.storage(to.AddDate(0, 0, 1)))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range days {
+		if bucket, ok := index[cal.bucketStart(cal.date(*d.TS), granularity)]; ok {
+			bucket.add(d)
+			report.Totals.add(d)
+		}
+	}
+	return report, nil
+}
+
+// ExportTimeSpent export time spent of each day in chronological order
+//
+// from and to are calendar dates, their zones are ignored. TS of the exported model is the local midnight of the day
+func (tsu *TimeSpentUseCaseImpl) ExportTimeSpent(
+	ctx context.Context,
+	user *user.UserModel,
+	from, to *time.Time,
+	fn func(*TimeSpentModel) error,
+) error {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.ExportTimeSpent", "service")
+	defer apmSpan.End()
+
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return err
+	}
+	if from != nil && to != nil && cal.date(*from).After(cal.date(*to)) {
+		return ErrInvalidRange
+	}
+	var start, end *time.Time
+	if from != nil {
+		t := cal.storage(cal.date(*from))
+		start = &t
+	}
+	if to != nil {
+		t := cal.storage(cal.date(*to).AddDate(0, 0, 1))
+		end = &t
+	}
+
+	return tsu.TimeSpentRepository.IterateDailyTimeSpent(ctx, user.ID, start, end, func(e *TimeSpentModel) error {
+		day := cal.date(*e.TS)
+		e.TS = &day
+		e.Weekday = cal.weekday(day)
+		e.Timestamp = day.Unix() * 1e3 // milliseconds
+		return fn(e)
+	})
+}
+
+// getCalendar resolve time zone and first day of week, values set on user take precedence over the profile
+func (tsu *TimeSpentUseCaseImpl) getCalendar(ctx context.Context, u *user.UserModel) (*calendar, error) {
+	if err := tsu.UserUseCase.GetPreferences(ctx, u); err != nil {
+		return nil, err
+	}
+	return newCalendar(u)
+}
+
+// GetStreak get current and longest streak of days with activity
+func (tsu *TimeSpentUseCaseImpl) GetStreak(ctx context.Context, user *user.UserModel) (*StreakModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.GetStreak", "service")
+	defer apmSpan.End()
+
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	streak, err := tsu.TimeSpentRepository.GetStreak(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if streak.LastActive != nil {
+		last := cal.date(*streak.LastActive)
+		// the streak is still alive if user was active today or yesterday
+		if last.AddDate(0, 0, 1).Before(cal.day(time.Now())) {
+			streak.Current = 0
+		}
+		streak.LastActiveTimestamp = last.Unix() * 1e3 // milliseconds
+	}
+	return streak, nil
+}
+
+// GetGoal get daily goals
+func (tsu *TimeSpentUseCaseImpl) GetGoal(ctx context.Context, user *user.UserModel) (*GoalModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.GetGoal", "service")
+	defer apmSpan.End()
+
+	return tsu.TimeSpentRepository.GetGoal(ctx, user.ID)
+}
+
+// SetGoal set daily goals
+func (tsu *TimeSpentUseCaseImpl) SetGoal(ctx context.Context, user *user.UserModel, goal *GoalModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.SetGoal", "service")
+	defer apmSpan.End()
+
+	if goal.Vocabulary+goal.Grammar+goal.Listening+goal.Writing > MaxMinutesPerDay {
+		return ErrImplausibleTimeSpent
+	}
+	goal.UserID = user.ID
+	return tsu.TimeSpentRepository.SaveGoal(ctx, goal)
+}
+
+// GetGoalProgress compare time spent in a day with daily goals, skills without goal are omitted
+func (tsu *TimeSpentUseCaseImpl) GetGoalProgress(ctx context.Context, user *user.UserModel, at time.Time) (*GoalProgressModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "TimeSpentUseCaseImpl.GetGoalProgress", "service")
+	defer apmSpan.End()
+
+	cal, err := tsu.getCalendar(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	tsr := tsu.TimeSpentRepository
+	goal, err := tsr.GetGoal(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	day := cal.day(at)
+	days, err := tsr.GetDailyTimeSpent(ctx, user.ID, cal.storage(day), cal.storage(day.AddDate(0, 0, 1)))
+	if err != nil {
+		return nil, err
+	}
+	spent := new(TimeSpentModel)
+	for _, d := range days {
+		spent.Vocabulary += d.Vocabulary
+		spent.Grammar += d.Grammar
+		spent.Listening += d.Listening
+		spent.Writing += d.Writing
+	}
+
+	progress := &GoalProgressModel{
+		Timestamp: day.Unix() * 1e3, // milliseconds
+		Skills:    []*SkillGoalProgressModel{},
+		Met:       true,
+	}
+	for _, s := range []*SkillGoalProgressModel{
+		{Skill: "vocabulary", Goal: goal.Vocabulary, Spent: spent.Vocabulary},
+		{Skill: "grammar", Goal: goal.Grammar, Spent: spent.Grammar},
+		{Skill: "listening", Goal: goal.Listening, Spent: spent.Listening},
+		{Skill: "writing", Goal: goal.Writing, Spent: spent.Writing},
+	} {
+		if s.Goal == 0 {
+			continue
+		}
+		s.Met = s.Spent >= s.Goal
+		progress.Met = progress.Met && s.Met
+		progress.Skills = append(progress.Skills, s)
+	}
+	return progress, nil
+}
@@ -3,27 +3,109 @@ package user
 import (
 	"context"
 	"errors"
+	"time"
+
+	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
 )
 
 type UserModel struct {
-	ID         string
-	Username   string
-	Email      string
-	Password   string
-	LoginRetry int
-	LastLogin  int64
+	ID            string     `json:"id" db:"id"`
+	Username      string     `json:"username" db:"username"`
+	Email         string     `json:"email" db:"email"`
+	Password      string     `json:"-" db:"password"`
+	LoginRetry    int        `json:"login_retry" db:"login_retry"`
+	LastLogin     int64      `json:"last_login" db:"last_login"`
+	Locked        bool       `json:"locked" db:"locked"`
+	Verified      bool       `json:"verified" db:"verified"`
+	PasswordReset bool       `json:"password_reset" db:"password_reset"` // user must reset password before signing in
+	Roles         []string   `json:"roles" db:"-"`
+	Timezone      string     `json:"timezone" db:"timezone"`     // IANA time zone name
+	WeekStart     string     `json:"week_start" db:"week_start"` // first day of week
+	CreatedAt     *time.Time `json:"created_at,omitempty" db:"created_at"`
 }
 
-// ErrDuplicatedUser unique key constraint violation
-var ErrDuplicatedUser = errors.New("Username or email is already registered")
+// RoleAdmin role allowed to manage other users
+const RoleAdmin = "admin"
+
+// first day of week
+const (
+	WeekStartMonday = "monday"
+	WeekStartSunday = "sunday"
+)
+
+// Location load the time zone of user, UTC is used if it's not set
+func (um *UserModel) Location() (*time.Location, error) {
+	if um.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(um.Timezone)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// FirstWeekday first day of week of user, monday is used if it's not set
+func (um *UserModel) FirstWeekday() time.Weekday {
+	if um.WeekStart == WeekStartSunday {
+		return time.Sunday
+	}
+	return time.Monday
+}
+
+// UserFilter filter and pagination options for listing users
+type UserFilter struct {
+	Search      string     // username or email prefix
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Locked      *bool
+	Verified    *bool
+	Cursor      string // opaque cursor returned by the previous page
+	Limit       int
+}
+
+// UserPage a page of users
+type UserPage struct {
+	Items      []*UserModel `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+var (
+	// ErrDuplicatedUser unique key constraint violation
+	ErrDuplicatedUser = errors.New("Username or email is already registered")
+	// ErrUserNotFound no user matches the given ID
+	ErrUserNotFound = errors.New("User not found")
+	// ErrInvalidCursor cursor can't be decoded
+	ErrInvalidCursor = errors.New("Invalid cursor")
+	// ErrInvalidTimezone time zone is not a valid IANA name
+	ErrInvalidTimezone = errors.New("Invalid time zone")
+)
 
 type UserUseCase interface {
 	SignUp(ctx context.Context, post *UserModel) (*UserModel, error)
 	Exists(ctx context.Context, post *UserModel) (bool, error)
+	ListUsers(ctx context.Context, filter *UserFilter) (*UserPage, error)
+	GetUser(ctx context.Context, id string) (*UserModel, error)
+	SetLocked(ctx context.Context, id string, locked bool) error
+	ForcePasswordReset(ctx context.Context, id string) error
+	AssignRoles(ctx context.Context, id string, roles []string) error
+	// GetPreferences fill in Timezone and WeekStart of post with values in profile
+	GetPreferences(ctx context.Context, post *UserModel) error
+	UpdatePreferences(ctx context.Context, post *UserModel) error
 }
 
 type UserRepository interface {
 	FindByCredential(ctx context.Context, post *UserModel) (*UserModel, error)
 	UpdateLogin(ctx context.Context, post *UserModel) error
 	SaveUser(ctx context.Context, post *UserModel) error
+	FindByID(ctx context.Context, id string) (*UserModel, error)
+	ListUsers(ctx context.Context, filter *UserFilter) (*UserPage, error)
+	GetRoles(ctx context.Context, id string) ([]string, error)
+	SetRoles(ctx context.Context, id string, roles []string) error
+	SetLocked(ctx context.Context, id string, locked bool) error
+	SetPasswordReset(ctx context.Context, id string, reset bool) error
+	UpdatePassword(ctx context.Context, id string, password string) error
+	UpdatePreferences(ctx context.Context, post *UserModel) error
+	// WithTx repository running queries in tx
+	WithTx(tx driver.ITransactionalDB) UserRepository
 }
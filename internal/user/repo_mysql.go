@@ -3,8 +3,13 @@ package user
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/driver"
 	"github.com/pot-code/go-boilerplate/internal/infrastructure/uuid"
 )
@@ -24,21 +29,16 @@ func NewUserRepository(Conn driver.ITransactionalDB, UUIDGenerator uuid.Generato
 func (repo *UserMySQL) FindByCredential(ctx context.Context, post *UserModel) (*UserModel, error) {
 	conn := repo.Conn
 	username := post.Username
-	row, err := conn.QueryContext(ctx, `SELECT id, username, password, email, login_retry, last_login
-	FROM user WHERE username=? OR email=?`, username, username)
+	user := new(UserModel)
+	err := driver.Get(ctx, conn, user, `SELECT id, username, password, email, login_retry, last_login, locked, password_reset
+	FROM "user" WHERE username = $1 OR email = $1`, username)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer row.Close()
-
-	if row.Next() {
-		user := new(UserModel)
-		if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.LoginRetry, &user.LastLogin); err != nil {
-			return nil, err
-		}
-		return user, nil
-	}
-	return nil, nil
+	return user, nil
 }
 
 func (repo *UserMySQL) SaveUser(ctx context.Context, post *UserModel) error {
@@ -51,10 +51,10 @@ func (repo *UserMySQL) SaveUser(ctx context.Context, post *UserModel) error {
 		return err
 	}
 
-	_, err := conn.ExecContext(ctx, `INSERT INTO user(id, username, password, email, last_login)
-	VALUES(?,?,?,?,?)`, post.ID, post.Username, post.Password, post.Email, post.LastLogin)
+	_, err := conn.ExecContext(ctx, `INSERT INTO "user"(id, username, password, email, last_login)
+	VALUES($1, $2, $3, $4, $5)`, post.ID, post.Username, post.Password, post.Email, post.LastLogin)
 
-	if err, ok := err.(*mysql.MySQLError); ok && err.Number == 1062 {
+	if errors.Is(err, driver.ErrUniqueViolation) {
 		return ErrDuplicatedUser
 	}
 	return err
@@ -62,15 +62,187 @@ func (repo *UserMySQL) SaveUser(ctx context.Context, post *UserModel) error {
 
 func (repo *UserMySQL) UpdateLogin(ctx context.Context, post *UserModel) error {
 	conn := repo.Conn
-	_, err := conn.ExecContext(ctx, `UPDATE user
-	SET login_retry=?,
-			last_login=?
-	WHERE id = ?;`, post.LoginRetry, post.LastLogin, post.ID)
+	_, err := conn.ExecContext(ctx, `UPDATE "user"
+	SET login_retry = $1,
+			last_login = $2
+	WHERE id = $3`, post.LoginRetry, post.LastLogin, post.ID)
+	return err
+}
+
+// FindByID query user by ID, roles are not loaded
+func (repo *UserMySQL) FindByID(ctx context.Context, id string) (*UserModel, error) {
+	conn := repo.Conn
+	user := new(UserModel)
+	err := driver.Get(ctx, conn, user, `SELECT `+userColumns+` FROM "user" WHERE id = $1`, id)
+	if err == driver.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListUsers query users ordered by creation time(newest first) with keyset pagination
+func (repo *UserMySQL) ListUsers(ctx context.Context, filter *UserFilter) (*UserPage, error) {
+	conn := repo.Conn
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Search != "" {
+		prefix := escapeLike(filter.Search) + "%"
+		where = append(where, fmt.Sprintf("(username LIKE %s ESCAPE '!' OR email LIKE %s ESCAPE '!')", arg(prefix), arg(prefix)))
+	}
+	if filter.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		where = append(where, "created_at < "+arg(*filter.CreatedTo))
+	}
+	if filter.Locked != nil {
+		where = append(where, "locked = "+arg(*filter.Locked))
+	}
+	if filter.Verified != nil {
+		where = append(where, "verified = "+arg(*filter.Verified))
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeUserCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(created_at < %s OR (created_at = %s AND id < %s))",
+			arg(createdAt), arg(createdAt), arg(id)))
+	}
+
+	query := `SELECT ` + userColumns + ` FROM "user"`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// fetch one more row to tell if there is a next page
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + arg(filter.Limit+1)
+
+	page := &UserPage{Items: make([]*UserModel, 0, filter.Limit)}
+	if err := driver.SelectAll(ctx, conn, &page.Items, query, args...); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		// created_at is NOT NULL, rows without it would be skipped by the cursor predicate
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeUserCursor(*last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// GetRoles query roles assigned to user
+func (repo *UserMySQL) GetRoles(ctx context.Context, id string) ([]string, error) {
+	conn := repo.Conn
+	roles := []string{}
+	err := driver.SelectAll(ctx, conn, &roles, `SELECT role FROM user_role WHERE user_id = $1 ORDER BY role`, id)
+	return roles, err
+}
+
+// SetRoles replace roles of user in one transaction
+func (repo *UserMySQL) SetRoles(ctx context.Context, id string, roles []string) (err error) {
+	tx, err := repo.Conn.BeginTx(ctx, &driver.TxOptions{
+		Isolation:  sql.LevelReadCommitted,
+		AccessMode: driver.AccessReadWrite,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_role WHERE user_id = $1`, id); err != nil {
+		return
+	}
+	for _, role := range roles {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO user_role(user_id, role) VALUES($1, $2)`, id, role); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetLocked lock or unlock user, login retry state is reset either way
+func (repo *UserMySQL) SetLocked(ctx context.Context, id string, locked bool) error {
+	conn := repo.Conn
+	_, err := conn.ExecContext(ctx, `UPDATE "user" SET locked = $1, login_retry = 0 WHERE id = $2`, locked, id)
+	return err
+}
+
+// SetPasswordReset mark whether user must reset password before signing in
+func (repo *UserMySQL) SetPasswordReset(ctx context.Context, id string, reset bool) error {
+	conn := repo.Conn
+	_, err := conn.ExecContext(ctx, `UPDATE "user" SET password_reset = $1 WHERE id = $2`, reset, id)
+	return err
+}
+
+// UpdatePassword set password hash and clear the reset flag
+func (repo *UserMySQL) UpdatePassword(ctx context.Context, id string, password string) error {
+	conn := repo.Conn
+	_, err := conn.ExecContext(ctx, `UPDATE "user" SET password = $1, password_reset = $2, login_retry = 0 WHERE id = $3`,
+		password, false, id)
 	return err
 }
 
+// UpdatePreferences update timezone and week start
+func (repo *UserMySQL) UpdatePreferences(ctx context.Context, post *UserModel) error {
+	conn := repo.Conn
+	_, err := conn.ExecContext(ctx, `UPDATE "user" SET timezone = $1, week_start = $2 WHERE id = $3`,
+		post.Timezone, post.WeekStart, post.ID)
+	return err
+}
+
+// WithTx copy of repo running queries in tx
+func (repo *UserMySQL) WithTx(tx driver.ITransactionalDB) UserRepository {
+	return &UserMySQL{tx, repo.UUIDGenerator}
+}
+
 func (repo *UserMySQL) BeginTx(ctx context.Context) (driver.ITransactionalDB, error) {
 	return repo.Conn.BeginTx(ctx, &driver.TxOptions{
 		Isolation: sql.LevelRepeatableRead,
 	})
 }
+
+const userColumns = `id, username, email, login_retry, last_login, locked, verified, password_reset, timezone, week_start, created_at`
+
+// likeEscaper escape wildcards with '!', backslashes are string escapes in MySQL and not LIKE escapes in SQLite
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func encodeUserCursor(createdAt time.Time, id string) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUserCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	nano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, nano).UTC(), parts[1], nil
+}
@@ -56,3 +56,120 @@ func (uu *UserUseCaseImpl) Exists(ctx context.Context, post *UserModel) (bool, e
 	}
 	return true, nil
 }
+
+// ListUsers list users matching filter, newest first
+func (uu *UserUseCaseImpl) ListUsers(ctx context.Context, filter *UserFilter) (*UserPage, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.ListUsers", "service")
+	defer apmSpan.End()
+
+	return uu.UserRepository.ListUsers(ctx, filter)
+}
+
+// GetUser get user detail with roles
+func (uu *UserUseCaseImpl) GetUser(ctx context.Context, id string) (*UserModel, error) {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.GetUser", "service")
+	defer apmSpan.End()
+
+	ur := uu.UserRepository
+	user, err := ur.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Roles, err = ur.GetRoles(ctx, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetLocked lock or unlock user
+func (uu *UserUseCaseImpl) SetLocked(ctx context.Context, id string, locked bool) error {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.SetLocked", "service")
+	defer apmSpan.End()
+
+	if err := uu.mustExist(ctx, id); err != nil {
+		return err
+	}
+	return uu.UserRepository.SetLocked(ctx, id, locked)
+}
+
+// ForcePasswordReset require user to reset password before next sign in
+func (uu *UserUseCaseImpl) ForcePasswordReset(ctx context.Context, id string) error {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.ForcePasswordReset", "service")
+	defer apmSpan.End()
+
+	if err := uu.mustExist(ctx, id); err != nil {
+		return err
+	}
+	return uu.UserRepository.SetPasswordReset(ctx, id, true)
+}
+
+// AssignRoles replace roles of user, duplicated roles are removed
+func (uu *UserUseCaseImpl) AssignRoles(ctx context.Context, id string, roles []string) error {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.AssignRoles", "service")
+	defer apmSpan.End()
+
+	if err := uu.mustExist(ctx, id); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(roles))
+	unique := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+	return uu.UserRepository.SetRoles(ctx, id, unique)
+}
+
+// GetPreferences load preferences from profile, fields already set in post are kept
+func (uu *UserUseCaseImpl) GetPreferences(ctx context.Context, post *UserModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.GetPreferences", "service")
+	defer apmSpan.End()
+
+	if post.Timezone != "" && post.WeekStart != "" {
+		return nil
+	}
+	user, err := uu.UserRepository.FindByID(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if post.Timezone == "" {
+		post.Timezone = user.Timezone
+	}
+	if post.WeekStart == "" {
+		post.WeekStart = user.WeekStart
+	}
+	return nil
+}
+
+// UpdatePreferences save timezone and week start
+func (uu *UserUseCaseImpl) UpdatePreferences(ctx context.Context, post *UserModel) error {
+	apmSpan, _ := apm.StartSpan(ctx, "UserUseCaseImpl.UpdatePreferences", "service")
+	defer apmSpan.End()
+
+	if _, err := post.Location(); err != nil {
+		return err
+	}
+	if err := uu.mustExist(ctx, post.ID); err != nil {
+		return err
+	}
+	return uu.UserRepository.UpdatePreferences(ctx, post)
+}
+
+func (uu *UserUseCaseImpl) mustExist(ctx context.Context, id string) error {
+	user, err := uu.UserRepository.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return nil
+}